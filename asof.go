@@ -0,0 +1,116 @@
+package tonight
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ProjectAsOf returns the project identified by id as it was at t,
+// folding its events up to then from the latest snapshot before t. The
+// snapshots can be nil to fold all the events.
+func ProjectAsOf(ctx context.Context, store EventStore, snapshots SnapshotStore, id uuid.UUID, t time.Time) (Project, error) {
+	snap, err := ReplayProject(ctx, store, snapshots, id, t)
+	if err != nil {
+		return Project{}, err
+	}
+
+	project, ok := snap.Projection.Project(id)
+	if !ok {
+		return Project{}, fmt.Errorf("project %s did not exist or was in the trash at %s: %w", id, t.Format(time.RFC3339), ErrNotFound)
+	}
+	return project, nil
+}
+
+// Project returns the project identified by id with its releases and
+// their tasks, ordered like ProjectStore.Get: releases by title with
+// the backlog last, tasks by rank then creation date. Like the stores,
+// it leaves out the entities in the trash.
+func (p *Projection) Project(id uuid.UUID) (Project, bool) {
+	project, ok := p.Projects[id]
+	if !ok || project.DeletedAt != nil {
+		return Project{}, false
+	}
+
+	tasksByRelease := make(map[uuid.UUID][]Task)
+	for _, task := range p.Tasks {
+		if task.DeletedAt != nil {
+			continue
+		}
+		tasksByRelease[task.Release.UUID] = append(tasksByRelease[task.Release.UUID], task)
+	}
+
+	project.Releases = make([]Release, 0)
+	for _, release := range p.Releases {
+		if release.Project.UUID != id || release.DeletedAt != nil {
+			continue
+		}
+
+		release.Tasks = tasksByRelease[release.UUID]
+		if release.Tasks == nil {
+			release.Tasks = make([]Task, 0)
+		}
+		for i, task := range release.Tasks {
+			release.Tasks[i].Rank = p.Ranks[task.UUID]
+		}
+		sort.Slice(release.Tasks, func(i, j int) bool {
+			ti, tj := release.Tasks[i], release.Tasks[j]
+			ri, iRanked := p.Ranks[ti.UUID]
+			rj, jRanked := p.Ranks[tj.UUID]
+			if iRanked != jRanked {
+				return iRanked
+			}
+			if iRanked && ri != rj {
+				return ri < rj
+			}
+			return ti.CreatedAt.Before(tj.CreatedAt)
+		})
+		project.Releases = append(project.Releases, release)
+	}
+
+	sort.Slice(project.Releases, func(i, j int) bool {
+		ri, rj := project.Releases[i], project.Releases[j]
+		iBacklog, jBacklog := ri.UUID == id, rj.UUID == id
+		if iBacklog != jBacklog {
+			return jBacklog
+		}
+		return ri.Title < rj.Title
+	})
+
+	return project, true
+}
+
+func (s service) projectAsOf(c echo.Context, user User, id uuid.UUID, asOf string) error {
+	t, err := time.Parse(time.RFC3339, asOf)
+	if err != nil {
+		return invalid("as_of", "should be an RFC 3339 date")
+	}
+
+	ctx := c.Request().Context()
+
+	perm, err := s.userStore.Permission(ctx, user, id.String())
+	if err != nil {
+		return err
+	}
+	if perm == "" {
+		return ErrForbidden
+	}
+
+	project, err := ProjectAsOf(ctx, s.eventStore, s.snapshotStore, id, t)
+	if err != nil {
+		return err
+	}
+	res, err := renderProject(ctx, s.projectStore, user, project)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": res,
+	})
+}
@@ -0,0 +1,165 @@
+package tonight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectAsOf(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	task1 := uuid.NewV1()
+	task2 := uuid.NewV1()
+	now := time.Now()
+
+	store := &sliceEventStore{
+		{
+			UUID:        uuid.NewV1(),
+			Type:        ProjectCreate,
+			EntityUUID:  projectUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(`{"name": "project"}`),
+			CreatedAt:   now,
+		},
+		{
+			UUID:        uuid.NewV1(),
+			Type:        ReleaseCreate,
+			EntityUUID:  releaseUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(fmt.Sprintf(`{"title": "v1", "project": {"uuid": "%s"}}`, projectUUID)),
+			CreatedAt:   now.Add(time.Second),
+		},
+		{
+			UUID:        uuid.NewV1(),
+			Type:        TaskCreate,
+			EntityUUID:  task1,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(fmt.Sprintf(`{"title": "first", "release": {"uuid": "%s"}}`, projectUUID)),
+			CreatedAt:   now.Add(2 * time.Second),
+		},
+		{
+			UUID:        uuid.NewV1(),
+			Type:        TaskCreate,
+			EntityUUID:  task2,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(fmt.Sprintf(`{"title": "second", "release": {"uuid": "%s"}}`, projectUUID)),
+			CreatedAt:   now.Add(3 * time.Second),
+		},
+		{
+			UUID:        uuid.NewV1(),
+			Type:        ProjectReorderTasks,
+			EntityUUID:  projectUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(fmt.Sprintf(`{"ranks": ["%s", "%s"]}`, task2, task1)),
+			CreatedAt:   now.Add(4 * time.Second),
+		},
+		{
+			UUID:        uuid.NewV1(),
+			Type:        TaskDone,
+			EntityUUID:  task1,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(`{}`),
+			CreatedAt:   now.Add(5 * time.Second),
+		},
+	}
+
+	_, err := ProjectAsOf(ctx, store, nil, projectUUID, now.Add(-time.Second))
+	require.Error(t, err)
+
+	project, err := ProjectAsOf(ctx, store, nil, projectUUID, now.Add(3*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, "project", project.Name)
+	require.Len(t, project.Releases, 2)
+	require.Equal(t, releaseUUID, project.Releases[0].UUID)
+	require.Empty(t, project.Releases[0].Tasks)
+	require.Equal(t, projectUUID, project.Releases[1].UUID)
+	backlog := project.Releases[1].Tasks
+	require.Len(t, backlog, 2)
+	require.Equal(t, task1, backlog[0].UUID)
+	require.Equal(t, task2, backlog[1].UUID)
+	require.Equal(t, TaskStatusTODO, backlog[0].Status)
+
+	project, err = ProjectAsOf(ctx, store, nil, projectUUID, now.Add(5*time.Second))
+	require.NoError(t, err)
+	backlog = project.Releases[1].Tasks
+	require.Equal(t, task2, backlog[0].UUID)
+	require.Equal(t, task1, backlog[1].UUID)
+	require.Equal(t, TaskStatusDONE, backlog[1].Status)
+}
+
+func TestProjectAsOfTrash(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	now := time.Now()
+
+	store := &sliceEventStore{}
+	steps := []struct {
+		typ        EventType
+		entityUUID uuid.UUID
+		payload    string
+	}{
+		{typ: ProjectCreate, entityUUID: projectUUID, payload: `{"name": "project"}`},
+		{typ: ReleaseCreate, entityUUID: releaseUUID, payload: fmt.Sprintf(`{"title": "v1", "project": {"uuid": "%s"}}`, projectUUID)},
+		{typ: TaskCreate, entityUUID: taskUUID, payload: fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, projectUUID)},
+		{typ: TaskDelete, entityUUID: taskUUID, payload: `{}`},
+		{typ: ReleaseDelete, entityUUID: releaseUUID, payload: `{}`},
+		{typ: ProjectDelete, entityUUID: projectUUID, payload: `{}`},
+		{typ: ProjectRestore, entityUUID: projectUUID, payload: `{}`},
+		{typ: ReleaseRestore, entityUUID: releaseUUID, payload: `{}`},
+		{typ: TaskRestore, entityUUID: taskUUID, payload: `{}`},
+	}
+	for i, step := range steps {
+		require.NoError(t, store.Store(ctx, Event{
+			UUID:        uuid.NewV1(),
+			Type:        step.typ,
+			EntityUUID:  step.entityUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(step.payload),
+			CreatedAt:   now.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	at := func(i int) time.Time {
+		return now.Add(time.Duration(i) * time.Second)
+	}
+
+	project, err := ProjectAsOf(ctx, store, nil, projectUUID, at(3))
+	require.NoError(t, err)
+	require.Len(t, project.Releases, 2)
+	require.Empty(t, project.Releases[1].Tasks)
+
+	project, err = ProjectAsOf(ctx, store, nil, projectUUID, at(4))
+	require.NoError(t, err)
+	require.Len(t, project.Releases, 1)
+	require.Equal(t, projectUUID, project.Releases[0].UUID)
+
+	_, err = ProjectAsOf(ctx, store, nil, projectUUID, at(5))
+	require.True(t, errors.Is(err, ErrNotFound), "expected not found, got %v", err)
+
+	// The entities are back once restored
+	project, err = ProjectAsOf(ctx, store, nil, projectUUID, at(6))
+	require.NoError(t, err)
+	require.Len(t, project.Releases, 1)
+
+	project, err = ProjectAsOf(ctx, store, nil, projectUUID, at(8))
+	require.NoError(t, err)
+	require.Len(t, project.Releases, 2)
+	require.Equal(t, releaseUUID, project.Releases[0].UUID)
+	require.Len(t, project.Releases[1].Tasks, 1)
+	require.Equal(t, taskUUID, project.Releases[1].Tasks[0].UUID)
+}
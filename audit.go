@@ -0,0 +1,184 @@
+package tonight
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// An AuditEntry is an event of a project, with the user who requested
+// it.
+type AuditEntry struct {
+	Event Event `json:"event"`
+	User  User  `json:"user"`
+}
+
+// Audit returns a page of the events matching filter, the most recent
+// first, with their users. It also returns whether there are more.
+func Audit(ctx context.Context, store EventStore, userStore UserStore, filter EventFilter) ([]AuditEntry, bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// One more event tells whether there is a next page
+	limit := filter.Limit
+	filter.Reverse = true
+	filter.Limit = limit + 1
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() { errc <- store.List(ctx, filter, ch) }()
+
+	events := make([]Event, 0, filter.Limit)
+	for e := range ch {
+		events = append(events, e)
+	}
+	if err := <-errc; err != nil {
+		return nil, false, err
+	}
+
+	more := len(events) > limit
+	if more {
+		events = events[:limit]
+	}
+
+	names, err := userNames(ctx, userStore, events)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries := make([]AuditEntry, len(events))
+	for i, e := range events {
+		entries[i] = AuditEntry{
+			Event: e,
+			User:  User{ID: e.UserID, Name: names[e.UserID]},
+		}
+	}
+	return entries, more, nil
+}
+
+// userNames returns the names of the users of the events, by id.
+func userNames(ctx context.Context, userStore UserStore, events []Event) (map[string]string, error) {
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, e := range events {
+		if e.UserID != "" && !seen[e.UserID] {
+			ids = append(ids, e.UserID)
+			seen[e.UserID] = true
+		}
+	}
+	users, err := userStore.List(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	names := make(map[string]string, len(users))
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+	return names, nil
+}
+
+// audit lists the events of a project and of its releases and tasks.
+// It accepts the user_id, correlation_id, type (repeated or comma
+// separated), since and until (RFC 3339) filters, and is paginated by
+// offset and limit.
+func (s service) audit(c echo.Context) error {
+	projectUUID, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	perm, err := s.userStore.Permission(ctx, user, projectUUID.String())
+	if err != nil {
+		return err
+	}
+	if perm != "owner" {
+		return ErrForbidden
+	}
+
+	filter, err := auditFilter(c)
+	if err != nil {
+		return err
+	}
+	filter.ProjectUUID = projectUUID
+
+	entries, more, err := Audit(ctx, s.eventStore, s.userStore, filter)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": entries,
+		"pagination": map[string]interface{}{
+			"offset":   filter.Offset,
+			"limit":    filter.Limit,
+			"has_more": more,
+		},
+	})
+}
+
+func auditFilter(c echo.Context) (EventFilter, error) {
+	filter := EventFilter{
+		UserID: c.QueryParam("user_id"),
+		Limit:  defaultAuditLimit,
+	}
+
+	if param := c.QueryParam("correlation_id"); param != "" {
+		id, err := uuid.FromString(param)
+		if err != nil {
+			return EventFilter{}, invalid("correlation_id", "should be a uuid, got %q", param)
+		}
+		filter.CorrelationID = id
+	}
+
+	for _, param := range c.QueryParams()["type"] {
+		for _, typ := range strings.Split(param, ",") {
+			if _, ok := schemas[EventType(typ)]; !ok {
+				return EventFilter{}, invalid("type", "has an unknown event type %s", typ)
+			}
+			filter.Types = append(filter.Types, EventType(typ))
+		}
+	}
+
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if param := c.QueryParam(name); param != "" {
+			parsed, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				return EventFilter{}, invalid(name, "should be an RFC 3339 date")
+			}
+			*t = parsed
+		}
+	}
+
+	for name, v := range map[string]*int{"offset": &filter.Offset, "limit": &filter.Limit} {
+		if param := c.QueryParam(name); param != "" {
+			parsed, err := strconv.Atoi(param)
+			if err != nil || parsed < 0 {
+				return EventFilter{}, invalid(name, "should be a positive integer, got %q", param)
+			}
+			*v = parsed
+		}
+	}
+	if filter.Limit == 0 || filter.Limit > maxAuditLimit {
+		return EventFilter{}, invalid("limit", "should be between 1 and %d", maxAuditLimit)
+	}
+
+	return filter, nil
+}
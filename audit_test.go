@@ -0,0 +1,98 @@
+package tonight
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	now := time.Now()
+
+	store := sliceEventStore{}
+	for i, typ := range []EventType{ProjectCreate, TaskCreate, TaskUpdate, TaskDone} {
+		userID := "alice"
+		if i%2 == 1 {
+			userID = "bob"
+		}
+		store = append(store, Event{
+			UUID:        uuid.NewV1(),
+			Type:        typ,
+			EntityUUID:  uuid.NewV1(),
+			ProjectUUID: projectUUID,
+			UserID:      userID,
+			Payload:     []byte(`{}`),
+			CreatedAt:   now.Add(time.Duration(i) * time.Second),
+		})
+	}
+	// Not in the project
+	store = append(store, Event{UUID: uuid.NewV1(), Type: TaskDone, ProjectUUID: uuid.NewV1(), UserID: "alice"})
+
+	s := service{
+		eventStore: &store,
+		userStore:  permissionUserStore{"alice": "owner", "bob": "member"},
+	}
+	e := echo.New()
+	e.GET("/projects/:uuid/audit", s.audit)
+
+	type response struct {
+		Data []struct {
+			Event struct {
+				UUID uuid.UUID `json:"uuid"`
+			} `json:"event"`
+			User User `json:"user"`
+		} `json:"data"`
+		Pagination struct {
+			HasMore bool `json:"has_more"`
+		} `json:"pagination"`
+	}
+	audit := func(userID, query string) (int, response) {
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/projects/%s/audit?%s", projectUUID, query), nil)
+		req.Header.Set("Token-Claim-Sub", userID)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		var res response
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		}
+		return rec.Code, res
+	}
+	uuids := func(res response) []uuid.UUID {
+		ids := make([]uuid.UUID, len(res.Data))
+		for i, entry := range res.Data {
+			ids[i] = entry.Event.UUID
+		}
+		return ids
+	}
+
+	code, res := audit("alice", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []uuid.UUID{store[3].UUID, store[2].UUID, store[1].UUID, store[0].UUID}, uuids(res))
+	require.Equal(t, User{ID: "alice", Name: "alice"}, res.Data[1].User)
+	require.False(t, res.Pagination.HasMore)
+
+	code, res = audit("alice", "limit=2&offset=1")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []uuid.UUID{store[2].UUID, store[1].UUID}, uuids(res))
+	require.True(t, res.Pagination.HasMore)
+
+	code, res = audit("alice", "user_id=bob&type=TaskCreate,TaskDone")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []uuid.UUID{store[3].UUID, store[1].UUID}, uuids(res))
+
+	code, _ = audit("alice", "type=Unknown")
+	require.NotEqual(t, http.StatusOK, code)
+
+	// Only owners can see the audit log
+	code, _ = audit("bob", "")
+	require.NotEqual(t, http.StatusOK, code)
+}
@@ -0,0 +1,324 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// maxBulkTasks is the maximum number of tasks the operations of a bulk
+// request can target, summed over the operations.
+const maxBulkTasks = 500
+
+// A BulkOp is the kind of a bulk operation.
+type BulkOp string
+
+const (
+	BulkDone    BulkOp = "done"
+	BulkReopen  BulkOp = "reopen"
+	BulkMove    BulkOp = "move"
+	BulkRetitle BulkOp = "retitle"
+	BulkDelete  BulkOp = "delete"
+)
+
+// A BulkOperation applies its op to each of its tasks. Release is the
+// destination of a move, Title the new title of a retitle.
+type BulkOperation struct {
+	Op      BulkOp      `json:"op"`
+	Tasks   []uuid.UUID `json:"tasks"`
+	Release uuid.UUID   `json:"release"`
+	Title   string      `json:"title"`
+}
+
+type bulkService struct {
+	bus          *EventBus
+	transactor   Transactor
+	eventStore   EventStore
+	taskStore    TaskStore
+	projectStore ProjectStore
+	releaseStore ReleaseStore
+	trashStore   TrashStore
+	userStore    UserStore
+}
+
+// bulkChange is the event of an operation on a task, with the task as
+// it is after the operation.
+type bulkChange struct {
+	event Event
+	task  Task
+}
+
+// apply applies a batch of operations to the tasks of a project. The
+// whole batch is validated before anything is written, then written in
+// a single transaction, with one event per task changed by each
+// operation. The events share a correlation id. Operations not changing
+// a task, like marking a done task as done, are skipped.
+func (s bulkService) apply(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	projectUUID, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Operations []BulkOperation `json:"operations"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	perm, err := s.userStore.Permission(ctx, user, projectUUID.String())
+	if err != nil {
+		return err
+	}
+	if perm != "owner" {
+		return ErrForbidden
+	}
+
+	changes, tasks, err := s.plan(ctx, user, projectUUID, body.Operations)
+	if err != nil {
+		return err
+	}
+
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		for _, change := range changes {
+			if err := s.eventStore.Store(ctx, change.event); err != nil {
+				return fmt.Errorf("error storing event: %w", err)
+			}
+
+			if change.event.Type == TaskDelete {
+				if err := s.trashStore.Delete(ctx, TrashTask, change.task.UUID, change.event.CreatedAt); err != nil {
+					return fmt.Errorf("error deleting task: %w", err)
+				}
+				continue
+			}
+
+			// The task is written once per operation, so that its
+			// version follows its events
+			if err := s.taskStore.Upsert(ctx, change.task); err != nil {
+				return fmt.Errorf("error updating task: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		publish(c, s.bus, change.event)
+	}
+
+	res, err := renderTasks(ctx, s.projectStore, user, tasks...)
+	if err != nil {
+		return err
+	}
+
+	var correlationID uuid.UUID
+	if len(changes) > 0 {
+		correlationID = changes[0].event.CorrelationID
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"correlation_id": correlationID,
+			"events":         len(changes),
+			"tasks":          res,
+		},
+	})
+}
+
+// plan validates the operations and returns the changes they make, in
+// order, and the tasks they target as they will be once the changes
+// are written. All the invalid operations are reported at once, by
+// their index in the request.
+func (s bulkService) plan(ctx context.Context, user User, projectUUID uuid.UUID, ops []BulkOperation) ([]bulkChange, []Task, error) {
+	if len(ops) == 0 {
+		return nil, nil, invalid("operations", "cannot be empty")
+	}
+	count := 0
+	for _, op := range ops {
+		count += len(op.Tasks)
+	}
+	if count > maxBulkTasks {
+		return nil, nil, invalid("operations", "should target at most %d tasks, got %d", maxBulkTasks, count)
+	}
+
+	fields := make(map[string]string)
+	releases := make(map[uuid.UUID]bool)
+	// inProject returns whether the release belongs to the project and
+	// is not in the trash
+	inProject := func(releaseUUID uuid.UUID) (bool, error) {
+		if ok, seen := releases[releaseUUID]; seen {
+			return ok, nil
+		}
+		release, err := s.releaseStore.Get(ctx, releaseUUID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return false, err
+		}
+		releases[releaseUUID] = err == nil && release.Project.UUID == projectUUID
+		return releases[releaseUUID], nil
+	}
+
+	// The operations apply one after the other on the tasks
+	tasks := make(map[uuid.UUID]Task)
+	order := make([]uuid.UUID, 0)
+	changes := make([]bulkChange, 0)
+	correlationID := uuid.NewV1()
+	now := time.Now()
+	for i, op := range ops {
+		field := fmt.Sprintf("operations[%d]", i)
+		switch op.Op {
+		case BulkDone, BulkReopen, BulkDelete:
+		case BulkMove:
+			ok, err := inProject(op.Release)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !ok {
+				fields[field+".release"] = "is not a release of the project"
+				continue
+			}
+		case BulkRetitle:
+			if op.Title == "" {
+				fields[field+".title"] = "cannot be empty"
+				continue
+			}
+		default:
+			fields[field+".op"] = fmt.Sprintf("is unknown, got %q", op.Op)
+			continue
+		}
+		if len(op.Tasks) == 0 {
+			fields[field+".tasks"] = "cannot be empty"
+			continue
+		}
+
+		for j, id := range op.Tasks {
+			taskField := fmt.Sprintf("%s.tasks[%d]", field, j)
+
+			task, seen := tasks[id]
+			if !seen {
+				var err error
+				task, err = s.taskStore.Get(ctx, id, user)
+				if errors.Is(err, ErrNotFound) {
+					fields[taskField] = "is not a task of the project"
+					continue
+				}
+				if err != nil {
+					return nil, nil, err
+				}
+				ok, err := inProject(task.Release.UUID)
+				if err != nil {
+					return nil, nil, err
+				}
+				if !ok {
+					fields[taskField] = "is not a task of the project"
+					continue
+				}
+				order = append(order, id)
+			}
+			if task.DeletedAt != nil {
+				fields[taskField] = "is deleted by a previous operation"
+				continue
+			}
+
+			evt, changed, err := bulkEvent(op, &task, now)
+			if err != nil {
+				return nil, nil, err
+			}
+			tasks[id] = task
+			if !changed {
+				continue
+			}
+
+			evt.UUID = uuid.NewV1()
+			evt.EntityUUID = id
+			evt.ProjectUUID = projectUUID
+			evt.UserID = user.ID
+			evt.CorrelationID = correlationID
+			evt.CreatedAt = now
+			changes = append(changes, bulkChange{event: evt, task: task})
+
+			if evt.Type != TaskDelete {
+				task.Version++
+				tasks[id] = task
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return nil, nil, &ValidationError{Fields: fields}
+	}
+
+	res := make([]Task, len(order))
+	for i, id := range order {
+		res[i] = tasks[id]
+	}
+	return changes, res, nil
+}
+
+// bulkEvent applies op to task and returns the event recording it,
+// without its identifiers, and whether it changed the task.
+func bulkEvent(op BulkOperation, task *Task, now time.Time) (Event, bool, error) {
+	var typ EventType
+	var payload interface{}
+	switch op.Op {
+	case BulkDone:
+		if task.Status == TaskStatusDONE {
+			return Event{}, false, nil
+		}
+		task.Status = TaskStatusDONE
+		typ, payload = TaskDone, taskDonePayload{}
+
+	case BulkReopen:
+		if task.Status == TaskStatusTODO {
+			return Event{}, false, nil
+		}
+		task.Status = TaskStatusTODO
+		typ, payload = TaskUpdate, taskUpdatePayload{Title: task.Title, Status: task.Status}
+
+	case BulkRetitle:
+		if task.Title == op.Title {
+			return Event{}, false, nil
+		}
+		task.Title = op.Title
+		typ, payload = TaskUpdate, taskUpdatePayload{Title: task.Title, Status: task.Status}
+
+	case BulkMove:
+		if task.Release.UUID == op.Release {
+			return Event{}, false, nil
+		}
+		task.Release = Release{UUID: op.Release}
+		task.Rank = ""
+		var p taskMoveToReleasePayload
+		p.Release.UUID = op.Release
+		typ, payload = TaskMoveToRelease, p
+
+	case BulkDelete:
+		deletedAt := now
+		task.DeletedAt = &deletedAt
+		typ, payload = TaskDelete, trashPayload{}
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, false, err
+	}
+	task.UpdatedAt = now
+	return Event{Type: typ, Payload: b}, true, nil
+}
@@ -0,0 +1,240 @@
+package tonight
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrEventBusClosed is returned when publishing to a closed EventBus.
+var ErrEventBusClosed = errors.New("event bus closed")
+
+// An EventBus dispatches the events stored by the handlers to the
+// subscribers interested in them: notifications, search indexing,
+// webhooks, live updates...
+//
+// Delivery is asynchronous but bounded: Publish blocks when the bus
+// buffer is full, and the bus waits for subscribers whose buffer is
+// full. A slow subscriber hence slows down publishers instead of
+// losing events. The live subscriptions, see SubscribeLive, are never
+// waited for.
+type EventBus struct {
+	bufferSize int
+	queue      chan Event
+
+	// mu protects closed, and is held for reading while publishing
+	// so that the queue is not closed under the feet of a publisher.
+	mu     sync.RWMutex
+	closed bool
+
+	subsMu        sync.Mutex
+	subscriptions map[*Subscription]struct{}
+
+	done chan struct{}
+}
+
+// NewEventBus starts an EventBus buffering up to bufferSize events,
+// for itself and for each of its subscriptions.
+func NewEventBus(bufferSize int) *EventBus {
+	b := &EventBus{
+		bufferSize:    bufferSize,
+		queue:         make(chan Event, bufferSize),
+		subscriptions: make(map[*Subscription]struct{}),
+		done:          make(chan struct{}),
+	}
+	go b.dispatch()
+	return b
+}
+
+// Publish e to the subscribers of the bus. Publish returns as soon as e
+// is buffered, or an error if ctx is done first.
+func (b *EventBus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrEventBusClosed
+	}
+
+	select {
+	case b.queue <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe to the events of the project identified by projectUUID,
+// or of all the projects if it is uuid.Nil. If types are given, only
+// events of those types are received.
+func (b *EventBus) Subscribe(projectUUID uuid.UUID, types ...EventType) *Subscription {
+	return b.subscribe(projectUUID, false, types)
+}
+
+// SubscribeLive is Subscribe for the subscribers the bus should not
+// wait for, like the connections of clients: the subscription is
+// closed as soon as its buffer is full instead. The subscriber then
+// catches up some other way, from the event store.
+func (b *EventBus) SubscribeLive(projectUUID uuid.UUID, types ...EventType) *Subscription {
+	return b.subscribe(projectUUID, true, types)
+}
+
+func (b *EventBus) subscribe(projectUUID uuid.UUID, live bool, types []EventType) *Subscription {
+	s := &Subscription{
+		bus:         b,
+		projectUUID: projectUUID,
+		types:       types,
+		live:        live,
+		ch:          make(chan Event, b.bufferSize),
+		closed:      make(chan struct{}),
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		s.Close()
+		return s
+	}
+
+	b.subsMu.Lock()
+	b.subscriptions[s] = struct{}{}
+	b.subsMu.Unlock()
+	return s
+}
+
+// Close the bus: the events already published are delivered, then
+// all the subscriptions are closed. Close blocks until then.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	<-b.done
+}
+
+func (b *EventBus) dispatch() {
+	defer close(b.done)
+
+	for e := range b.queue {
+		for _, s := range b.subscribers() {
+			if s.matches(e) {
+				s.deliver(e)
+			}
+		}
+	}
+
+	for _, s := range b.subscribers() {
+		s.Close()
+	}
+}
+
+func (b *EventBus) subscribers() []*Subscription {
+	b.subsMu.Lock()
+	defer b.subsMu.Unlock()
+
+	subs := make([]*Subscription, 0, len(b.subscriptions))
+	for s := range b.subscriptions {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+func (b *EventBus) unsubscribe(s *Subscription) {
+	b.subsMu.Lock()
+	defer b.subsMu.Unlock()
+	delete(b.subscriptions, s)
+}
+
+// A Subscription receives the events published on an EventBus
+// matching its project and types.
+type Subscription struct {
+	bus *EventBus
+
+	projectUUID uuid.UUID
+	types       []EventType
+	// live subscriptions are closed rather than waited for
+	live bool
+
+	// mu is held while sending to ch, so that ch is never closed
+	// during a send.
+	mu        sync.Mutex
+	ch        chan Event
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the channel on which events are received. It is
+// closed when the subscription or the bus is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Close the subscription. It is safe to call it several times,
+// concurrently with deliveries.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		// Unblocks a delivery waiting for the subscriber
+		close(s.closed)
+		s.bus.unsubscribe(s)
+
+		s.mu.Lock()
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+func (s *Subscription) matches(e Event) bool {
+	if s.projectUUID != uuid.Nil && s.projectUUID != e.ProjectUUID {
+		return false
+	}
+
+	if len(s.types) == 0 {
+		return true
+	}
+	for _, t := range s.types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) deliver(e Event) {
+	if !s.send(e) {
+		s.Close()
+	}
+}
+
+// send e to the subscriber, waiting for room in its buffer unless the
+// subscription is live. It returns false if a live subscriber had no
+// room left.
+func (s *Subscription) send(e Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.closed:
+		return true
+	default:
+	}
+
+	if s.live {
+		select {
+		case s.ch <- e:
+			return true
+		default:
+			return false
+		}
+	}
+
+	select {
+	case s.ch <- e:
+	case <-s.closed:
+	}
+	return true
+}
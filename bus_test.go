@@ -0,0 +1,100 @@
+package tonight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventBus(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	otherProjectUUID := uuid.NewV1()
+
+	bus := NewEventBus(10)
+	all := bus.Subscribe(uuid.Nil)
+	project := bus.Subscribe(projectUUID)
+	done := bus.Subscribe(projectUUID, TaskDone)
+
+	events := []Event{
+		{UUID: uuid.NewV1(), Type: TaskCreate, ProjectUUID: projectUUID},
+		{UUID: uuid.NewV1(), Type: TaskDone, ProjectUUID: otherProjectUUID},
+		{UUID: uuid.NewV1(), Type: TaskDone, ProjectUUID: projectUUID},
+	}
+	for _, e := range events {
+		require.NoError(t, bus.Publish(ctx, e))
+	}
+	bus.Close()
+
+	received := func(s *Subscription) []uuid.UUID {
+		uuids := make([]uuid.UUID, 0)
+		for e := range s.Events() {
+			uuids = append(uuids, e.UUID)
+		}
+		return uuids
+	}
+	require.Equal(t, []uuid.UUID{events[0].UUID, events[1].UUID, events[2].UUID}, received(all))
+	require.Equal(t, []uuid.UUID{events[0].UUID, events[2].UUID}, received(project))
+	require.Equal(t, []uuid.UUID{events[2].UUID}, received(done))
+
+	require.Equal(t, ErrEventBusClosed, bus.Publish(ctx, events[0]))
+	_, open := <-bus.Subscribe(uuid.Nil).Events()
+	require.False(t, open)
+}
+
+func TestEventBusBackpressure(t *testing.T) {
+	ctx := context.Background()
+	bus := NewEventBus(1)
+	s := bus.Subscribe(uuid.Nil)
+
+	// One event in the subscription buffer, one held by the dispatcher
+	// and one in the bus buffer: the next publish has to wait.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, bus.Publish(ctx, Event{UUID: uuid.NewV1()}))
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, bus.Publish(timeoutCtx, Event{UUID: uuid.NewV1()}))
+
+	// Reading unblocks the publishers
+	<-s.Events()
+	require.NoError(t, bus.Publish(ctx, Event{UUID: uuid.NewV1()}))
+
+	// Closing a subscription does not block the bus anymore, even with
+	// undelivered events.
+	s.Close()
+	closed := make(chan struct{})
+	go func() {
+		bus.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bus not closed")
+	}
+}
+
+func TestEventBusLive(t *testing.T) {
+	ctx := context.Background()
+	bus := NewEventBus(1)
+	live := bus.SubscribeLive(uuid.Nil)
+
+	// The live subscriber does not read, the publishers do not wait for
+	// it: its subscription is closed once its buffer is full
+	for i := 0; i < 5; i++ {
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+		require.NoError(t, bus.Publish(timeoutCtx, Event{UUID: uuid.NewV1()}))
+		cancel()
+	}
+	bus.Close()
+
+	received := 0
+	for range live.Events() {
+		received++
+	}
+	require.Equal(t, 1, received)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+// events exports the events table as newline-delimited JSON, or
+// imports such an export. Events are exported as stored, without
+// upcasting their payloads, so that an import reproduces them exactly.
+func events(ctx context.Context, st storage, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: events export|import [flags]")
+	}
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "export":
+		return exportEvents(ctx, st, args)
+	case "import":
+		return importEvents(ctx, st, args)
+	default:
+		return fmt.Errorf("unknown events command %s", cmd)
+	}
+}
+
+func exportEvents(ctx context.Context, st storage, args []string) error {
+	flags := flag.NewFlagSet("events export", flag.ExitOnError)
+	project := flags.String("project", "", "only export the events of this project")
+	output := flags.String("o", "", "file to write to, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var filter tonight.EventFilter
+	if *project != "" {
+		projectUUID, err := uuid.FromString(*project)
+		if err != nil {
+			return fmt.Errorf("invalid project: %w", err)
+		}
+		filter.ProjectUUID = projectUUID
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	buf := bufio.NewWriter(w)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan tonight.Event)
+	errc := make(chan error, 1)
+	go func() { errc <- st.eventStore.List(ctx, filter, ch) }()
+
+	// json.Encoder ends every value with a newline
+	enc := json.NewEncoder(buf)
+	count := 0
+	var err error
+	for e := range ch {
+		if err != nil {
+			continue
+		}
+		if err = enc.Encode(e); err != nil {
+			cancel()
+			continue
+		}
+		count++
+	}
+	if listErr := <-errc; err == nil {
+		err = listErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	log.Printf("exported %d event(s)", count)
+	return nil
+}
+
+// importEvents stores the events read, skipping those already stored,
+// so that an import can safely be run again. The projections are then
+// rebuilt from the whole events table, and the snapshots cleared.
+func importEvents(ctx context.Context, st storage, args []string) error {
+	flags := flag.NewFlagSet("events import", flag.ExitOnError)
+	input := flags.String("i", "", "file to read from, stdin by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	eventStore := st.eventStore
+	dec := json.NewDecoder(bufio.NewReader(r))
+	imported, skipped := 0, 0
+	for {
+		var e tonight.Event
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding event %d: %w", imported+skipped+1, err)
+		}
+
+		err = eventStore.Store(ctx, e)
+		if errors.Is(err, tonight.ErrDuplicateEvent) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error storing event %s: %w", e.UUID, err)
+		}
+		imported++
+	}
+	log.Printf("imported %d event(s), skipped %d already stored", imported, skipped)
+
+	// Imported events may predate existing snapshots
+	if imported > 0 {
+		if err := st.snapshotStore.Clear(ctx); err != nil {
+			return fmt.Errorf("error clearing snapshots: %w", err)
+		}
+	}
+
+	return replay(ctx, st, nil)
+}
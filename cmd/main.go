@@ -2,70 +2,128 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	_ "github.com/go-sql-driver/mysql"
 
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
+	uuid "github.com/satori/go.uuid"
 
 	"github.com/bobinette/tonight"
-	"github.com/bobinette/tonight/mysql"
 )
 
+type config struct {
+	Web struct {
+		Bind string `toml:"bind"`
+	} `toml:"web"`
+
+	Storage struct {
+		// Driver is mysql, the default, sqlite or postgres
+		Driver string `toml:"driver"`
+		// AutoMigrate applies the pending migrations on start instead
+		// of refusing to start
+		AutoMigrate bool `toml:"autoMigrate"`
+	} `toml:"storage"`
+
+	MySQL struct {
+		User     string `toml:"user"`
+		Password string `toml:"password"`
+		Host     string `toml:"host"`
+		Port     string `toml:"port"`
+		Database string `toml:"database"`
+	} `toml:"mysql"`
+
+	Postgres struct {
+		User     string `toml:"user"`
+		Password string `toml:"password"`
+		Host     string `toml:"host"`
+		Port     string `toml:"port"`
+		Database string `toml:"database"`
+		// SSLMode is disable, require, verify-ca or verify-full
+		SSLMode string `toml:"sslmode"`
+	} `toml:"postgres"`
+
+	SQLite struct {
+		Path string `toml:"path"`
+	} `toml:"sqlite"`
+
+	Snapshots struct {
+		// Interval is a duration, "1h" for instance
+		Interval string `toml:"interval"`
+		Every    int    `toml:"every"`
+	} `toml:"snapshots"`
+
+	Trash struct {
+		// Retention is how long the deleted entities stay in the trash
+		// before being purged, a duration
+		Retention string `toml:"retention"`
+		// Interval is a duration, "1h" for instance
+		Interval string `toml:"interval"`
+	} `toml:"trash"`
+
+	FrontEnd struct {
+		Mode     string `toml:"mode"`
+		ProxyURL string `toml:"proxyUrl"`
+		Dir      string `toml:"dir"`
+	} `toml:"front-end"`
+}
+
 func main() {
 	// Load configuration
-	var cfg struct {
-		Web struct {
-			Bind string `toml:"bind"`
-		} `toml:"web"`
-
-		MySQL struct {
-			User     string `toml:"user"`
-			Password string `toml:"password"`
-			Host     string `toml:"host"`
-			Port     string `toml:"port"`
-			Database string `toml:"database"`
-		} `toml:"mysql"`
-
-		FrontEnd struct {
-			Mode     string `toml:"mode"`
-			ProxyURL string `toml:"proxyUrl"`
-			Dir      string `toml:"dir"`
-		} `toml:"front-end"`
-	}
-
+	var cfg config
 	if _, err := toml.DecodeFile("config.toml", &cfg); err != nil {
 		log.Fatal(err)
 	}
 	// Load configuration -- end
 
-	// MySQL and stores
-	db, err := sql.Open("mysql", fmt.Sprintf(
-		"%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local&timeout=1s",
-		cfg.MySQL.User,
-		cfg.MySQL.Password,
-		cfg.MySQL.Host,
-		cfg.MySQL.Port,
-		cfg.MySQL.Database,
-	))
+	// Database and stores
+	ctx := context.Background()
+	st, err := openStorage(ctx, cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer st.db.Close()
+	// Database and stores -- end
 
-	ctx := context.Background()
-	if err := db.PingContext(ctx); err != nil {
+	if len(os.Args) > 1 {
+		var err error
+		switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+		case "replay":
+			err = replay(ctx, st, args)
+		case "events":
+			err = events(ctx, st, args)
+		case "snapshots":
+			err = snapshots(ctx, st, args)
+		case "migrate":
+			err = migrations(ctx, st, args)
+		case "purge":
+			err = purge(ctx, cfg, st, args)
+		default:
+			err = fmt.Errorf("unknown command %s", cmd)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := checkMigrations(ctx, cfg, st); err != nil {
 		log.Fatal(err)
 	}
-	// MySQL and stores -- end
+	serve(cfg, st)
+}
 
+func serve(cfg config, st storage) {
 	// HTTP server via echo
 	srv := echo.New()
 	srv.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
@@ -78,30 +136,62 @@ func main() {
 	}))
 
 	echo.NotFoundHandler = func(c echo.Context) error {
-		return fmt.Errorf("route %s (method %s) not found", c.Request().URL, c.Request().Method)
+		return fmt.Errorf("route %s (method %s): %w", c.Request().URL, c.Request().Method, tonight.ErrNotFound)
 	}
 
-	srv.HTTPErrorHandler = echo.HTTPErrorHandler(func(err error, c echo.Context) {
-		c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": err.Error(),
-		})
-	})
+	srv.HTTPErrorHandler = tonight.HTTPErrorHandler
 	// HTTP server via echo -- env
 
 	// Register and start
-	eventStore := mysql.NewEventStore(db)
-	taskStore := mysql.NewTaskStore(db)
-	projectStore := mysql.NewProjectStore(db)
-	releaseStore := mysql.NewReleaseStore(db)
-	userStore := mysql.NewUserStore(db)
+	bus := tonight.NewEventBus(100)
+	eventStore := tonight.NewSchemaEventStore(st.eventStore)
 	tonight.RegisterHTTP(
 		srv.Group("/api"),
+		bus,
+		st.transactor,
 		eventStore,
-		taskStore,
-		projectStore,
-		releaseStore,
-		userStore,
+		st.snapshotStore,
+		st.taskStore,
+		st.projectStore,
+		st.releaseStore,
+		st.userStore,
+		st.webhookStore,
+		st.trashStore,
+	)
+
+	snapshotInterval, err := snapshotInterval(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	snapshotter := tonight.NewSnapshotter(eventStore, st.snapshotStore, snapshotInterval, snapshotEvery(cfg))
+	snapshotterDone := make(chan struct{})
+	go func() {
+		snapshotter.Run(context.Background(), bus.Subscribe(uuid.Nil))
+		close(snapshotterDone)
+	}()
+
+	dispatcher := tonight.NewWebhookDispatcher(
+		st.webhookStore,
+		&http.Client{Timeout: 10 * time.Second},
+		30*time.Second,
+		8,
 	)
+	dispatcherDone := make(chan struct{})
+	go func() {
+		dispatcher.Run(context.Background(), bus.Subscribe(uuid.Nil))
+		close(dispatcherDone)
+	}()
+
+	purger, err := newPurger(cfg, st, eventStore, bus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	purgerCtx, stopPurger := context.WithCancel(context.Background())
+	purgerDone := make(chan struct{})
+	go func() {
+		purger.Run(purgerCtx)
+		close(purgerDone)
+	}()
 
 	// @TODO: not prod ready. Use the config to determine what should be used
 	if cfg.FrontEnd.Mode == "proxy" {
@@ -124,7 +214,49 @@ func main() {
 		srv.Static("/", cfg.FrontEnd.Dir)
 	}
 
-	if err := srv.Start(cfg.Web.Bind); err != nil {
-		log.Fatal(err)
+	go func() {
+		if err := srv.Start(cfg.Web.Bind); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Stop accepting requests first, so that nothing is published
+	// after the bus is closed
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println(err)
+	}
+	stopPurger()
+	<-purgerDone
+	bus.Close()
+	<-snapshotterDone
+	<-dispatcherDone
+}
+
+// snapshotInterval returns the interval between two snapshots of a
+// project with new events, every hour by default. "0s" disables them.
+func snapshotInterval(cfg config) (time.Duration, error) {
+	if cfg.Snapshots.Interval == "" {
+		return time.Hour, nil
+	}
+
+	interval, err := time.ParseDuration(cfg.Snapshots.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshots interval: %w", err)
+	}
+	return interval, nil
+}
+
+// snapshotEvery returns the number of new events after which a project
+// is snapshot, 500 by default. A negative value disables it.
+func snapshotEvery(cfg config) int {
+	if cfg.Snapshots.Every == 0 {
+		return 500
 	}
+	return cfg.Snapshots.Every
 }
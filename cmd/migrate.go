@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migrations applies or reverts the migrations of the storage driver,
+// or lists them.
+func migrations(ctx context.Context, st storage, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down|status|redo [flags]")
+	}
+
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet("migrate "+cmd, flag.ExitOnError)
+	var n *int
+	switch cmd {
+	case "up":
+		n = flags.Int("n", 0, "number of migrations to apply, all of them by default")
+	case "down":
+		n = flags.Int("n", 1, "number of migrations to revert")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "up":
+		migrations, err := st.migrator.Up(ctx, *n)
+		for _, migration := range migrations {
+			fmt.Printf("applied %s\n", migration)
+		}
+		return err
+
+	case "down":
+		migrations, err := st.migrator.Down(ctx, *n)
+		for _, migration := range migrations {
+			fmt.Printf("reverted %s\n", migration)
+		}
+		return err
+
+	case "redo":
+		migration, err := st.migrator.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("redid %s\n", migration)
+
+	case "status":
+		statuses, err := st.migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			switch {
+			case !s.Applied:
+				fmt.Printf("pending              %s\n", s.Migration)
+			case s.Up == nil && s.Down == nil:
+				fmt.Printf("%s  %s (file not found)\n", s.AppliedAt.Local().Format(time.RFC3339), s.Migration)
+			default:
+				fmt.Printf("%s  %s\n", s.AppliedAt.Local().Format(time.RFC3339), s.Migration)
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown migrate command %s", cmd)
+	}
+
+	return nil
+}
+
+// checkMigrations refuses to serve a database with pending migrations,
+// unless the configuration allows to apply them on start.
+func checkMigrations(ctx context.Context, cfg config, st storage) error {
+	pending, err := st.migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if !cfg.Storage.AutoMigrate {
+		return fmt.Errorf(
+			"%d pending migration(s), starting with %s: run the migrate up command or set autoMigrate in the storage configuration",
+			len(pending),
+			pending[0],
+		)
+	}
+
+	migrations, err := st.migrator.Up(ctx, 0)
+	for _, migration := range migrations {
+		log.Printf("applied migration %s", migration)
+	}
+	return err
+}
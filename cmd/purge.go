@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/bobinette/tonight"
+)
+
+// purge deletes for good the entities that have been in the trash for
+// longer than the retention, once.
+func purge(ctx context.Context, cfg config, st storage, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	purger, err := newPurger(cfg, st, tonight.NewSchemaEventStore(st.eventStore), nil)
+	if err != nil {
+		return err
+	}
+
+	purged, err := purger.Purge(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d entities\n", purged)
+	return nil
+}
+
+// newPurger returns the purger of the trash. The entities stay 30 days
+// in the trash and are purged every hour by default. An interval of
+// "0s" disables the purge while serving.
+func newPurger(cfg config, st storage, eventStore tonight.EventStore, bus *tonight.EventBus) (*tonight.Purger, error) {
+	retention := 30 * 24 * time.Hour
+	if cfg.Trash.Retention != "" {
+		d, err := time.ParseDuration(cfg.Trash.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trash retention: %w", err)
+		}
+		retention = d
+	}
+
+	interval := time.Hour
+	if cfg.Trash.Interval != "" {
+		d, err := time.ParseDuration(cfg.Trash.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trash interval: %w", err)
+		}
+		interval = d
+	}
+
+	return tonight.NewPurger(st.transactor, eventStore, st.trashStore, bus, retention, interval), nil
+}
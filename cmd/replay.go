@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/bobinette/tonight"
+)
+
+// replay rebuilds the projects, releases, tasks and permissions from
+// the events table. With -dry-run, the tables are left untouched and
+// the differences between the replayed state and the live tables are
+// printed instead. The events that cannot be replayed are reported and
+// skipped.
+func replay(ctx context.Context, st storage, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only report the differences with the live tables")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	eventStore := tonight.NewSchemaEventStore(st.eventStore)
+	projectionStore := st.projectionStore
+
+	// The live tables fill what the oldest events lack
+	live, err := projectionStore.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("error loading live tables: %w", err)
+	}
+
+	replayed, skipped, err := tonight.Replay(ctx, eventStore, tonight.EventFilter{}, live)
+	if err != nil {
+		return fmt.Errorf("error replaying events: %w", err)
+	}
+	for _, s := range skipped {
+		fmt.Printf("skipped %s event %s: %v\n", s.Event.Type, s.Event.UUID, s.Err)
+	}
+	if len(skipped) > 0 {
+		fmt.Printf("%d event(s) skipped\n", len(skipped))
+	}
+
+	if *dryRun {
+		// First projection is the replayed one, second the live one
+		diffs := replayed.Diff(live)
+		for _, diff := range diffs {
+			fmt.Println(diff)
+		}
+		fmt.Printf("%d difference(s) between the replayed state and the live tables\n", len(diffs))
+		return nil
+	}
+
+	if err := projectionStore.Reset(ctx, replayed); err != nil {
+		return fmt.Errorf("error resetting tables: %w", err)
+	}
+
+	fmt.Printf(
+		"replayed %d project(s), %d release(s) and %d task(s)\n",
+		len(replayed.Projects),
+		len(replayed.Releases),
+		len(replayed.Tasks),
+	)
+	return nil
+}
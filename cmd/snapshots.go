@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+// snapshots takes snapshots of the projects, or verifies that their
+// latest snapshot plus the events after it give the same state as the
+// full replay of their events.
+func snapshots(ctx context.Context, st storage, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: snapshots take|verify [flags]")
+	}
+
+	cmd, args := args[0], args[1:]
+	flags := flag.NewFlagSet("snapshots "+cmd, flag.ExitOnError)
+	project := flags.String("project", "", "only this project, all of them by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	eventStore := tonight.NewSchemaEventStore(st.eventStore)
+	snapshotStore := st.snapshotStore
+
+	projectUUIDs, err := snapshotProjects(ctx, st, *project)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "take":
+		snapshotter := tonight.NewSnapshotter(eventStore, snapshotStore, 0, 0)
+		taken := 0
+		for _, projectUUID := range projectUUIDs {
+			ok, err := snapshotter.Snapshot(ctx, projectUUID)
+			if err != nil {
+				return fmt.Errorf("error taking snapshot of project %s: %w", projectUUID, err)
+			}
+			if ok {
+				taken++
+			}
+		}
+		fmt.Printf("took %d snapshot(s) of %d project(s)\n", taken, len(projectUUIDs))
+
+	case "verify":
+		count := 0
+		for _, projectUUID := range projectUUIDs {
+			diffs, err := tonight.VerifySnapshot(ctx, eventStore, snapshotStore, projectUUID)
+			if err != nil {
+				return fmt.Errorf("error verifying project %s: %w", projectUUID, err)
+			}
+
+			// First projection is the snapshot one, second the full replay
+			for _, diff := range diffs {
+				fmt.Printf("project %s: %s\n", projectUUID, diff)
+			}
+			count += len(diffs)
+		}
+		fmt.Printf("%d difference(s) between the snapshots and the full replays\n", count)
+
+	default:
+		return fmt.Errorf("unknown snapshots command %s", cmd)
+	}
+
+	return nil
+}
+
+func snapshotProjects(ctx context.Context, st storage, project string) ([]uuid.UUID, error) {
+	if project != "" {
+		projectUUID, err := uuid.FromString(project)
+		if err != nil {
+			return nil, fmt.Errorf("invalid project: %w", err)
+		}
+		return []uuid.UUID{projectUUID}, nil
+	}
+
+	live, err := st.projectionStore.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading projects: %w", err)
+	}
+
+	projectUUIDs := make([]uuid.UUID, 0, len(live.Projects))
+	for projectUUID := range live.Projects {
+		projectUUIDs = append(projectUUIDs, projectUUID)
+	}
+	return projectUUIDs, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bobinette/tonight"
+	"github.com/bobinette/tonight/migrate"
+	"github.com/bobinette/tonight/mysql"
+	"github.com/bobinette/tonight/postgres"
+	"github.com/bobinette/tonight/sqlite"
+)
+
+// storage gathers the stores of the backend chosen in the
+// configuration. The event store is the raw one, its payloads are not
+// upcast.
+type storage struct {
+	db *sql.DB
+
+	transactor      tonight.Transactor
+	eventStore      tonight.EventStore
+	snapshotStore   tonight.SnapshotStore
+	taskStore       tonight.TaskStore
+	projectStore    tonight.ProjectStore
+	releaseStore    tonight.ReleaseStore
+	userStore       tonight.UserStore
+	webhookStore    tonight.WebhookStore
+	trashStore      tonight.TrashStore
+	projectionStore tonight.ProjectionStore
+	migrator        *migrate.Migrator
+}
+
+// openStorage connects to the database of the storage driver, mysql by
+// default.
+func openStorage(ctx context.Context, cfg config) (storage, error) {
+	var st storage
+	var newMigrator func(db *sql.DB) (*migrate.Migrator, error)
+	switch cfg.Storage.Driver {
+	case "", "mysql":
+		db, err := sql.Open("mysql", fmt.Sprintf(
+			"%s:%s@tcp(%s:%s)/%s?charset=utf8&parseTime=True&loc=Local&timeout=1s",
+			cfg.MySQL.User,
+			cfg.MySQL.Password,
+			cfg.MySQL.Host,
+			cfg.MySQL.Port,
+			cfg.MySQL.Database,
+		))
+		if err != nil {
+			return storage{}, err
+		}
+		st = storage{
+			db:              db,
+			transactor:      mysql.NewTransactor(db),
+			eventStore:      mysql.NewEventStore(db),
+			snapshotStore:   mysql.NewSnapshotStore(db),
+			taskStore:       mysql.NewTaskStore(db),
+			projectStore:    mysql.NewProjectStore(db),
+			releaseStore:    mysql.NewReleaseStore(db),
+			userStore:       mysql.NewUserStore(db),
+			webhookStore:    mysql.NewWebhookStore(db),
+			trashStore:      mysql.NewTrashStore(db),
+			projectionStore: mysql.NewProjectionStore(db),
+		}
+		newMigrator = mysql.NewMigrator
+
+	case "postgres":
+		sslMode := cfg.Postgres.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		db, err := sql.Open("postgres", fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s connect_timeout=1",
+			cfg.Postgres.Host,
+			cfg.Postgres.Port,
+			cfg.Postgres.User,
+			cfg.Postgres.Password,
+			cfg.Postgres.Database,
+			sslMode,
+		))
+		if err != nil {
+			return storage{}, err
+		}
+		st = storage{
+			db:              db,
+			transactor:      postgres.NewTransactor(db),
+			eventStore:      postgres.NewEventStore(db),
+			snapshotStore:   postgres.NewSnapshotStore(db),
+			taskStore:       postgres.NewTaskStore(db),
+			projectStore:    postgres.NewProjectStore(db),
+			releaseStore:    postgres.NewReleaseStore(db),
+			userStore:       postgres.NewUserStore(db),
+			webhookStore:    postgres.NewWebhookStore(db),
+			trashStore:      postgres.NewTrashStore(db),
+			projectionStore: postgres.NewProjectionStore(db),
+		}
+		newMigrator = postgres.NewMigrator
+
+	case "sqlite":
+		path := cfg.SQLite.Path
+		if path == "" {
+			path = "tonight.db"
+		}
+		db, err := sqlite.Open(path)
+		if err != nil {
+			return storage{}, err
+		}
+		st = storage{
+			db:              db,
+			transactor:      sqlite.NewTransactor(db),
+			eventStore:      sqlite.NewEventStore(db),
+			snapshotStore:   sqlite.NewSnapshotStore(db),
+			taskStore:       sqlite.NewTaskStore(db),
+			projectStore:    sqlite.NewProjectStore(db),
+			releaseStore:    sqlite.NewReleaseStore(db),
+			userStore:       sqlite.NewUserStore(db),
+			webhookStore:    sqlite.NewWebhookStore(db),
+			trashStore:      sqlite.NewTrashStore(db),
+			projectionStore: sqlite.NewProjectionStore(db),
+		}
+		newMigrator = sqlite.NewMigrator
+
+	default:
+		return storage{}, fmt.Errorf("unknown storage driver %s", cfg.Storage.Driver)
+	}
+
+	migrator, err := newMigrator(st.db)
+	if err != nil {
+		st.db.Close()
+		return storage{}, err
+	}
+	st.migrator = migrator
+
+	if err := st.db.PingContext(ctx); err != nil {
+		st.db.Close()
+		return storage{}, err
+	}
+	return st, nil
+}
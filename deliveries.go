@@ -0,0 +1,302 @@
+package tonight
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Headers of the webhook deliveries
+const (
+	WebhookSignatureHeader = "X-Tonight-Signature"
+	WebhookEventHeader     = "X-Tonight-Event"
+	WebhookDeliveryHeader  = "X-Tonight-Delivery"
+)
+
+// SignWebhookPayload returns the signature of a delivery body, sent in
+// the WebhookSignatureHeader: "sha256=" followed by the hex encoded
+// HMAC-SHA256 of the body keyed with the webhook secret.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookWorkers is the number of webhooks a WebhookDispatcher delivers
+// to at the same time.
+const webhookWorkers = 8
+
+// A WebhookDispatcher delivers the events received from the bus to the
+// webhooks of their project. The deliveries go through the queue of the
+// WebhookStore, and failed ones are attempted again after an
+// exponential backoff: 1, 2, 4... times backoff, maxAttempts times at
+// most. The events are queued as they are received from the bus: the
+// ones published but not queued yet when the server stops are not
+// delivered.
+type WebhookDispatcher struct {
+	store  WebhookStore
+	client *http.Client
+
+	backoff     time.Duration
+	maxAttempts int
+	workers     int
+
+	now  func() time.Time
+	wake chan struct{}
+}
+
+func NewWebhookDispatcher(store WebhookStore, client *http.Client, backoff time.Duration, maxAttempts int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:       store,
+		client:      client,
+		backoff:     backoff,
+		maxAttempts: maxAttempts,
+		workers:     webhookWorkers,
+		now:         time.Now,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Run queues the deliveries of the events of sub, and attempts the
+// queued deliveries as they become due, until sub is closed or ctx is
+// done. Errors are logged: they are retried at the next opportunity.
+func (d *WebhookDispatcher) Run(ctx context.Context, sub *Subscription) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.deliverQueued(ctx)
+	}()
+	defer wg.Wait()
+
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := d.queue(ctx, e); err != nil {
+				log.Printf("error queuing deliveries of event %s: %v", e.UUID, err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// queue the deliveries of e to the webhooks matching it
+func (d *WebhookDispatcher) queue(ctx context.Context, e Event) error {
+	if e.ProjectUUID == uuid.Nil {
+		return nil
+	}
+
+	webhooks, err := d.store.List(ctx, e.ProjectUUID)
+	if err != nil {
+		return err
+	}
+
+	queued := false
+	for _, w := range webhooks {
+		if !w.matches(e) {
+			continue
+		}
+
+		err := d.store.Enqueue(ctx, QueuedDelivery{
+			UUID:          uuid.NewV1(),
+			WebhookUUID:   w.UUID,
+			Event:         e,
+			Attempt:       1,
+			NextAttemptAt: d.now(),
+		})
+		if err != nil {
+			return err
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) deliverQueued(ctx context.Context) {
+	// Poll often enough for the first retries not to be late
+	ticker := time.NewTicker(d.backoff / 2)
+	defer ticker.Stop()
+
+	for {
+		if err := d.DeliverDue(ctx); err != nil {
+			log.Printf("error delivering webhooks: %v", err)
+		}
+
+		select {
+		case <-d.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// DeliverDue attempts the queued deliveries that are due. The webhooks
+// are delivered to concurrently, each one its deliveries in order. A
+// webhook failing a delivery gets no other attempt until the next call,
+// so that a slow or unreachable endpoint does not hold up the others.
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) error {
+	for {
+		due, err := d.store.Due(ctx, d.now(), 100)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		complete, err := d.deliverRound(ctx, due)
+		if err != nil || !complete {
+			return err
+		}
+	}
+}
+
+// deliverRound attempts due, grouped by webhook, with d.workers
+// webhooks at most at the same time. It returns whether every delivery
+// was attempted.
+func (d *WebhookDispatcher) deliverRound(ctx context.Context, due []QueuedDelivery) (bool, error) {
+	webhooks := make([]uuid.UUID, 0)
+	deliveries := make(map[uuid.UUID][]QueuedDelivery)
+	for _, queued := range due {
+		if _, ok := deliveries[queued.WebhookUUID]; !ok {
+			webhooks = append(webhooks, queued.WebhookUUID)
+		}
+		deliveries[queued.WebhookUUID] = append(deliveries[queued.WebhookUUID], queued)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		complete = true
+		firstErr error
+	)
+	workers := make(chan struct{}, d.workers)
+	for _, id := range webhooks {
+		queue := deliveries[id]
+
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			for i, queued := range queue {
+				delivered, err := d.attempt(ctx, queued)
+				if err == nil && delivered {
+					continue
+				}
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				if i < len(queue)-1 {
+					complete = false
+				}
+				mu.Unlock()
+				return
+			}
+		}()
+	}
+	wg.Wait()
+
+	return complete, firstErr
+}
+
+// attempt a queued delivery, logging it, and dequeue it if it
+// succeeded or if it was the last attempt. Otherwise it is scheduled
+// again. It returns whether the delivery succeeded, the returned error
+// is about the store, not the delivery.
+func (d *WebhookDispatcher) attempt(ctx context.Context, queued QueuedDelivery) (bool, error) {
+	w, err := d.store.Get(ctx, queued.WebhookUUID)
+	if err != nil {
+		return false, fmt.Errorf("error retrieving webhook %s: %w", queued.WebhookUUID, err)
+	}
+
+	statusCode, deliveryErr := d.post(ctx, w, queued)
+	delivery := WebhookDelivery{
+		UUID:        uuid.NewV1(),
+		WebhookUUID: w.UUID,
+		EventUUID:   queued.Event.UUID,
+		EventType:   queued.Event.Type,
+		Attempt:     queued.Attempt,
+		StatusCode:  statusCode,
+		CreatedAt:   d.now(),
+	}
+	if deliveryErr != nil {
+		delivery.Error = deliveryErr.Error()
+	}
+	if err := d.store.LogDelivery(ctx, delivery); err != nil {
+		return false, err
+	}
+
+	if deliveryErr == nil || queued.Attempt >= d.maxAttempts {
+		return deliveryErr == nil, d.store.Dequeue(ctx, queued.UUID)
+	}
+
+	queued.NextAttemptAt = d.now().Add(d.backoff << uint(queued.Attempt-1))
+	queued.Attempt++
+	return false, d.store.Enqueue(ctx, queued)
+}
+
+// post the event of queued to w, returning the status code of the
+// response if any.
+func (d *WebhookDispatcher) post(ctx context.Context, w Webhook, queued QueuedDelivery) (int, error) {
+	body, err := json.Marshal(queued.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(w.Secret, body))
+	req.Header.Set(WebhookEventHeader, string(queued.Event.Type))
+	req.Header.Set(WebhookDeliveryHeader, queued.UUID.String())
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Read the body for the connection to be reused
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
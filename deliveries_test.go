@@ -0,0 +1,261 @@
+package tonight
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// mapWebhookStore keeps everything in maps, guarded by a mutex.
+type mapWebhookStore struct {
+	mu         sync.Mutex
+	webhooks   map[uuid.UUID]Webhook
+	deliveries []WebhookDelivery
+	queue      map[uuid.UUID]QueuedDelivery
+}
+
+func newMapWebhookStore() *mapWebhookStore {
+	return &mapWebhookStore{
+		webhooks: make(map[uuid.UUID]Webhook),
+		queue:    make(map[uuid.UUID]QueuedDelivery),
+	}
+}
+
+func (s *mapWebhookStore) Upsert(ctx context.Context, w Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[w.UUID] = w
+	return nil
+}
+
+func (s *mapWebhookStore) Get(ctx context.Context, id uuid.UUID) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.webhooks[id], nil
+}
+
+func (s *mapWebhookStore) List(ctx context.Context, projectUUID uuid.UUID) ([]Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhooks := make([]Webhook, 0)
+	for _, w := range s.webhooks {
+		if w.ProjectUUID == projectUUID {
+			webhooks = append(webhooks, w)
+		}
+	}
+	return webhooks, nil
+}
+
+func (s *mapWebhookStore) Delete(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.webhooks, id)
+	return nil
+}
+
+func (s *mapWebhookStore) LogDelivery(ctx context.Context, d WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = append(s.deliveries, d)
+	return nil
+}
+
+func (s *mapWebhookStore) Deliveries(ctx context.Context, webhookUUID uuid.UUID, limit int) ([]WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deliveries := make([]WebhookDelivery, 0)
+	for i := len(s.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if s.deliveries[i].WebhookUUID == webhookUUID {
+			deliveries = append(deliveries, s.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (s *mapWebhookStore) Enqueue(ctx context.Context, d QueuedDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue[d.UUID] = d
+	return nil
+}
+
+func (s *mapWebhookStore) Due(ctx context.Context, now time.Time, limit int) ([]QueuedDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := make([]QueuedDelivery, 0)
+	for _, d := range s.queue {
+		if !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *mapWebhookStore) Dequeue(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queue, id)
+	return nil
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+
+	type received struct {
+		signature string
+		eventType string
+		body      []byte
+	}
+	var mu sync.Mutex
+	fail := true
+	requests := make([]received, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, received{
+			signature: r.Header.Get(WebhookSignatureHeader),
+			eventType: r.Header.Get(WebhookEventHeader),
+			body:      body,
+		})
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	store := newMapWebhookStore()
+	webhook := Webhook{
+		UUID:        uuid.NewV1(),
+		ProjectUUID: projectUUID,
+		URL:         srv.URL,
+		Secret:      "secret",
+		Types:       []EventType{TaskDone},
+	}
+	require.NoError(t, store.Upsert(ctx, webhook))
+
+	now := time.Now()
+	dispatcher := NewWebhookDispatcher(store, srv.Client(), time.Minute, 2)
+	dispatcher.now = func() time.Time { return now }
+
+	done := Event{UUID: uuid.NewV1(), Type: TaskDone, ProjectUUID: projectUUID, Payload: []byte(`{}`)}
+	events := []Event{
+		{UUID: uuid.NewV1(), Type: TaskCreate, ProjectUUID: projectUUID, Payload: []byte(`{}`)},
+		{UUID: uuid.NewV1(), Type: TaskDone, ProjectUUID: uuid.NewV1(), Payload: []byte(`{}`)},
+		done,
+	}
+	for _, e := range events {
+		require.NoError(t, dispatcher.queue(ctx, e))
+	}
+
+	// The first attempt fails, the delivery is scheduled again
+	require.NoError(t, dispatcher.DeliverDue(ctx))
+	require.Len(t, requests, 1)
+	require.Equal(t, string(TaskDone), requests[0].eventType)
+	require.Equal(t, SignWebhookPayload("secret", requests[0].body), requests[0].signature)
+	require.JSONEq(t, string(mustMarshal(t, done)), string(requests[0].body))
+
+	require.Len(t, store.queue, 1)
+	for _, queued := range store.queue {
+		require.Equal(t, 2, queued.Attempt)
+		require.Equal(t, now.Add(time.Minute), queued.NextAttemptAt)
+	}
+
+	// Not due yet
+	require.NoError(t, dispatcher.DeliverDue(ctx))
+	require.Len(t, requests, 1)
+
+	// Due and successful
+	fail = false
+	now = now.Add(time.Minute)
+	require.NoError(t, dispatcher.DeliverDue(ctx))
+	require.Len(t, requests, 2)
+	require.Empty(t, store.queue)
+
+	deliveries, err := store.Deliveries(ctx, webhook.UUID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, 2, deliveries[0].Attempt)
+	require.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	require.Empty(t, deliveries[0].Error)
+	require.Equal(t, 1, deliveries[1].Attempt)
+	require.Equal(t, http.StatusServiceUnavailable, deliveries[1].StatusCode)
+	require.NotEmpty(t, deliveries[1].Error)
+
+	// Deliveries are given up after the last attempt
+	fail = true
+	require.NoError(t, dispatcher.queue(ctx, done))
+	require.NoError(t, dispatcher.DeliverDue(ctx))
+	now = now.Add(time.Minute)
+	require.NoError(t, dispatcher.DeliverDue(ctx))
+	require.Len(t, requests, 4)
+	require.Empty(t, store.queue)
+}
+
+func mustMarshal(t *testing.T, e Event) []byte {
+	b, err := e.MarshalJSON()
+	require.NoError(t, err)
+	return b
+}
+
+func TestWebhookDispatcherSlowEndpoint(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+
+	var fastDelivered int32
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fastDelivered, 1)
+	}))
+	defer fast.Close()
+
+	store := newMapWebhookStore()
+	for _, url := range []string{slow.URL, fast.URL} {
+		require.NoError(t, store.Upsert(ctx, Webhook{
+			UUID:        uuid.NewV1(),
+			ProjectUUID: projectUUID,
+			URL:         url,
+			Types:       []EventType{TaskDone},
+		}))
+	}
+
+	dispatcher := NewWebhookDispatcher(store, http.DefaultClient, time.Minute, 2)
+	for i := 0; i < 2; i++ {
+		e := Event{UUID: uuid.NewV1(), Type: TaskDone, ProjectUUID: projectUUID, Payload: []byte(`{}`)}
+		require.NoError(t, dispatcher.queue(ctx, e))
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- dispatcher.DeliverDue(ctx)
+	}()
+
+	// The fast endpoint is not held up by the slow one
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fastDelivered) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	close(release)
+	require.NoError(t, <-done)
+	require.Empty(t, store.queue)
+}
@@ -0,0 +1,132 @@
+package tonight
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// The errors of the service wrap one of these, or are a
+// ValidationError, for HTTPErrorHandler to tell what went wrong.
+var (
+	// ErrNotFound is returned when an entity does not exist, or when
+	// the user is not allowed to see it.
+	ErrNotFound = errors.New("not found")
+
+	// ErrForbidden is returned when the user is not allowed to do what
+	// they asked.
+	ErrForbidden = errors.New("insufficient permissions")
+
+	// ErrConflict is returned when a write conflicts with the stored
+	// data, for example ErrVersionConflict.
+	ErrConflict = errors.New("conflict")
+)
+
+// A ValidationError is returned when the input of a request is
+// invalid. Fields maps the invalid fields, as named in the request, to
+// what is wrong with them.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = fmt.Sprintf("%s %s", field, e.Fields[field])
+	}
+	return strings.Join(messages, ", ")
+}
+
+// invalid returns a ValidationError for field.
+func invalid(field, format string, args ...interface{}) error {
+	return &ValidationError{Fields: map[string]string{field: fmt.Sprintf(format, args...)}}
+}
+
+// invalidBody returns a ValidationError for a request body that could
+// not be decoded.
+func invalidBody(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return invalid(typeErr.Field, "should be a %s", typeErr.Value)
+	}
+	return invalid("body", "is invalid: %s", err)
+}
+
+// uuidParam returns the path parameter name, a uuid.
+func uuidParam(c echo.Context, name string) (uuid.UUID, error) {
+	id, err := uuid.FromString(c.Param(name))
+	if err != nil {
+		return uuid.Nil, invalid(name, "is not a valid uuid")
+	}
+	return id, nil
+}
+
+// Error codes, for the clients to tell the errors apart without
+// parsing their messages.
+const (
+	CodeNotFound   = "not_found"
+	CodeForbidden  = "forbidden"
+	CodeValidation = "validation_failed"
+	CodeConflict   = "conflict"
+	CodeInternal   = "internal"
+)
+
+// ErrorStatus returns the HTTP status and the error code of err.
+func ErrorStatus(err error) (int, string) {
+	var validationErr *ValidationError
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden, CodeForbidden
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity, CodeValidation
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict, CodeConflict
+	case errors.As(err, &httpErr):
+		// Raised by echo itself, e.g. for a method not allowed
+		code := strings.ToLower(strings.ReplaceAll(http.StatusText(httpErr.Code), " ", "_"))
+		return httpErr.Code, code
+	}
+	return http.StatusInternalServerError, CodeInternal
+}
+
+// HTTPErrorHandler responds to the requests that failed with err, with
+// the status and the code of the error.
+func HTTPErrorHandler(err error, c echo.Context) {
+	status, code := ErrorStatus(err)
+	body := map[string]interface{}{
+		"error": err.Error(),
+		"code":  code,
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		body["fields"] = validationErr.Fields
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		body["error"] = fmt.Sprint(httpErr.Message)
+	}
+
+	if c.Response().Committed {
+		return
+	}
+	if err := c.JSON(status, body); err != nil {
+		c.Logger().Error(err)
+	}
+}
@@ -0,0 +1,43 @@
+package tonight
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		status int
+		code   string
+	}{
+		"not found":        {err: fmt.Errorf("task: %w", ErrNotFound), status: http.StatusNotFound, code: CodeNotFound},
+		"forbidden":        {err: ErrForbidden, status: http.StatusForbidden, code: CodeForbidden},
+		"validation":       {err: fmt.Errorf("invalid payload: %w", invalid("title", "cannot be empty")), status: http.StatusUnprocessableEntity, code: CodeValidation},
+		"version conflict": {err: fmt.Errorf("task: %w", ErrVersionConflict), status: http.StatusConflict, code: CodeConflict},
+		"echo":             {err: echo.ErrMethodNotAllowed, status: http.StatusMethodNotAllowed, code: "method_not_allowed"},
+		"internal":         {err: errors.New("boom"), status: http.StatusInternalServerError, code: CodeInternal},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			status, code := ErrorStatus(test.err)
+			require.Equal(t, test.status, status)
+			require.Equal(t, test.code, code)
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := &ValidationError{Fields: map[string]string{"title": "cannot be empty", "status": "is unknown"}}
+	require.Equal(t, "status is unknown, title cannot be empty", err.Error())
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(invalidBody(errors.New("unexpected EOF")), &validationErr))
+	require.Equal(t, map[string]string{"body": "is invalid: unexpected EOF"}, validationErr.Fields)
+}
@@ -2,6 +2,8 @@ package tonight
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -11,15 +13,34 @@ type EventType string
 
 // Event types
 const (
-	TaskCreate EventType = "TaskCreate"
-	TaskUpdate EventType = "TaskUpdate"
-	TaskDone   EventType = "TaskDone"
+	TaskCreate  EventType = "TaskCreate"
+	TaskUpdate  EventType = "TaskUpdate"
+	TaskDone    EventType = "TaskDone"
+	TaskMove    EventType = "TaskMove"
+	TaskDelete  EventType = "TaskDelete"
+	TaskRestore EventType = "TaskRestore"
+	TaskPurge   EventType = "TaskPurge"
+	// TaskMoveToRelease moves a task to another release of its
+	// project, TaskMove moves it within its release.
+	TaskMoveToRelease EventType = "TaskMoveToRelease"
 
-	ReleaseCreate EventType = "ReleaseCreate"
+	ReleaseCreate         EventType = "ReleaseCreate"
+	ReleaseRebalanceTasks EventType = "ReleaseRebalanceTasks"
+	ReleaseDelete         EventType = "ReleaseDelete"
+	ReleaseRestore        EventType = "ReleaseRestore"
+	ReleasePurge          EventType = "ReleasePurge"
 
 	ProjectCreate       EventType = "ProjectCreate"
 	ProjectUpdate       EventType = "ProjectUpdate"
 	ProjectReorderTasks EventType = "ProjectReorderTasks"
+	ProjectDelete       EventType = "ProjectDelete"
+	ProjectRestore      EventType = "ProjectRestore"
+	ProjectPurge        EventType = "ProjectPurge"
+
+	// Undo and Redo record the compensating event applied to undo or
+	// redo an action of their user.
+	Undo EventType = "Undo"
+	Redo EventType = "Redo"
 )
 
 // An Event is used to record every mutation requested
@@ -28,18 +49,109 @@ type Event struct {
 	UUID       uuid.UUID
 	Type       EventType
 	EntityUUID uuid.UUID
-	UserID     string
-	Payload    []byte
-	CreatedAt  time.Time
+	// ProjectUUID is the project the entity belongs to, or
+	// the entity itself for project events.
+	ProjectUUID uuid.UUID
+	UserID      string
+	// CorrelationID is shared by the events recorded by the same
+	// request, like a bulk one. It is uuid.Nil for the others.
+	CorrelationID uuid.UUID
+	Payload       []byte
+	// SchemaVersion is the version of the schema of the payload, see
+	// Schema.
+	SchemaVersion int
+	CreatedAt     time.Time
+}
+
+type eventJSON struct {
+	UUID          uuid.UUID       `json:"uuid"`
+	Type          EventType       `json:"type"`
+	EntityUUID    uuid.UUID       `json:"entity_uuid"`
+	ProjectUUID   uuid.UUID       `json:"project_uuid"`
+	UserID        string          `json:"user_id"`
+	CorrelationID *uuid.UUID      `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	SchemaVersion int             `json:"schema_version"`
+	CreatedAt     time.Time       `json:"created_at"`
 }
 
+// MarshalJSON embeds the payload as is instead of encoding it in
+// base64.
+func (e Event) MarshalJSON() ([]byte, error) {
+	v := eventJSON{
+		UUID:          e.UUID,
+		Type:          e.Type,
+		EntityUUID:    e.EntityUUID,
+		ProjectUUID:   e.ProjectUUID,
+		UserID:        e.UserID,
+		Payload:       e.Payload,
+		SchemaVersion: e.SchemaVersion,
+		CreatedAt:     e.CreatedAt,
+	}
+	if e.CorrelationID != uuid.Nil {
+		v.CorrelationID = &e.CorrelationID
+	}
+	return json.Marshal(v)
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var v eventJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*e = Event{
+		UUID:          v.UUID,
+		Type:          v.Type,
+		EntityUUID:    v.EntityUUID,
+		ProjectUUID:   v.ProjectUUID,
+		UserID:        v.UserID,
+		Payload:       []byte(v.Payload),
+		SchemaVersion: v.SchemaVersion,
+		CreatedAt:     v.CreatedAt,
+	}
+	if v.CorrelationID != nil {
+		e.CorrelationID = *v.CorrelationID
+	}
+	return nil
+}
+
+// An EventFilter restricts the events returned by EventStore.List.
+// Zero values do not filter anything, so an empty EventFilter
+// matches every event.
+type EventFilter struct {
+	Types         []EventType
+	EntityUUIDs   []uuid.UUID
+	ProjectUUID   uuid.UUID
+	UserID        string
+	CorrelationID uuid.UUID
+
+	// Since and Until bound the creation date of the events,
+	// both inclusive.
+	Since time.Time
+	Until time.Time
+
+	// Reverse lists the most recent events first. Offset events are
+	// skipped, and at most Limit are listed if it is not 0.
+	Reverse bool
+	Offset  int
+	Limit   int
+}
+
+// ErrDuplicateEvent is returned by EventStore.Store when an event with
+// the same uuid is already stored.
+var ErrDuplicateEvent = errors.New("duplicate event")
+
 // An EventStore should store and retrieve Events.
 type EventStore interface {
-	// Store e in the database/store.
+	// Store e in the database/store, or return ErrDuplicateEvent if
+	// it already holds an event with the uuid of e.
 	Store(ctx context.Context, e Event) error
 
-	// List all the events from the store. List takes
-	// a channel as input to make it more convenient
-	// to scroll through all the events stored.
-	List(ctx context.Context, ch chan<- Event) error
+	// List the events matching filter, in creation order unless
+	// filter.Reverse is set. List takes
+	// a channel as input to make it more convenient to scroll through
+	// all the events stored. The channel is closed when List returns,
+	// whether it succeeded, failed or ctx was cancelled.
+	List(ctx context.Context, filter EventFilter, ch chan<- Event) error
 }
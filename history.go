@@ -0,0 +1,300 @@
+package tonight
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A HistoryEntry describes an event from the point of view of the
+// entity it modified.
+type HistoryEntry struct {
+	EventUUID uuid.UUID     `json:"event_uuid"`
+	Type      EventType     `json:"type"`
+	User      User          `json:"user"`
+	CreatedAt time.Time     `json:"created_at"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// A FieldChange is the modification of one field of an entity by an
+// event. From is nil for the event creating the entity.
+type FieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// An EntityKind is the kind of entity an event is about, the prefix of
+// its type. The uuid alone does not tell the entities apart: the
+// Backlog release shares the uuid of its project.
+type EntityKind string
+
+const (
+	EntityTask    EntityKind = "Task"
+	EntityRelease EntityKind = "Release"
+	EntityProject EntityKind = "Project"
+)
+
+// entityKind returns the kind of entity e is about, empty if its type
+// is unknown. Undo and Redo are about the entity of the event they
+// compensate.
+func entityKind(e Event) EntityKind {
+	typ := e.Type
+	if typ == Undo || typ == Redo {
+		p, err := decodePayload(e)
+		if err != nil {
+			return ""
+		}
+		typ = p.(*undoPayload).Event.Type
+	}
+
+	for _, kind := range []EntityKind{EntityTask, EntityRelease, EntityProject} {
+		if strings.HasPrefix(string(typ), string(kind)) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// History returns the events of the entity of the given kind
+// identified by entityUUID, with their users, like Audit, and the
+// changes they made to the entity. The events about another entity
+// sharing its uuid are left out, unless they changed it, like the
+// ProjectCreate creating the Backlog release.
+func History(ctx context.Context, store EventStore, userStore UserStore, kind EntityKind, entityUUID uuid.UUID) ([]HistoryEntry, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- store.List(ctx, EventFilter{EntityUUIDs: []uuid.UUID{entityUUID}}, ch)
+	}()
+
+	p := NewProjection()
+	events := make([]Event, 0)
+	entries := make([]HistoryEntry, 0)
+	for e := range ch {
+		before := p.fields(kind, entityUUID)
+		if err := p.Apply(e); err != nil {
+			cancel()
+			for range ch {
+			}
+			<-errc
+			return nil, fmt.Errorf("error applying event %s: %w", e.UUID, err)
+		}
+
+		changes := diffFields(before, p.fields(kind, entityUUID))
+		if entityKind(e) != kind && len(changes) == 0 {
+			continue
+		}
+
+		events = append(events, e)
+		entries = append(entries, HistoryEntry{
+			EventUUID: e.UUID,
+			Type:      e.Type,
+			User:      User{ID: e.UserID},
+			CreatedAt: e.CreatedAt,
+			Changes:   changes,
+		})
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	names, err := userNames(ctx, userStore, events)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].User.Name = names[entries[i].User.ID]
+	}
+	return entries, nil
+}
+
+// fields returns the fields of the entity of the given kind identified
+// by id that are shown in its history, or nil if the entity does not
+// exist (yet).
+func (p *Projection) fields(kind EntityKind, id uuid.UUID) map[string]interface{} {
+	switch kind {
+	case EntityProject:
+		project, ok := p.Projects[id]
+		if !ok {
+			return nil
+		}
+
+		ranked := make([]uuid.UUID, 0, len(p.Ranks))
+		for taskUUID := range p.Ranks {
+			ranked = append(ranked, taskUUID)
+		}
+		sort.Slice(ranked, func(i, j int) bool { return p.Ranks[ranked[i]] < p.Ranks[ranked[j]] })
+
+		fields := map[string]interface{}{
+			"name":        project.Name,
+			"slug":        project.Slug,
+			"description": project.Description,
+			"ranks":       ranked,
+		}
+		if project.DeletedAt != nil {
+			fields["deleted_at"] = *project.DeletedAt
+		}
+		return fields
+
+	case EntityTask:
+		task, ok := p.Tasks[id]
+		if !ok {
+			return nil
+		}
+
+		fields := map[string]interface{}{
+			"title":   task.Title,
+			"status":  task.Status,
+			"release": task.Release.UUID,
+		}
+		if task.Description != "" {
+			fields["description"] = task.Description
+		}
+		if rank, ok := p.Ranks[id]; ok {
+			fields["rank"] = rank
+		}
+		if task.DeletedAt != nil {
+			fields["deleted_at"] = *task.DeletedAt
+		}
+		return fields
+
+	case EntityRelease:
+		release, ok := p.Releases[id]
+		if !ok {
+			return nil
+		}
+
+		fields := map[string]interface{}{
+			"title":       release.Title,
+			"description": release.Description,
+		}
+		if release.DeletedAt != nil {
+			fields["deleted_at"] = *release.DeletedAt
+		}
+		return fields
+	}
+
+	return nil
+}
+
+func diffFields(before, after map[string]interface{}) []FieldChange {
+	changes := make([]FieldChange, 0)
+	for field, to := range after {
+		from, ok := before[field]
+		if ok && reflect.DeepEqual(from, to) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: field, From: from, To: to})
+	}
+	// Fields can also go away, when an entity is restored for instance
+	for field, from := range before {
+		if _, ok := after[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, From: from, To: nil})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func (s service) taskHistory(c echo.Context) error {
+	id, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	task, err := s.taskStore.Get(ctx, id, user)
+	if err != nil {
+		return fmt.Errorf("error retrieving task: %w", err)
+	}
+
+	release, err := s.releaseStore.Get(ctx, task.Release.UUID)
+	if err != nil {
+		return err
+	}
+
+	return s.history(c, user, release.Project.UUID, EntityTask, id)
+}
+
+func (s service) projectHistory(c echo.Context) error {
+	id, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+
+	return s.history(c, user, id, EntityProject, id)
+}
+
+func (s service) releaseHistory(c echo.Context) error {
+	projectUUID, err := uuidParam(c, "project_uuid")
+	if err != nil {
+		return err
+	}
+
+	releaseUUID, err := uuidParam(c, "release_uuid")
+	if err != nil {
+		return err
+	}
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+
+	release, err := s.releaseStore.Get(c.Request().Context(), releaseUUID)
+	if err != nil {
+		return err
+	}
+	if release.Project.UUID != projectUUID {
+		return fmt.Errorf("release %s: %w", releaseUUID, ErrNotFound)
+	}
+
+	return s.history(c, user, projectUUID, EntityRelease, releaseUUID)
+}
+
+// history responds with the history of the entity of the given kind
+// identified by entityUUID, if user has access to the project it
+// belongs to.
+func (s service) history(c echo.Context, user User, projectUUID uuid.UUID, kind EntityKind, entityUUID uuid.UUID) error {
+	ctx := c.Request().Context()
+
+	perm, err := s.userStore.Permission(ctx, user, projectUUID.String())
+	if err != nil {
+		return err
+	}
+	if perm == "" {
+		return ErrForbidden
+	}
+
+	entries, err := History(ctx, s.eventStore, s.userStore, kind, entityUUID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": entries,
+	})
+}
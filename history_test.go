@@ -0,0 +1,194 @@
+package tonight
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceEventStore lists the events it holds in the order they were
+// stored, ignoring the time range except for its end.
+type sliceEventStore []Event
+
+func (s *sliceEventStore) Store(ctx context.Context, e Event) error {
+	*s = append(*s, e)
+	return nil
+}
+
+func (s *sliceEventStore) List(ctx context.Context, filter EventFilter, ch chan<- Event) error {
+	defer close(ch)
+
+	matching := make([]Event, 0)
+	for _, e := range *s {
+		if len(filter.EntityUUIDs) > 0 && !uuidIn(e.EntityUUID, filter.EntityUUIDs) {
+			continue
+		}
+		if filter.ProjectUUID != uuid.Nil && e.ProjectUUID != filter.ProjectUUID {
+			continue
+		}
+		if filter.UserID != "" && e.UserID != filter.UserID {
+			continue
+		}
+		if len(filter.Types) > 0 && !typeIn(e.Type, filter.Types) {
+			continue
+		}
+		if !filter.Until.IsZero() && e.CreatedAt.After(filter.Until) {
+			continue
+		}
+		matching = append(matching, e)
+	}
+
+	if filter.Reverse {
+		for i, j := 0, len(matching)-1; i < j; i, j = i+1, j-1 {
+			matching[i], matching[j] = matching[j], matching[i]
+		}
+	}
+	if filter.Offset < len(matching) {
+		matching = matching[filter.Offset:]
+	} else {
+		matching = nil
+	}
+	if filter.Limit > 0 && filter.Limit < len(matching) {
+		matching = matching[:filter.Limit]
+	}
+
+	for _, e := range matching {
+		ch <- e
+	}
+	return nil
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	taskUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	now := time.Now()
+
+	store := &sliceEventStore{
+		{
+			UUID:       uuid.NewV1(),
+			Type:       TaskCreate,
+			EntityUUID: taskUUID,
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, releaseUUID)),
+			CreatedAt:  now,
+		},
+		{
+			UUID:       uuid.NewV1(),
+			Type:       TaskUpdate,
+			EntityUUID: taskUUID,
+			UserID:     "other",
+			Payload:    []byte(`{"title": "renamed", "status": "TODO"}`),
+			CreatedAt:  now.Add(time.Second),
+		},
+		{
+			UUID:       uuid.NewV1(),
+			Type:       TaskDone,
+			EntityUUID: taskUUID,
+			UserID:     "user",
+			Payload:    []byte(`{}`),
+			CreatedAt:  now.Add(2 * time.Second),
+		},
+		{
+			UUID:       uuid.NewV1(),
+			Type:       TaskCreate,
+			EntityUUID: uuid.NewV1(),
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"title": "other task", "release": {"uuid": "%s"}}`, releaseUUID)),
+			CreatedAt:  now.Add(3 * time.Second),
+		},
+	}
+
+	entries, err := History(ctx, store, permissionUserStore{"user": "owner"}, EntityTask, taskUUID)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	require.Equal(t, TaskCreate, entries[0].Type)
+	require.Equal(t, User{ID: "user", Name: "user"}, entries[0].User)
+	require.Equal(t, []FieldChange{
+		{Field: "release", From: nil, To: releaseUUID},
+		{Field: "status", From: nil, To: TaskStatusTODO},
+		{Field: "title", From: nil, To: "task"},
+	}, entries[0].Changes)
+
+	require.Equal(t, TaskUpdate, entries[1].Type)
+	// Unknown users keep their id only
+	require.Equal(t, User{ID: "other"}, entries[1].User)
+	require.Equal(t, []FieldChange{
+		{Field: "title", From: "task", To: "renamed"},
+	}, entries[1].Changes)
+
+	require.Equal(t, TaskDone, entries[2].Type)
+	require.Equal(t, []FieldChange{
+		{Field: "status", From: TaskStatusTODO, To: TaskStatusDONE},
+	}, entries[2].Changes)
+}
+
+func TestHistoryBacklog(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	now := time.Now()
+
+	// The backlog shares the uuid of its project
+	store := &sliceEventStore{
+		{
+			UUID:       uuid.NewV1(),
+			Type:       ProjectCreate,
+			EntityUUID: projectUUID,
+			UserID:     "user",
+			Payload:    []byte(`{"name": "project"}`),
+			CreatedAt:  now,
+		},
+		{
+			UUID:       uuid.NewV1(),
+			Type:       ProjectUpdate,
+			EntityUUID: projectUUID,
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"name": "project", "description": "described", "slug": "%s"}`, projectSlug("project", projectUUID))),
+			CreatedAt:  now.Add(time.Second),
+		},
+		{
+			UUID:       uuid.NewV1(),
+			Type:       ReleaseRebalanceTasks,
+			EntityUUID: projectUUID,
+			UserID:     "user",
+			Payload:    []byte(`{"ranks": {}}`),
+			CreatedAt:  now.Add(2 * time.Second),
+		},
+	}
+
+	// The project creates the backlog, the other project events do not
+	// change it
+	entries, err := History(ctx, store, permissionUserStore{"user": "owner"}, EntityRelease, projectUUID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, ProjectCreate, entries[0].Type)
+	require.Equal(t, []FieldChange{
+		{Field: "description", From: nil, To: ""},
+		{Field: "title", From: nil, To: "Backlog"},
+	}, entries[0].Changes)
+
+	require.Equal(t, ReleaseRebalanceTasks, entries[1].Type)
+	require.Empty(t, entries[1].Changes)
+
+	entries, err = History(ctx, store, permissionUserStore{"user": "owner"}, EntityProject, projectUUID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	require.Equal(t, ProjectCreate, entries[0].Type)
+	fields := make([]string, len(entries[0].Changes))
+	for i, change := range entries[0].Changes {
+		fields[i] = change.Field
+	}
+	require.Equal(t, []string{"description", "name", "ranks", "slug"}, fields)
+
+	require.Equal(t, ProjectUpdate, entries[1].Type)
+	require.Equal(t, []FieldChange{
+		{Field: "description", From: "", To: "described"},
+	}, entries[1].Changes)
+}
@@ -0,0 +1,114 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type EventStore struct {
+	s *Store
+}
+
+func (s EventStore) Store(ctx context.Context, e tonight.Event) error {
+	return s.s.update(ctx, func(d *data) error {
+		for _, stored := range d.events {
+			if stored.UUID == e.UUID {
+				return fmt.Errorf("event %s already exists: %w", e.UUID, tonight.ErrDuplicateEvent)
+			}
+		}
+
+		e.Payload = append([]byte(nil), e.Payload...)
+		d.events = append(d.events, e)
+		return nil
+	})
+}
+
+func (s EventStore) List(ctx context.Context, filter tonight.EventFilter, ch chan<- tonight.Event) error {
+	defer close(ch)
+
+	// The events are copied so that the store is not locked while the
+	// caller reads them.
+	events := make([]tonight.Event, 0)
+	err := s.s.view(ctx, func(d *data) error {
+		for _, e := range d.events {
+			if matches(filter, e) {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt) != filter.Reverse
+		}
+		return uuidLess(a.UUID, b.UUID) != filter.Reverse
+	})
+
+	if filter.Offset >= len(events) {
+		events = events[:0]
+	} else {
+		events = events[filter.Offset:]
+	}
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+
+	for _, e := range events {
+		e.Payload = append([]byte(nil), e.Payload...)
+		select {
+		case ch <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func matches(filter tonight.EventFilter, e tonight.Event) bool {
+	if len(filter.Types) > 0 {
+		found := false
+		for _, typ := range filter.Types {
+			found = found || typ == e.Type
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(filter.EntityUUIDs) > 0 {
+		found := false
+		for _, id := range filter.EntityUUIDs {
+			found = found || id == e.EntityUUID
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.ProjectUUID != uuid.Nil && filter.ProjectUUID != e.ProjectUUID {
+		return false
+	}
+	if filter.UserID != "" && filter.UserID != e.UserID {
+		return false
+	}
+	if filter.CorrelationID != uuid.Nil && filter.CorrelationID != e.CorrelationID {
+		return false
+	}
+	if !filter.Since.IsZero() && e.CreatedAt.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && e.CreatedAt.After(filter.Until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+package inmem
+
+import (
+	"testing"
+
+	"github.com/bobinette/tonight/tonighttest"
+)
+
+func TestStores(t *testing.T) {
+	store := NewStore()
+
+	tonighttest.TestStores(t, tonighttest.Stores{
+		Transactor:    store.Transactor(),
+		EventStore:    store.EventStore(),
+		ProjectStore:  store.ProjectStore(),
+		ReleaseStore:  store.ReleaseStore(),
+		TaskStore:     store.TaskStore(),
+		UserStore:     store.UserStore(),
+		SnapshotStore: store.SnapshotStore(),
+		WebhookStore:  store.WebhookStore(),
+		TrashStore:    store.TrashStore(),
+	})
+}
@@ -0,0 +1,191 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type ProjectStore struct {
+	s *Store
+}
+
+func (s ProjectStore) Upsert(ctx context.Context, p tonight.Project, u tonight.User) error {
+	return s.s.update(ctx, func(d *data) error {
+		for _, other := range d.projects {
+			if other.UUID != p.UUID && other.Slug == p.Slug {
+				return fmt.Errorf("slug %s of project %s is taken: %w", p.Slug, p.UUID, tonight.ErrConflict)
+			}
+		}
+
+		stored, ok := d.projects[p.UUID]
+		if p.Version == 0 {
+			if ok {
+				return fmt.Errorf("project %s already exists: %w", p.UUID, tonight.ErrVersionConflict)
+			}
+
+			stored = p
+			stored.Releases = nil
+			stored.Version = 1
+		} else {
+			if !ok || stored.Version != p.Version {
+				return fmt.Errorf("project %s: %w", p.UUID, tonight.ErrVersionConflict)
+			}
+
+			stored.Name = p.Name
+			stored.Description = p.Description
+			stored.Slug = p.Slug
+			stored.UpdatedAt = p.UpdatedAt
+			stored.Version++
+		}
+		d.projects[p.UUID] = stored
+
+		key := permissionKey{userID: u.ID, projectUUID: p.UUID}
+		if _, ok := d.permissions[key]; !ok {
+			d.permissions[key] = "owner"
+		}
+
+		// The backlog shares the uuid of its project
+		if _, ok := d.releases[p.UUID]; !ok {
+			d.releases[p.UUID] = tonight.Release{
+				UUID:      p.UUID,
+				Title:     "Backlog",
+				Project:   tonight.Project{UUID: p.UUID},
+				CreatedAt: p.CreatedAt,
+				UpdatedAt: p.UpdatedAt,
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s ProjectStore) List(ctx context.Context, u tonight.User) ([]tonight.Project, error) {
+	var projects []tonight.Project
+	err := s.s.view(ctx, func(d *data) error {
+		projects = d.projectsOf(u)
+		for i, p := range projects {
+			projects[i].Releases = d.releasesOf(p.UUID)
+		}
+		return nil
+	})
+	return projects, err
+}
+
+func (s ProjectStore) Summaries(ctx context.Context, u tonight.User, filter tonight.ProjectFilter) ([]tonight.ProjectSummary, error) {
+	summaries := make([]tonight.ProjectSummary, 0)
+	err := s.s.view(ctx, func(d *data) error {
+		var after tonight.Project
+		if filter.After != uuid.Nil {
+			var ok bool
+			if after, ok = d.projects[filter.After]; !ok {
+				return nil
+			}
+		}
+
+		for _, p := range d.projectsOf(u) {
+			if filter.After != uuid.Nil && !projectLess(after, p) {
+				continue
+			}
+			if filter.Limit > 0 && len(summaries) == filter.Limit {
+				break
+			}
+
+			summary := tonight.ProjectSummary{
+				Project:    p,
+				TaskCounts: map[tonight.TaskStatus]int{tonight.TaskStatusTODO: 0, tonight.TaskStatusDONE: 0},
+			}
+			summary.Releases = d.releasesOf(p.UUID)
+			for i, release := range summary.Releases {
+				for _, t := range release.Tasks {
+					summary.TaskCounts[t.Status]++
+				}
+				summary.Releases[i].Tasks = nil
+			}
+			summaries = append(summaries, summary)
+		}
+		return nil
+	})
+	return summaries, err
+}
+
+// projectsOf returns the projects of the user by creation date,
+// without their releases. Deleted projects are left out.
+func (d *data) projectsOf(u tonight.User) []tonight.Project {
+	projects := make([]tonight.Project, 0)
+	for _, p := range d.projects {
+		if p.DeletedAt == nil && d.hasPermission(u, p.UUID) {
+			projects = append(projects, p)
+		}
+	}
+
+	sort.Slice(projects, func(i, j int) bool { return projectLess(projects[i], projects[j]) })
+	return projects
+}
+
+func projectLess(a, b tonight.Project) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return uuidLess(a.UUID, b.UUID)
+}
+
+func (s ProjectStore) Get(ctx context.Context, id uuid.UUID, u tonight.User) (tonight.Project, error) {
+	var p tonight.Project
+	err := s.s.view(ctx, func(d *data) error {
+		stored, ok := d.projects[id]
+		if !ok || stored.DeletedAt != nil || !d.hasPermission(u, id) {
+			return fmt.Errorf("project %s: %w", id, tonight.ErrNotFound)
+		}
+
+		p = stored
+		p.Releases = d.releasesOf(id)
+		return nil
+	})
+	return p, err
+}
+
+func (s ProjectStore) Find(ctx context.Context, slug string, u tonight.User) (tonight.Project, error) {
+	var p tonight.Project
+	err := s.s.view(ctx, func(d *data) error {
+		for _, stored := range d.projects {
+			if stored.Slug == slug && stored.DeletedAt == nil && d.hasPermission(u, stored.UUID) {
+				p = stored
+				p.Releases = d.releasesOf(stored.UUID)
+				return nil
+			}
+		}
+		return fmt.Errorf("project %s: %w", slug, tonight.ErrNotFound)
+	})
+	return p, err
+}
+
+func (s ProjectStore) Slugs(ctx context.Context, slugs []string, u tonight.User) ([]string, error) {
+	found := make([]string, 0, len(slugs))
+	err := s.s.view(ctx, func(d *data) error {
+		wanted := make(map[string]bool)
+		for _, slug := range slugs {
+			wanted[slug] = true
+		}
+		for _, stored := range d.projects {
+			if wanted[stored.Slug] && stored.DeletedAt == nil && d.hasPermission(u, stored.UUID) {
+				found = append(found, stored.Slug)
+				// Each slug is returned once
+				delete(wanted, stored.Slug)
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// hasPermission returns true if the user has any permission on the
+// project.
+func (d *data) hasPermission(u tonight.User, projectUUID uuid.UUID) bool {
+	_, ok := d.permissions[permissionKey{userID: u.ID, projectUUID: projectUUID}]
+	return ok
+}
@@ -0,0 +1,126 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type ReleaseStore struct {
+	s *Store
+}
+
+func (s ReleaseStore) Get(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	var release tonight.Release
+	err := s.s.view(ctx, func(d *data) error {
+		stored, ok := d.liveRelease(id)
+		if !ok {
+			return fmt.Errorf("release %s: %w", id, tonight.ErrNotFound)
+		}
+
+		release = stored
+		release.Tasks = d.tasksOf(id)
+		return nil
+	})
+	return release, err
+}
+
+func (s ReleaseStore) Head(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	var release tonight.Release
+	err := s.s.view(ctx, func(d *data) error {
+		stored, ok := d.liveRelease(id)
+		if !ok {
+			return fmt.Errorf("release %s: %w", id, tonight.ErrNotFound)
+		}
+
+		release = stored
+		release.Tasks = make([]tonight.Task, 0)
+		return nil
+	})
+	return release, err
+}
+
+func (s ReleaseStore) List(ctx context.Context, projectUUID uuid.UUID) ([]tonight.Release, error) {
+	var releases []tonight.Release
+	err := s.s.view(ctx, func(d *data) error {
+		releases = make([]tonight.Release, 0)
+		if p, ok := d.projects[projectUUID]; ok && p.DeletedAt == nil {
+			releases = d.releasesOf(projectUUID)
+		}
+		return nil
+	})
+	return releases, err
+}
+
+func (s ReleaseStore) Upsert(ctx context.Context, release tonight.Release) error {
+	return s.s.update(ctx, func(d *data) error {
+		stored, ok := d.releases[release.UUID]
+		if release.Version == 0 {
+			if ok {
+				return fmt.Errorf("release %s already exists: %w", release.UUID, tonight.ErrVersionConflict)
+			}
+			if _, ok := d.projects[release.Project.UUID]; !ok {
+				return fmt.Errorf("project %s of release %s: %w", release.Project.UUID, release.UUID, tonight.ErrNotFound)
+			}
+
+			release.Project = tonight.Project{UUID: release.Project.UUID}
+			release.Tasks = nil
+			release.Version = 1
+			d.releases[release.UUID] = release
+			return nil
+		}
+
+		if !ok || stored.Version != release.Version {
+			return fmt.Errorf("release %s: %w", release.UUID, tonight.ErrVersionConflict)
+		}
+
+		stored.Title = release.Title
+		stored.Description = release.Description
+		stored.UpdatedAt = release.UpdatedAt
+		stored.Version++
+		d.releases[release.UUID] = stored
+		return nil
+	})
+}
+
+// liveRelease returns the release identified by id, unless it or its
+// project is deleted.
+func (d *data) liveRelease(id uuid.UUID) (tonight.Release, bool) {
+	release, ok := d.releases[id]
+	if !ok || release.DeletedAt != nil {
+		return tonight.Release{}, false
+	}
+	if p, ok := d.projects[release.Project.UUID]; !ok || p.DeletedAt != nil {
+		return tonight.Release{}, false
+	}
+	return release, true
+}
+
+// releasesOf returns the releases of the project with their tasks,
+// by title with the backlog last. Deleted releases are left out.
+func (d *data) releasesOf(projectUUID uuid.UUID) []tonight.Release {
+	releases := make([]tonight.Release, 0)
+	for _, release := range d.releases {
+		if release.Project.UUID == projectUUID && release.DeletedAt == nil {
+			release.Tasks = d.tasksOf(release.UUID)
+			releases = append(releases, release)
+		}
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		a, b := releases[i], releases[j]
+		aBacklog, bBacklog := a.UUID == projectUUID, b.UUID == projectUUID
+		if aBacklog != bBacklog {
+			return bBacklog
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return uuidLess(a.UUID, b.UUID)
+	})
+	return releases
+}
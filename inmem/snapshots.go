@@ -0,0 +1,79 @@
+package inmem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type SnapshotStore struct {
+	s *Store
+}
+
+func (s SnapshotStore) Store(ctx context.Context, snap tonight.Snapshot) error {
+	state, err := json.Marshal(snap.Projection)
+	if err != nil {
+		return err
+	}
+
+	snap.Projection = nil
+	return s.s.update(ctx, func(d *data) error {
+		key := snapshotKey{projectUUID: snap.ProjectUUID, eventUUID: snap.EventUUID}
+		d.snapshots[key] = snapshot{Snapshot: snap, state: state}
+		return nil
+	})
+}
+
+func (s SnapshotStore) Latest(ctx context.Context, projectUUID uuid.UUID, until time.Time) (tonight.Snapshot, error) {
+	var latest snapshot
+	found := false
+	err := s.s.view(ctx, func(d *data) error {
+		for _, snap := range d.snapshots {
+			if snap.ProjectUUID != projectUUID {
+				continue
+			}
+			if !until.IsZero() && snap.EventCreatedAt.After(until) {
+				continue
+			}
+			if !found || latest.precedes(snap) {
+				latest = snap
+				found = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return tonight.Snapshot{}, err
+	}
+	if !found {
+		return tonight.Snapshot{}, fmt.Errorf("project %s: %w", projectUUID, tonight.ErrNoSnapshot)
+	}
+
+	snap := latest.Snapshot
+	snap.Projection = tonight.NewProjection()
+	if err := json.Unmarshal(latest.state, snap.Projection); err != nil {
+		return tonight.Snapshot{}, fmt.Errorf("error decoding snapshot of project %s: %w", projectUUID, err)
+	}
+	return snap, nil
+}
+
+func (s SnapshotStore) Clear(ctx context.Context) error {
+	return s.s.update(ctx, func(d *data) error {
+		d.snapshots = make(map[snapshotKey]snapshot)
+		return nil
+	})
+}
+
+// precedes returns true if the last event of s comes before the last
+// event of other.
+func (s snapshot) precedes(other snapshot) bool {
+	if !s.EventCreatedAt.Equal(other.EventCreatedAt) {
+		return s.EventCreatedAt.Before(other.EventCreatedAt)
+	}
+	return uuidLess(s.EventUUID, other.EventUUID)
+}
@@ -0,0 +1,161 @@
+// Package inmem implements the tonight stores in memory, with the
+// same semantics as the mysql package. It is meant for tests and for
+// trying Tonight out: nothing survives the process.
+package inmem
+
+import (
+	"context"
+	"sync"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+// A Store holds the data of all the stores it returns, so that they
+// see each other's writes like tables of the same database do. It is
+// safe for concurrent use.
+type Store struct {
+	mu   sync.Mutex
+	data *data
+}
+
+func NewStore() *Store {
+	return &Store{data: newData()}
+}
+
+func (s *Store) EventStore() EventStore       { return EventStore{s: s} }
+func (s *Store) TaskStore() TaskStore         { return TaskStore{s: s} }
+func (s *Store) ProjectStore() ProjectStore   { return ProjectStore{s: s} }
+func (s *Store) ReleaseStore() ReleaseStore   { return ReleaseStore{s: s} }
+func (s *Store) UserStore() UserStore         { return UserStore{s: s} }
+func (s *Store) SnapshotStore() SnapshotStore { return SnapshotStore{s: s} }
+func (s *Store) WebhookStore() WebhookStore   { return WebhookStore{s: s} }
+func (s *Store) TrashStore() TrashStore       { return TrashStore{s: s} }
+func (s *Store) Transactor() Transactor       { return Transactor{s: s} }
+
+type permissionKey struct {
+	userID      string
+	projectUUID uuid.UUID
+}
+
+type snapshotKey struct {
+	projectUUID uuid.UUID
+	eventUUID   uuid.UUID
+}
+
+// snapshot is a stored snapshot, its projection encoded like the mysql
+// package does so that it cannot be modified once stored.
+type snapshot struct {
+	tonight.Snapshot
+	state []byte
+}
+
+// data is the content of a Store. The values of the maps and slices
+// are never modified in place, they are replaced, so a shallow copy is
+// enough to roll a transaction back.
+type data struct {
+	users       map[string]tonight.User
+	permissions map[permissionKey]string
+	projects    map[uuid.UUID]tonight.Project
+	releases    map[uuid.UUID]tonight.Release
+	tasks       map[uuid.UUID]tonight.Task
+	events      []tonight.Event
+	snapshots   map[snapshotKey]snapshot
+	webhooks    map[uuid.UUID]tonight.Webhook
+	deliveries  []tonight.WebhookDelivery
+	queue       map[uuid.UUID]tonight.QueuedDelivery
+}
+
+func newData() *data {
+	return &data{
+		users:       make(map[string]tonight.User),
+		permissions: make(map[permissionKey]string),
+		projects:    make(map[uuid.UUID]tonight.Project),
+		releases:    make(map[uuid.UUID]tonight.Release),
+		tasks:       make(map[uuid.UUID]tonight.Task),
+		snapshots:   make(map[snapshotKey]snapshot),
+		webhooks:    make(map[uuid.UUID]tonight.Webhook),
+		queue:       make(map[uuid.UUID]tonight.QueuedDelivery),
+	}
+}
+
+func (d *data) clone() *data {
+	c := newData()
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	for k, v := range d.permissions {
+		c.permissions[k] = v
+	}
+	for k, v := range d.projects {
+		c.projects[k] = v
+	}
+	for k, v := range d.releases {
+		c.releases[k] = v
+	}
+	for k, v := range d.tasks {
+		c.tasks[k] = v
+	}
+	for k, v := range d.snapshots {
+		c.snapshots[k] = v
+	}
+	for k, v := range d.webhooks {
+		c.webhooks[k] = v
+	}
+	for k, v := range d.queue {
+		c.queue[k] = v
+	}
+	// Events and deliveries are only appended to, capping the slices
+	// makes an append in the clone reallocate.
+	c.events = d.events[:len(d.events):len(d.events)]
+	c.deliveries = d.deliveries[:len(d.deliveries):len(d.deliveries)]
+	return c
+}
+
+type txKey struct {
+	s *Store
+}
+
+// view runs f with the data of s, under its lock unless ctx carries a
+// transaction of s, which already holds it.
+func (s *Store) view(ctx context.Context, f func(d *data) error) error {
+	if d, ok := ctx.Value(txKey{s: s}).(*data); ok {
+		return f(d)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return f(s.data)
+}
+
+// update runs f like view, on a copy of the data that replaces it only
+// if f succeeds, so that a failed write leaves nothing behind.
+func (s *Store) update(ctx context.Context, f func(d *data) error) error {
+	if d, ok := ctx.Value(txKey{s: s}).(*data); ok {
+		return f(d)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.data.clone()
+	if err := f(d); err != nil {
+		return err
+	}
+	s.data = d
+	return nil
+}
+
+type Transactor struct {
+	s *Store
+}
+
+// Transaction runs f in a transaction. Nested calls take part in the
+// outermost transaction. Transactions are serialized: the store is
+// locked until f returns, so f must only use the stores with the
+// context it is given.
+func (t Transactor) Transaction(ctx context.Context, f func(ctx context.Context) error) error {
+	return t.s.update(ctx, func(d *data) error {
+		return f(context.WithValue(ctx, txKey{s: t.s}, d))
+	})
+}
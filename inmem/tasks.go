@@ -0,0 +1,156 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type TaskStore struct {
+	s *Store
+}
+
+func (s TaskStore) Upsert(ctx context.Context, t tonight.Task) error {
+	return s.s.update(ctx, func(d *data) error {
+		stored, ok := d.tasks[t.UUID]
+		if t.Version == 0 {
+			if ok {
+				return fmt.Errorf("task %s already exists: %w", t.UUID, tonight.ErrVersionConflict)
+			}
+			if _, ok := d.releases[t.Release.UUID]; !ok {
+				return fmt.Errorf("release %s of task %s: %w", t.Release.UUID, t.UUID, tonight.ErrNotFound)
+			}
+
+			t.Release = tonight.Release{UUID: t.Release.UUID}
+			t.Rank = ""
+			t.Version = 1
+			d.tasks[t.UUID] = t
+			return nil
+		}
+
+		if !ok || stored.Version != t.Version {
+			return fmt.Errorf("task %s: %w", t.UUID, tonight.ErrVersionConflict)
+		}
+
+		// Like in mysql, only the title, the description, the status and the
+		// release can change. A task moved to another release loses its
+		// rank.
+		if t.Release.UUID != stored.Release.UUID {
+			if _, ok := d.releases[t.Release.UUID]; !ok {
+				return fmt.Errorf("release %s of task %s: %w", t.Release.UUID, t.UUID, tonight.ErrNotFound)
+			}
+			stored.Release = tonight.Release{UUID: t.Release.UUID}
+			stored.Rank = ""
+		}
+		stored.Title = t.Title
+		stored.Description = t.Description
+		stored.Status = t.Status
+		stored.Version++
+		d.tasks[t.UUID] = stored
+		return nil
+	})
+}
+
+func (s TaskStore) Get(ctx context.Context, id uuid.UUID, user tonight.User) (tonight.Task, error) {
+	var t tonight.Task
+	err := s.s.view(ctx, func(d *data) error {
+		stored, ok := d.tasks[id]
+		if !ok || stored.DeletedAt != nil {
+			return fmt.Errorf("task %s: %w", id, tonight.ErrNotFound)
+		}
+		release, ok := d.liveRelease(stored.Release.UUID)
+		if !ok || !d.hasPermission(user, release.Project.UUID) {
+			return fmt.Errorf("task %s: %w", id, tonight.ErrNotFound)
+		}
+
+		t = stored
+		return nil
+	})
+	return t, err
+}
+
+func (s TaskStore) Rank(ctx context.Context, ranks map[uuid.UUID]string) error {
+	return s.s.update(ctx, func(d *data) error {
+		for id, rank := range ranks {
+			if t, ok := d.tasks[id]; ok {
+				t.Rank = rank
+				d.tasks[id] = t
+			}
+		}
+		return nil
+	})
+}
+
+func (s TaskStore) List(ctx context.Context, releaseUUID uuid.UUID, filter tonight.TaskFilter) ([]tonight.Task, error) {
+	tasks := make([]tonight.Task, 0)
+	err := s.s.view(ctx, func(d *data) error {
+		var after tonight.Task
+		if filter.After != uuid.Nil {
+			var ok bool
+			if after, ok = d.tasks[filter.After]; !ok {
+				return nil
+			}
+		}
+
+		for _, t := range d.tasksOf(releaseUUID) {
+			if filter.After != uuid.Nil && !taskLess(after, t) {
+				continue
+			}
+			if len(filter.Statuses) > 0 && !hasStatus(filter.Statuses, t.Status) {
+				continue
+			}
+			if filter.Limit > 0 && len(tasks) == filter.Limit {
+				break
+			}
+			tasks = append(tasks, t)
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+func hasStatus(statuses []tonight.TaskStatus, status tonight.TaskStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// tasksOf returns the tasks of the release in their order, leaving out
+// the deleted ones.
+func (d *data) tasksOf(releaseUUID uuid.UUID) []tonight.Task {
+	tasks := make([]tonight.Task, 0)
+	for _, t := range d.tasks {
+		if t.Release.UUID == releaseUUID && t.DeletedAt == nil {
+			tasks = append(tasks, t)
+		}
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return taskLess(tasks[i], tasks[j]) })
+	return tasks
+}
+
+// taskLess sorts the ranked tasks first by rank, then the others by
+// creation date.
+func taskLess(a, b tonight.Task) bool {
+	if (a.Rank == "") != (b.Rank == "") {
+		return a.Rank != ""
+	}
+	if a.Rank != b.Rank {
+		return a.Rank < b.Rank
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return uuidLess(a.UUID, b.UUID)
+}
+
+func uuidLess(a, b uuid.UUID) bool {
+	return a.String() < b.String()
+}
@@ -0,0 +1,205 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type TrashStore struct {
+	s *Store
+}
+
+func (s TrashStore) Delete(ctx context.Context, kind tonight.TrashKind, id uuid.UUID, at time.Time) error {
+	return s.s.update(ctx, func(d *data) error {
+		return d.setDeletedAt(kind, id, false, &at)
+	})
+}
+
+func (s TrashStore) Restore(ctx context.Context, kind tonight.TrashKind, id uuid.UUID) error {
+	return s.s.update(ctx, func(d *data) error {
+		return d.setDeletedAt(kind, id, true, nil)
+	})
+}
+
+// setDeletedAt sets the deletion date of the entity, if it is in the
+// trash or not as deleted tells.
+func (d *data) setDeletedAt(kind tonight.TrashKind, id uuid.UUID, deleted bool, at *time.Time) error {
+	notFound := fmt.Errorf("%s %s: %w", kind, id, tonight.ErrNotFound)
+	switch kind {
+	case tonight.TrashTask:
+		t, ok := d.tasks[id]
+		if !ok || (t.DeletedAt != nil) != deleted {
+			return notFound
+		}
+		t.DeletedAt = at
+		d.tasks[id] = t
+
+	case tonight.TrashRelease:
+		release, ok := d.releases[id]
+		if !ok || (release.DeletedAt != nil) != deleted {
+			return notFound
+		}
+		release.DeletedAt = at
+		d.releases[id] = release
+
+	case tonight.TrashProject:
+		p, ok := d.projects[id]
+		if !ok || (p.DeletedAt != nil) != deleted {
+			return notFound
+		}
+		p.DeletedAt = at
+		d.projects[id] = p
+
+	default:
+		return fmt.Errorf("unknown kind %s", kind)
+	}
+	return nil
+}
+
+func (s TrashStore) List(ctx context.Context, u tonight.User) ([]tonight.TrashItem, error) {
+	var items []tonight.TrashItem
+	err := s.s.view(ctx, func(d *data) error {
+		items = d.trash(func(item tonight.TrashItem) bool {
+			return d.hasPermission(u, item.ProjectUUID)
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return trashLess(items[j], items[i]) })
+	return items, nil
+}
+
+func (s TrashStore) Expired(ctx context.Context, before time.Time) ([]tonight.TrashItem, error) {
+	var items []tonight.TrashItem
+	err := s.s.view(ctx, func(d *data) error {
+		items = d.trash(func(item tonight.TrashItem) bool {
+			return item.DeletedAt.Before(before)
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return trashLess(items[i], items[j]) })
+	return items, nil
+}
+
+func (s TrashStore) Purge(ctx context.Context, kind tonight.TrashKind, id uuid.UUID) error {
+	return s.s.update(ctx, func(d *data) error {
+		notFound := fmt.Errorf("%s %s: %w", kind, id, tonight.ErrNotFound)
+		switch kind {
+		case tonight.TrashTask:
+			if t, ok := d.tasks[id]; !ok || t.DeletedAt == nil {
+				return notFound
+			}
+			delete(d.tasks, id)
+
+		case tonight.TrashRelease:
+			if release, ok := d.releases[id]; !ok || release.DeletedAt == nil {
+				return notFound
+			}
+			d.purgeRelease(id)
+
+		case tonight.TrashProject:
+			if p, ok := d.projects[id]; !ok || p.DeletedAt == nil {
+				return notFound
+			}
+
+			// Like the foreign keys of the databases, everything
+			// belonging to the project goes with it
+			for releaseUUID, release := range d.releases {
+				if release.Project.UUID == id {
+					d.purgeRelease(releaseUUID)
+				}
+			}
+			for key := range d.permissions {
+				if key.projectUUID == id {
+					delete(d.permissions, key)
+				}
+			}
+			for webhookUUID, w := range d.webhooks {
+				if w.ProjectUUID == id {
+					d.deleteWebhook(webhookUUID)
+				}
+			}
+			delete(d.projects, id)
+
+		default:
+			return fmt.Errorf("unknown kind %s", kind)
+		}
+		return nil
+	})
+}
+
+func (d *data) purgeRelease(id uuid.UUID) {
+	for taskUUID, t := range d.tasks {
+		if t.Release.UUID == id {
+			delete(d.tasks, taskUUID)
+		}
+	}
+	delete(d.releases, id)
+}
+
+// trash returns the deleted entities matching keep.
+func (d *data) trash(keep func(item tonight.TrashItem) bool) []tonight.TrashItem {
+	items := make([]tonight.TrashItem, 0)
+	add := func(item tonight.TrashItem) {
+		if keep(item) {
+			items = append(items, item)
+		}
+	}
+
+	for _, p := range d.projects {
+		if p.DeletedAt != nil {
+			add(tonight.TrashItem{
+				Kind:        tonight.TrashProject,
+				UUID:        p.UUID,
+				Title:       p.Name,
+				ProjectUUID: p.UUID,
+				DeletedAt:   *p.DeletedAt,
+			})
+		}
+	}
+	for _, release := range d.releases {
+		if release.DeletedAt != nil {
+			add(tonight.TrashItem{
+				Kind:        tonight.TrashRelease,
+				UUID:        release.UUID,
+				Title:       release.Title,
+				ProjectUUID: release.Project.UUID,
+				DeletedAt:   *release.DeletedAt,
+			})
+		}
+	}
+	for _, t := range d.tasks {
+		if t.DeletedAt != nil {
+			add(tonight.TrashItem{
+				Kind:        tonight.TrashTask,
+				UUID:        t.UUID,
+				Title:       t.Title,
+				ProjectUUID: d.releases[t.Release.UUID].Project.UUID,
+				ReleaseUUID: t.Release.UUID,
+				DeletedAt:   *t.DeletedAt,
+			})
+		}
+	}
+	return items
+}
+
+// trashLess sorts the items by deletion date.
+func trashLess(a, b tonight.TrashItem) bool {
+	if !a.DeletedAt.Equal(b.DeletedAt) {
+		return a.DeletedAt.Before(b.DeletedAt)
+	}
+	return uuidLess(a.UUID, b.UUID)
+}
@@ -0,0 +1,60 @@
+package inmem
+
+import (
+	"context"
+	"sort"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type UserStore struct {
+	s *Store
+}
+
+func (s UserStore) Ensure(ctx context.Context, user *tonight.User) error {
+	return s.s.update(ctx, func(d *data) error {
+		if stored, ok := d.users[user.ID]; ok {
+			*user = stored
+			return nil
+		}
+
+		d.users[user.ID] = *user
+		return nil
+	})
+}
+
+func (s UserStore) Permission(ctx context.Context, user tonight.User, projectUUID string) (string, error) {
+	id, err := uuid.FromString(projectUUID)
+	if err != nil {
+		return "", nil
+	}
+
+	var perm string
+	err = s.s.view(ctx, func(d *data) error {
+		perm = d.permissions[permissionKey{userID: user.ID, projectUUID: id}]
+		return nil
+	})
+	return perm, err
+}
+
+func (s UserStore) List(ctx context.Context, ids []string) ([]tonight.User, error) {
+	users := make([]tonight.User, 0, len(ids))
+	err := s.s.view(ctx, func(d *data) error {
+		seen := make(map[string]bool)
+		for _, id := range ids {
+			if user, ok := d.users[id]; ok && !seen[id] {
+				users = append(users, user)
+				seen[id] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
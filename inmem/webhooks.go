@@ -0,0 +1,190 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type WebhookStore struct {
+	s *Store
+}
+
+func (s WebhookStore) Upsert(ctx context.Context, w tonight.Webhook) error {
+	w.Types = append([]tonight.EventType(nil), w.Types...)
+	return s.s.update(ctx, func(d *data) error {
+		stored, ok := d.webhooks[w.UUID]
+		if !ok {
+			if _, ok := d.projects[w.ProjectUUID]; !ok {
+				return fmt.Errorf("project %s of webhook %s: %w", w.ProjectUUID, w.UUID, tonight.ErrNotFound)
+			}
+			d.webhooks[w.UUID] = w
+			return nil
+		}
+
+		stored.URL = w.URL
+		stored.Secret = w.Secret
+		stored.Types = w.Types
+		stored.UpdatedAt = w.UpdatedAt
+		d.webhooks[w.UUID] = stored
+		return nil
+	})
+}
+
+func (s WebhookStore) Get(ctx context.Context, id uuid.UUID) (tonight.Webhook, error) {
+	var w tonight.Webhook
+	err := s.s.view(ctx, func(d *data) error {
+		stored, ok := d.webhooks[id]
+		if !ok {
+			return fmt.Errorf("webhook %s: %w", id, tonight.ErrNotFound)
+		}
+		w = stored
+		return nil
+	})
+	return w, err
+}
+
+func (s WebhookStore) List(ctx context.Context, projectUUID uuid.UUID) ([]tonight.Webhook, error) {
+	webhooks := make([]tonight.Webhook, 0)
+	err := s.s.view(ctx, func(d *data) error {
+		for _, w := range d.webhooks {
+			if w.ProjectUUID == projectUUID {
+				webhooks = append(webhooks, w)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		a, b := webhooks[i], webhooks[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return uuidLess(a.UUID, b.UUID)
+	})
+	return webhooks, nil
+}
+
+// Delete removes the webhook with its queue and deliveries.
+func (s WebhookStore) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.s.update(ctx, func(d *data) error {
+		d.deleteWebhook(id)
+		return nil
+	})
+}
+
+// deleteWebhook deletes the webhook with its queue and its deliveries.
+func (d *data) deleteWebhook(id uuid.UUID) {
+	delete(d.webhooks, id)
+	for queuedUUID, queued := range d.queue {
+		if queued.WebhookUUID == id {
+			delete(d.queue, queuedUUID)
+		}
+	}
+
+	deliveries := make([]tonight.WebhookDelivery, 0, len(d.deliveries))
+	for _, delivery := range d.deliveries {
+		if delivery.WebhookUUID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	d.deliveries = deliveries
+}
+
+func (s WebhookStore) LogDelivery(ctx context.Context, delivery tonight.WebhookDelivery) error {
+	return s.s.update(ctx, func(d *data) error {
+		if _, ok := d.webhooks[delivery.WebhookUUID]; !ok {
+			return fmt.Errorf("webhook %s: %w", delivery.WebhookUUID, tonight.ErrNotFound)
+		}
+		d.deliveries = append(d.deliveries, delivery)
+		return nil
+	})
+}
+
+func (s WebhookStore) Deliveries(ctx context.Context, webhookUUID uuid.UUID, limit int) ([]tonight.WebhookDelivery, error) {
+	deliveries := make([]tonight.WebhookDelivery, 0)
+	err := s.s.view(ctx, func(d *data) error {
+		for _, delivery := range d.deliveries {
+			if delivery.WebhookUUID == webhookUUID {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := deliveries[i], deliveries[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return uuidLess(b.UUID, a.UUID)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s WebhookStore) Enqueue(ctx context.Context, queued tonight.QueuedDelivery) error {
+	return s.s.update(ctx, func(d *data) error {
+		if _, ok := d.webhooks[queued.WebhookUUID]; !ok {
+			return fmt.Errorf("webhook %s: %w", queued.WebhookUUID, tonight.ErrNotFound)
+		}
+
+		// Rescheduling only changes the attempt, like in mysql
+		if stored, ok := d.queue[queued.UUID]; ok {
+			stored.Attempt = queued.Attempt
+			stored.NextAttemptAt = queued.NextAttemptAt
+			queued = stored
+		} else {
+			queued.Event.Payload = append([]byte(nil), queued.Event.Payload...)
+		}
+		d.queue[queued.UUID] = queued
+		return nil
+	})
+}
+
+func (s WebhookStore) Due(ctx context.Context, now time.Time, limit int) ([]tonight.QueuedDelivery, error) {
+	due := make([]tonight.QueuedDelivery, 0)
+	err := s.s.view(ctx, func(d *data) error {
+		for _, queued := range d.queue {
+			if !queued.NextAttemptAt.After(now) {
+				due = append(due, queued)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		a, b := due[i], due[j]
+		if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(b.NextAttemptAt)
+		}
+		return uuidLess(a.UUID, b.UUID)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s WebhookStore) Dequeue(ctx context.Context, id uuid.UUID) error {
+	return s.s.update(ctx, func(d *data) error {
+		delete(d.queue, id)
+		return nil
+	})
+}
@@ -0,0 +1,295 @@
+package tonight
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// maxExcerptLength is the maximum length, in runes, of the plain-text
+// excerpt of a description.
+const maxExcerptLength = 200
+
+// maxDescriptionLength is the maximum length, in runes, of a task
+// description.
+const maxDescriptionLength = 20000
+
+// references matches the task uuids and the project slugs, made of the
+// slugified project name and the first 8 characters of its uuid.
+var references = regexp.MustCompile(
+	`\b(?:([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})|([a-z0-9]+(?:-[a-z0-9]+)*-[0-9a-f]{8}))\b`,
+)
+
+// The markdown is rendered with the goldmark defaults: raw HTML is
+// omitted and the links with a dangerous scheme, like javascript:, are
+// emptied, so the rendering is safe to display.
+var markdown = goldmark.New(
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(referenceLinker{}, 100)),
+	),
+)
+
+// projectsKey holds the slugs of the projects referenceLinker links.
+var projectsKey = parser.NewContextKey()
+
+// RenderMarkdown renders the markdown source to sanitised HTML, with
+// the task uuids linked to /tasks/<uuid> and the slugs of projects to
+// /projects/<slug>. Only the slugs set in projects are linked, the
+// other words looking like one are left as text.
+func RenderMarkdown(source string, projects map[string]bool) (string, error) {
+	pc := parser.NewContext()
+	pc.Set(projectsKey, projects)
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf, parser.WithContext(pc)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// projectReferences returns the words of the markdown source that look
+// like project slugs.
+func projectReferences(source string) []string {
+	var slugs []string
+	for _, m := range references.FindAllStringSubmatch(source, -1) {
+		if m[2] != "" {
+			slugs = append(slugs, m[2])
+		}
+	}
+	return slugs
+}
+
+// A taskResponse is a task as the API returns it, along with the HTML
+// rendering and the plain-text excerpt of its description.
+type taskResponse struct {
+	Task
+	DescriptionHTML    string `json:"description_html"`
+	DescriptionExcerpt string `json:"description_excerpt"`
+}
+
+// A releaseResponse is a release as the API returns it, its tasks
+// rendered.
+type releaseResponse struct {
+	Release
+	Tasks []taskResponse `json:"tasks"`
+}
+
+// A projectResponse is a project as the API returns it, the tasks of
+// its releases rendered.
+type projectResponse struct {
+	Project
+	Releases []releaseResponse `json:"releases"`
+}
+
+// renderTasks renders the descriptions of the tasks, with links to the
+// projects of the user they reference.
+func renderTasks(ctx context.Context, store ProjectStore, u User, tasks ...Task) ([]taskResponse, error) {
+	projects, err := referencedProjects(ctx, store, u, tasks)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := make([]taskResponse, len(tasks))
+	for i, t := range tasks {
+		if rendered[i], err = renderTask(t, projects); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// renderProject renders the descriptions of the tasks of p, like
+// renderTasks.
+func renderProject(ctx context.Context, store ProjectStore, u User, p Project) (projectResponse, error) {
+	var tasks []Task
+	for _, r := range p.Releases {
+		tasks = append(tasks, r.Tasks...)
+	}
+	projects, err := referencedProjects(ctx, store, u, tasks)
+	if err != nil {
+		return projectResponse{}, err
+	}
+
+	res := projectResponse{Project: p, Releases: make([]releaseResponse, len(p.Releases))}
+	for i, r := range p.Releases {
+		res.Releases[i] = releaseResponse{Release: r, Tasks: make([]taskResponse, len(r.Tasks))}
+		for j, t := range r.Tasks {
+			if res.Releases[i].Tasks[j], err = renderTask(t, projects); err != nil {
+				return projectResponse{}, err
+			}
+		}
+	}
+	return res, nil
+}
+
+func renderTask(t Task, projects map[string]bool) (taskResponse, error) {
+	res := taskResponse{Task: t}
+	if t.Description == "" {
+		return res, nil
+	}
+
+	html, err := RenderMarkdown(t.Description, projects)
+	if err != nil {
+		return taskResponse{}, fmt.Errorf("error rendering description of task %s: %w", t.UUID, err)
+	}
+	res.DescriptionHTML = html
+	res.DescriptionExcerpt = MarkdownExcerpt(t.Description)
+	return res, nil
+}
+
+// referencedProjects looks the project slugs of the descriptions of
+// the tasks up among the projects of the user, all at once. Only the
+// slugs found are set in the returned map.
+func referencedProjects(ctx context.Context, store ProjectStore, u User, tasks []Task) (map[string]bool, error) {
+	projects := make(map[string]bool)
+	slugs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, t := range tasks {
+		for _, slug := range projectReferences(t.Description) {
+			if !seen[slug] {
+				seen[slug] = true
+				slugs = append(slugs, slug)
+			}
+		}
+	}
+	if len(slugs) == 0 {
+		return projects, nil
+	}
+
+	found, err := store.Slugs(ctx, slugs, u)
+	if err != nil {
+		return nil, err
+	}
+	for _, slug := range found {
+		projects[slug] = true
+	}
+	return projects, nil
+}
+
+// MarkdownExcerpt returns the text of the markdown source without its
+// formatting, whitespace collapsed, cut at a word boundary to at most
+// maxExcerptLength runes.
+func MarkdownExcerpt(source string) string {
+	src := []byte(source)
+	doc := markdown.Parser().Parse(text.NewReader(src))
+
+	// The inline text is written as is, separated at the line breaks and
+	// between blocks
+	var buf strings.Builder
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock {
+				buf.WriteByte(' ')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			buf.Write(n.Segment.Value(src))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.Write(n.Value)
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				buf.Write(line.Value(src))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	excerpt := strings.Join(strings.Fields(buf.String()), " ")
+	if utf8.RuneCountInString(excerpt) <= maxExcerptLength {
+		return excerpt
+	}
+
+	runes := []rune(excerpt)[:maxExcerptLength]
+	if i := strings.LastIndex(string(runes), " "); i > 0 {
+		return string(runes)[:i] + "…"
+	}
+	return string(runes) + "…"
+}
+
+// referenceLinker turns the task uuids and the slugs of the projects
+// set in the context found in the text of a document into links. The
+// text of links and code spans is left alone.
+type referenceLinker struct{}
+
+func (referenceLinker) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	projects, _ := pc.Get(projectsKey).(map[string]bool)
+
+	var texts []*ast.Text
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Link, *ast.AutoLink, *ast.Image, *ast.CodeSpan:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			texts = append(texts, n)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, t := range texts {
+		linkReferences(t, source, projects)
+	}
+}
+
+// linkReferences splits t around the references it contains, each one
+// replaced by a link.
+func linkReferences(t *ast.Text, source []byte, projects map[string]bool) {
+	segment := t.Segment
+	matches := references.FindAllSubmatchIndex(segment.Value(source), -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	parent := t.Parent()
+	start := segment.Start
+	for _, m := range matches {
+		from, to := segment.Start+m[0], segment.Start+m[1]
+		if m[4] >= 0 && !projects[string(source[from:to])] {
+			continue
+		}
+		if from > start {
+			parent.InsertBefore(parent, t, ast.NewTextSegment(text.NewSegment(start, from)))
+		}
+
+		destination := "/projects/"
+		if m[2] >= 0 {
+			destination = "/tasks/"
+		}
+		link := ast.NewLink()
+		link.Destination = []byte(destination + string(source[from:to]))
+		link.AppendChild(link, ast.NewTextSegment(text.NewSegment(from, to)))
+		parent.InsertBefore(parent, t, link)
+
+		start = to
+	}
+
+	if start < segment.Stop {
+		// The remaining text keeps the line breaks of t
+		t.Segment = text.NewSegment(start, segment.Stop)
+		return
+	}
+	if t.SoftLineBreak() || t.HardLineBreak() {
+		t.Segment = text.NewSegment(start, start)
+		return
+	}
+	parent.RemoveChild(parent, t)
+}
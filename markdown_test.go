@@ -0,0 +1,100 @@
+package tonight
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	projects := map[string]bool{"tonight-f5214bca": true, "other-project-0a1b2c3d": true}
+	tests := map[string]struct {
+		source   string
+		expected string
+	}{
+		"markdown": {
+			source:   "Some *emphasis* and `code`",
+			expected: "<p>Some <em>emphasis</em> and <code>code</code></p>\n",
+		},
+		"raw html": {
+			source:   "<script>alert(1)</script>\n\nclick <b onclick=\"alert(1)\">me</b>",
+			expected: "<!-- raw HTML omitted -->\n<p>click <!-- raw HTML omitted -->me<!-- raw HTML omitted --></p>\n",
+		},
+		"dangerous link": {
+			source:   "[click](javascript:alert(1))",
+			expected: "<p><a href=\"\">click</a></p>\n",
+		},
+		"task uuid": {
+			source:   "Blocked by f5214bca-cad3-11f1-8713-b27170e84302.",
+			expected: "<p>Blocked by <a href=\"/tasks/f5214bca-cad3-11f1-8713-b27170e84302\">f5214bca-cad3-11f1-8713-b27170e84302</a>.</p>\n",
+		},
+		"project slug": {
+			source:   "See tonight-f5214bca\nand the *other-project-0a1b2c3d*",
+			expected: "<p>See <a href=\"/projects/tonight-f5214bca\">tonight-f5214bca</a>\nand the <em><a href=\"/projects/other-project-0a1b2c3d\">other-project-0a1b2c3d</a></em></p>\n",
+		},
+		"unknown project slug": {
+			source:   "Fixed in build-20231018, see tonight-f5214bca",
+			expected: "<p>Fixed in build-20231018, see <a href=\"/projects/tonight-f5214bca\">tonight-f5214bca</a></p>\n",
+		},
+		"code and links are left alone": {
+			source:   "`tonight-f5214bca` [tonight-f5214bca](https://example.com)",
+			expected: "<p><code>tonight-f5214bca</code> <a href=\"https://example.com\">tonight-f5214bca</a></p>\n",
+		},
+		"not a reference": {
+			source:   "tonight-f5214bcaz and tonight",
+			expected: "<p>tonight-f5214bcaz and tonight</p>\n",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			html, err := RenderMarkdown(test.source, projects)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, html)
+		})
+	}
+}
+
+func TestMarkdownExcerpt(t *testing.T) {
+	require.Equal(t, "", MarkdownExcerpt(""))
+	require.Equal(
+		t,
+		"Title Some emphasis and a link. one two fmt.Println(1)",
+		MarkdownExcerpt("# Title\n\nSome *emphasis*\nand [a link](https://example.com).\n\n- one\n- two\n\n```go\nfmt.Println(1)\n```"),
+	)
+
+	long := strings.Repeat("word ", 100)
+	excerpt := MarkdownExcerpt(long)
+	require.Equal(t, strings.Repeat("word ", 39)+"word…", excerpt)
+}
+
+func TestTaskJSON(t *testing.T) {
+	task := Task{Title: "task", Description: "**bold**"}
+
+	// The tasks themselves are marshalled without the rendering, as in
+	// the events and the snapshots
+	b, err := json.Marshal(task)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &fields))
+	require.Equal(t, "**bold**", fields["description"])
+	require.NotContains(t, fields, "description_html")
+	require.NotContains(t, fields, "description_excerpt")
+
+	res, err := renderTask(task, nil)
+	require.NoError(t, err)
+	b, err = json.Marshal(res)
+	require.NoError(t, err)
+	fields = nil
+	require.NoError(t, json.Unmarshal(b, &fields))
+	require.Equal(t, "task", fields["title"])
+	require.Equal(t, "**bold**", fields["description"])
+	require.Equal(t, "<p><strong>bold</strong></p>\n", fields["description_html"])
+	require.Equal(t, "bold", fields["description_excerpt"])
+
+	var unmarshalled Task
+	require.NoError(t, json.Unmarshal(b, &unmarshalled))
+	require.Equal(t, "**bold**", unmarshalled.Description)
+}
@@ -0,0 +1,379 @@
+// Package migrate runs the migrations of a database, written in the
+// format of shmig: one file per migration, named after its version and
+// its name, with an up and a down section. The applied migrations are
+// tracked in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	upMarker   = "-- ====  UP  ===="
+	downMarker = "-- ==== DOWN ===="
+)
+
+var fileRegexp = regexp.MustCompile(`^(\d+)-(.+)\.sql$`)
+
+// A Dialect holds what differs from one database to the other.
+type Dialect struct {
+	// CreateTable creates the schema_migrations table, with its
+	// version, name and applied_at columns, if it does not exist.
+	CreateTable string
+	// Placeholder returns the placeholder of the nth argument of a
+	// query, starting at 1.
+	Placeholder func(n int) string
+}
+
+// Question is the placeholder of MySQL and SQLite.
+func Question(n int) string { return "?" }
+
+// Dollar is the placeholder of PostgreSQL.
+func Dollar(n int) string { return fmt.Sprintf("$%d", n) }
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []string
+	Down    []string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%d-%s", m.Version, m.Name)
+}
+
+// Status is the state of a migration in the database. AppliedAt is the
+// zero time if the migration is pending.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// New returns a Migrator running on db the migrations found in the
+// .sql files at the root of fsys.
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	for _, file := range files {
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		m, err := parse(path.Base(file), string(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration %s: %w", file, err)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", migrations[i-1], migrations[i])
+		}
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func parse(file, content string) (Migration, error) {
+	matches := fileRegexp.FindStringSubmatch(file)
+	if matches == nil {
+		return Migration{}, errors.New("file name should be <version>-<name>.sql")
+	}
+	version, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return Migration{}, err
+	}
+
+	up := strings.Index(content, upMarker)
+	down := strings.Index(content, downMarker)
+	if up < 0 || down < up {
+		return Migration{}, errors.New("missing up or down section")
+	}
+
+	return Migration{
+		Version: version,
+		Name:    matches[2],
+		Up:      statements(content[up+len(upMarker) : down]),
+		Down:    statements(content[down+len(downMarker):]),
+	}, nil
+}
+
+// statements splits a section into its statements, ending with a
+// semicolon at the end of a line. The comment lines are dropped, and so
+// are BEGIN and COMMIT: the Migrator runs each migration in its own
+// transaction.
+func statements(section string) []string {
+	var stmts []string
+	var lines []string
+	for _, line := range strings.Split(section, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		lines = append(lines, line)
+		if !strings.HasSuffix(trimmed, ";") {
+			continue
+		}
+
+		stmt := strings.TrimSuffix(strings.TrimSpace(strings.Join(lines, "\n")), ";")
+		lines = nil
+		switch strings.ToUpper(stmt) {
+		case "BEGIN", "COMMIT":
+		default:
+			stmts = append(stmts, stmt)
+		}
+	}
+	if len(lines) > 0 {
+		stmts = append(stmts, strings.TrimSpace(strings.Join(lines, "\n")))
+	}
+	return stmts
+}
+
+// init creates the schema_migrations table. If it is empty and the
+// database has been migrated by shmig so far, the versions shmig
+// applied are copied into it.
+func (m *Migrator) init(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, m.dialect.CreateTable); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	var count int
+	if err := m.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM shmig_version")
+	if err != nil {
+		// No shmig table
+		return nil
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			continue
+		}
+		if _, err := m.db.ExecContext(ctx, m.insertQuery(), migration.Version, migration.Name, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) insertQuery() string {
+	return fmt.Sprintf(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+		m.dialect.Placeholder(1), m.dialect.Placeholder(2), m.dialect.Placeholder(3),
+	)
+}
+
+// Status returns the state of every migration, in the order they are
+// applied, followed by the applied migrations whose file is missing.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]Status)
+	for rows.Next() {
+		var s Status
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+		s.Applied = true
+		applied[s.Version] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := Status{Migration: migration}
+		if a, ok := applied[migration.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+
+	missing := make([]Status, 0, len(applied))
+	for _, s := range applied {
+		missing = append(missing, s)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Version < missing[j].Version })
+	return append(statuses, missing...), nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the first n pending migrations, all of them if n is not
+// positive, and returns them.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 && n < len(pending) {
+		pending = pending[:n]
+	}
+
+	for i, migration := range pending {
+		err := m.run(ctx, migration.Up, m.insertQuery(), migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return pending[:i], fmt.Errorf("error applying migration %s: %w", migration, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down reverts the last n applied migrations, and returns them. Unlike
+// in Up, n must be positive: reverting everything is never the default.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("cannot revert %d migrations, the number must be positive", n)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Status
+	for _, s := range statuses {
+		if s.Applied {
+			applied = append(applied, s)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i].Version > applied[j].Version })
+	if n < len(applied) {
+		applied = applied[:n]
+	}
+
+	reverted := make([]Migration, 0, len(applied))
+	for _, s := range applied {
+		migration, ok := m.find(s.Version)
+		if !ok {
+			return reverted, fmt.Errorf("cannot revert migration %s: file not found", s.Migration)
+		}
+
+		query := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %s", m.dialect.Placeholder(1))
+		if err := m.run(ctx, migration.Down, query, migration.Version); err != nil {
+			return reverted, fmt.Errorf("error reverting migration %s: %w", migration, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// Redo reverts the last applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	reverted, err := m.Down(ctx, 1)
+	if err != nil {
+		return Migration{}, err
+	}
+	if len(reverted) == 0 {
+		return Migration{}, errors.New("no migration to redo")
+	}
+
+	migration := reverted[0]
+	err = m.run(ctx, migration.Up, m.insertQuery(), migration.Version, migration.Name, time.Now().UTC())
+	if err != nil {
+		return Migration{}, fmt.Errorf("error applying migration %s: %w", migration, err)
+	}
+	return migration, nil
+}
+
+// run executes stmts then query in a transaction. MySQL commits the
+// schema changes implicitly though, so a migration failing there can be
+// left half applied.
+func (m *Migrator) run(ctx context.Context, stmts []string, query string, args ...interface{}) (err error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,193 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+var testDialect = Dialect{
+	CreateTable: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER NOT NULL PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME NOT NULL
+)`,
+	Placeholder: Question,
+}
+
+var testMigrations = fstest.MapFS{
+	"1-users.sql": {Data: []byte(`-- Migration: users
+-- Created at: 2020-01-01 00:00:00
+-- ====  UP  ====
+
+BEGIN;
+
+CREATE TABLE users (
+    id TEXT NOT NULL
+);
+
+-- Seeded for the test
+INSERT INTO users (id) VALUES ('a');
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP TABLE users;
+
+COMMIT;
+`)},
+	"2-projects.sql": {Data: []byte(`-- Migration: projects
+-- ====  UP  ====
+BEGIN;
+CREATE TABLE projects (uuid TEXT NOT NULL);
+INSERT INTO projects (uuid) SELECT id FROM users;
+COMMIT;
+-- ==== DOWN ====
+BEGIN;
+DROP TABLE projects;
+COMMIT;
+`)},
+}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// Every connection has its own in-memory database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func applied(t *testing.T, m *Migrator) []string {
+	statuses, err := m.Status(context.Background())
+	require.NoError(t, err)
+
+	var names []string
+	for _, s := range statuses {
+		if s.Applied {
+			require.False(t, s.AppliedAt.IsZero())
+			names = append(names, s.String())
+		}
+	}
+	return names
+}
+
+func TestParse(t *testing.T) {
+	m, err := parse("1-users.sql", string(testMigrations["1-users.sql"].Data))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), m.Version)
+	require.Equal(t, "users", m.Name)
+	require.Equal(t, []string{
+		"CREATE TABLE users (\n    id TEXT NOT NULL\n)",
+		"INSERT INTO users (id) VALUES ('a')",
+	}, m.Up)
+	require.Equal(t, []string{"DROP TABLE users"}, m.Down)
+
+	_, err = parse("users.sql", "")
+	require.Error(t, err)
+	_, err = parse("1-users.sql", "-- ==== DOWN ====")
+	require.Error(t, err)
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	defer db.Close()
+
+	m, err := New(db, testDialect, testMigrations)
+	require.NoError(t, err)
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	migrations, err := m.Up(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	require.Equal(t, []string{"1-users"}, applied(t, m))
+
+	migrations, err = m.Up(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	require.Equal(t, []string{"1-users", "2-projects"}, applied(t, m))
+
+	var id string
+	require.NoError(t, db.QueryRow("SELECT uuid FROM projects").Scan(&id))
+	require.Equal(t, "a", id)
+
+	migration, err := m.Redo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2-projects", migration.String())
+	require.Equal(t, []string{"1-users", "2-projects"}, applied(t, m))
+
+	for _, n := range []int{0, -1} {
+		migrations, err = m.Down(ctx, n)
+		require.Error(t, err, n)
+		require.Empty(t, migrations, n)
+		require.Equal(t, []string{"1-users", "2-projects"}, applied(t, m), n)
+	}
+
+	migrations, err = m.Down(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	require.Empty(t, applied(t, m))
+	_, err = db.Exec("SELECT * FROM users")
+	require.Error(t, err)
+
+	_, err = m.Redo(ctx)
+	require.Error(t, err)
+}
+
+func TestMigrator_failure(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	defer db.Close()
+
+	fsys := fstest.MapFS{
+		"1-users.sql": testMigrations["1-users.sql"],
+		"2-broken.sql": {Data: []byte(`-- ====  UP  ====
+CREATE TABLE broken (id TEXT);
+INSERT INTO unknown VALUES (1);
+-- ==== DOWN ====
+DROP TABLE broken;
+`)},
+	}
+	m, err := New(db, testDialect, fsys)
+	require.NoError(t, err)
+
+	migrations, err := m.Up(ctx, 0)
+	require.Error(t, err)
+	require.Len(t, migrations, 1)
+	require.Equal(t, []string{"1-users"}, applied(t, m))
+
+	// The failed migration is rolled back
+	_, err = db.Exec("SELECT * FROM broken")
+	require.Error(t, err)
+}
+
+func TestMigrator_shmig(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	defer db.Close()
+
+	_, err := db.Exec("CREATE TABLE shmig_version (version INT NOT NULL, migrated_at DATETIME NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO shmig_version VALUES (1, CURRENT_TIMESTAMP)")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE users (id TEXT NOT NULL)")
+	require.NoError(t, err)
+
+	m, err := New(db, testDialect, testMigrations)
+	require.NoError(t, err)
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, "2-projects", pending[0].String())
+}
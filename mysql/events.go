@@ -3,6 +3,11 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
 
 	"github.com/bobinette/tonight"
 )
@@ -17,25 +22,172 @@ func NewEventStore(db *sql.DB) EventStore {
 
 func (s EventStore) Store(ctx context.Context, e tonight.Event) error {
 	query := `
-INSERT INTO events (uuid, type, entity_uuid, user_id, payload, created_at)
-VALUES (?, ?, ?, ?, ?, ?)
+INSERT INTO events (uuid, type, entity_uuid, project_uuid, user_id, correlation_id, payload, schema_version, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
-	_, err := s.db.ExecContext(
+	var projectUUID sql.NullString
+	if e.ProjectUUID != uuid.Nil {
+		projectUUID = sql.NullString{String: e.ProjectUUID.String(), Valid: true}
+	}
+	var correlationID sql.NullString
+	if e.CorrelationID != uuid.Nil {
+		correlationID = sql.NullString{String: e.CorrelationID.String(), Valid: true}
+	}
+
+	_, err := conn(ctx, s.db).ExecContext(
 		ctx,
 		query,
 		e.UUID,
 		e.Type,
 		e.EntityUUID,
+		projectUUID,
 		e.UserID,
+		correlationID,
 		e.Payload,
+		e.SchemaVersion,
 		e.CreatedAt,
 	)
+	if isDuplicateEntry(err) {
+		return fmt.Errorf("event %s already exists: %w", e.UUID, tonight.ErrDuplicateEvent)
+	}
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s EventStore) List(ctx context.Context, ch chan<- tonight.Event) error {
-	return nil
+func (s EventStore) List(ctx context.Context, filter tonight.EventFilter, ch chan<- tonight.Event) error {
+	defer close(ch)
+
+	where, args := eventFilterClause(filter)
+	order := "ORDER BY created_at, uuid"
+	if filter.Reverse {
+		order = "ORDER BY created_at DESC, uuid DESC"
+	}
+	// MySQL only accepts an offset after a limit
+	limit := ""
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit = "LIMIT ?, ?"
+		count := int64(filter.Limit)
+		if filter.Limit <= 0 {
+			count = math.MaxInt64
+		}
+		args = append(args, filter.Offset, count)
+	}
+	query := fmt.Sprintf(`
+SELECT uuid, type, entity_uuid, project_uuid, user_id, correlation_id, payload, schema_version, created_at
+FROM events
+%s
+%s
+%s
+`, where, order, limit)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e tonight.Event
+		// The events recorded before the entity uuids have an empty one
+		var entityUUID string
+		var projectUUID, userID, correlationID sql.NullString
+		err := rows.Scan(
+			&e.UUID,
+			&e.Type,
+			&entityUUID,
+			&projectUUID,
+			&userID,
+			&correlationID,
+			&e.Payload,
+			&e.SchemaVersion,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		e.UserID = userID.String
+		if entityUUID != "" {
+			if e.EntityUUID, err = uuid.FromString(entityUUID); err != nil {
+				return err
+			}
+		}
+		if projectUUID.Valid {
+			if e.ProjectUUID, err = uuid.FromString(projectUUID.String); err != nil {
+				return err
+			}
+		}
+		if correlationID.Valid {
+			if e.CorrelationID, err = uuid.FromString(correlationID.String); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case ch <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+func eventFilterClause(filter tonight.EventFilter) (string, []interface{}) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		qArgs, typeArgs := prepareArgs(types)
+		conditions = append(conditions, fmt.Sprintf("type IN %s", qArgs...))
+		args = append(args, typeArgs...)
+	}
+
+	if len(filter.EntityUUIDs) > 0 {
+		uuids := make([]string, len(filter.EntityUUIDs))
+		for i, id := range filter.EntityUUIDs {
+			uuids[i] = id.String()
+		}
+		qArgs, uuidArgs := prepareArgs(uuids)
+		conditions = append(conditions, fmt.Sprintf("entity_uuid IN %s", qArgs...))
+		args = append(args, uuidArgs...)
+	}
+
+	if filter.ProjectUUID != uuid.Nil {
+		conditions = append(conditions, "project_uuid = ?")
+		args = append(args, filter.ProjectUUID)
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+
+	if filter.CorrelationID != uuid.Nil {
+		conditions = append(conditions, "correlation_id = ?")
+		args = append(args, filter.CorrelationID.String())
+	}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since)
+	}
+
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.Until)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
 }
@@ -0,0 +1,35 @@
+package mysql
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/bobinette/tonight/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+var dialect = migrate.Dialect{
+	CreateTable: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    applied_at DATETIME NOT NULL,
+
+    PRIMARY KEY (version)
+)
+ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci`,
+	Placeholder: migrate.Question,
+}
+
+// NewMigrator returns a migrator running the migrations of the
+// migrations directory, which are embedded in the binary.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, dialect, fsys)
+}
@@ -0,0 +1,23 @@
+-- Migration: event-list
+-- Created at: 2026-10-18 07:50:20
+-- ====  UP  ====
+
+BEGIN;
+
+ALTER TABLE `events`
+    MODIFY COLUMN `created_at` DATETIME(6) NOT NULL,
+    ADD INDEX `idx_event_entity_uuid` (`entity_uuid`),
+    ADD INDEX `idx_event_created_at` (`created_at`);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `events`
+    DROP INDEX `idx_event_created_at`,
+    DROP INDEX `idx_event_entity_uuid`,
+    MODIFY COLUMN `created_at` DATETIME NOT NULL;
+
+COMMIT;
@@ -0,0 +1,48 @@
+-- Migration: entity-versions
+-- Created at: 2026-10-18 08:30:45
+-- ====  UP  ====
+
+BEGIN;
+
+ALTER TABLE `projects`
+    ADD COLUMN `version` INT NOT NULL DEFAULT 0 AFTER `description`;
+
+ALTER TABLE `releases`
+    ADD COLUMN `version` INT NOT NULL DEFAULT 0 AFTER `description`;
+
+ALTER TABLE `tasks`
+    ADD COLUMN `version` INT NOT NULL DEFAULT 0 AFTER `status`;
+
+-- Backlogs share the uuid of their project, so the events are
+-- counted by kind of entity.
+UPDATE projects SET version = (
+    SELECT COUNT(*) FROM events
+    WHERE events.entity_uuid = projects.uuid AND events.type LIKE 'Project%'
+);
+
+UPDATE releases SET version = (
+    SELECT COUNT(*) FROM events
+    WHERE events.entity_uuid = releases.uuid AND events.type LIKE 'Release%'
+);
+
+UPDATE tasks SET version = (
+    SELECT COUNT(*) FROM events
+    WHERE events.entity_uuid = tasks.uuid AND events.type LIKE 'Task%'
+);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `tasks`
+    DROP COLUMN `version`;
+
+ALTER TABLE `releases`
+    DROP COLUMN `version`;
+
+ALTER TABLE `projects`
+    DROP COLUMN `version`;
+
+COMMIT;
@@ -0,0 +1,36 @@
+-- Migration: event-project
+-- Created at: 2026-10-18 08:55:00
+-- ====  UP  ====
+
+BEGIN;
+
+ALTER TABLE `events`
+    ADD COLUMN `project_uuid` VARCHAR(36) NULL DEFAULT NULL AFTER `entity_uuid`,
+    ADD INDEX `idx_event_project_uuid` (`project_uuid`);
+
+UPDATE events
+SET project_uuid = entity_uuid
+WHERE type LIKE 'Project%';
+
+UPDATE events
+JOIN releases ON releases.uuid = events.entity_uuid
+SET events.project_uuid = releases.project_uuid
+WHERE events.type LIKE 'Release%';
+
+UPDATE events
+JOIN tasks ON tasks.uuid = events.entity_uuid
+JOIN releases ON releases.uuid = tasks.release_uuid
+SET events.project_uuid = releases.project_uuid
+WHERE events.type LIKE 'Task%';
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `events`
+    DROP INDEX `idx_event_project_uuid`,
+    DROP COLUMN `project_uuid`;
+
+COMMIT;
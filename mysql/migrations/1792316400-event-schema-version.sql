@@ -0,0 +1,20 @@
+-- Migration: event-schema-version
+-- Created at: 2026-10-18 09:40:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Events recorded so far all use the first version of their schema
+ALTER TABLE `events`
+    ADD COLUMN `schema_version` INT NOT NULL DEFAULT 1 AFTER `payload`;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `events`
+    DROP COLUMN `schema_version`;
+
+COMMIT;
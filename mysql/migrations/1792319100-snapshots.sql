@@ -0,0 +1,31 @@
+-- Migration: snapshots
+-- Created at: 2026-10-18 10:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS `snapshots` (
+    `project_uuid` VARCHAR(36) NOT NULL,
+
+    `event_uuid` VARCHAR(36) NOT NULL,
+    `event_created_at` DATETIME(6) NOT NULL,
+    `events` INT NOT NULL,
+
+    `state` LONGTEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`project_uuid`, `event_uuid`),
+    INDEX `idx_snapshot_project_event_created_at` (`project_uuid`, `event_created_at`)
+)
+ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP TABLE `snapshots`;
+
+COMMIT;
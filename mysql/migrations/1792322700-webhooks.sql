@@ -0,0 +1,67 @@
+-- Migration: webhooks
+-- Created at: 2026-10-18 11:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+    `uuid` VARCHAR(36) NOT NULL,
+    `project_uuid` VARCHAR(36) NOT NULL,
+
+    `url` TEXT NOT NULL,
+    `secret` VARCHAR(255) NOT NULL,
+    -- JSON array of event types, all of them if empty
+    `types` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+)
+ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS `webhook_queue` (
+    `uuid` VARCHAR(36) NOT NULL,
+    `webhook_uuid` VARCHAR(36) NOT NULL,
+
+    `event` MEDIUMTEXT NOT NULL,
+    `attempt` INT NOT NULL,
+    `next_attempt_at` DATETIME(6) NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    INDEX `idx_webhook_queue_next_attempt_at` (`next_attempt_at`),
+    FOREIGN KEY (`webhook_uuid`) REFERENCES `webhooks` (`uuid`) ON DELETE CASCADE
+)
+ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `uuid` VARCHAR(36) NOT NULL,
+    `webhook_uuid` VARCHAR(36) NOT NULL,
+
+    `event_uuid` VARCHAR(36) NOT NULL,
+    `event_type` VARCHAR(255) NOT NULL,
+    `attempt` INT NOT NULL,
+
+    `status_code` INT NOT NULL,
+    `error` TEXT NOT NULL,
+
+    `created_at` DATETIME(6) NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    INDEX `idx_webhook_delivery_created_at` (`webhook_uuid`, `created_at`),
+    FOREIGN KEY (`webhook_uuid`) REFERENCES `webhooks` (`uuid`) ON DELETE CASCADE
+)
+ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_general_ci;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP TABLE `webhook_deliveries`;
+DROP TABLE `webhook_queue`;
+DROP TABLE `webhooks`;
+
+COMMIT;
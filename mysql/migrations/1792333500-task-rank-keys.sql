@@ -0,0 +1,38 @@
+-- Migration: task-rank-keys
+-- Created at: 2026-10-18 14:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Ranks are lexicographic keys, compared byte by byte
+ALTER TABLE `tasks`
+    ADD COLUMN `rank_key` VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NULL DEFAULT NULL AFTER `rank`;
+
+UPDATE `tasks` SET `rank_key` = CONCAT(LPAD(`rank`, 5, '0'), 'i') WHERE `rank` IS NOT NULL;
+
+ALTER TABLE `tasks`
+    DROP COLUMN `rank`,
+    CHANGE COLUMN `rank_key` `rank` VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin NULL DEFAULT NULL;
+
+-- The snapshots hold integer ranks, they are rebuilt from the events
+DELETE FROM `snapshots`;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `tasks`
+    ADD COLUMN `rank_int` SMALLINT NULL DEFAULT NULL AFTER `rank`;
+
+-- Only the ranks converted by the UP migration can be restored
+UPDATE `tasks` SET `rank_int` = CAST(LEFT(`rank`, 5) AS UNSIGNED) WHERE `rank` REGEXP '^[0-9]{5}i$';
+
+ALTER TABLE `tasks`
+    DROP COLUMN `rank`,
+    CHANGE COLUMN `rank_int` `rank` SMALLINT NULL DEFAULT NULL;
+
+DELETE FROM `snapshots`;
+
+COMMIT;
@@ -0,0 +1,38 @@
+-- Migration: soft-delete
+-- Created at: 2026-10-18 15:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Deleted entities stay in the trash until they are purged
+ALTER TABLE `projects`
+    ADD COLUMN `deleted_at` DATETIME NULL DEFAULT NULL AFTER `updated_at`,
+    ADD INDEX `idx_project_deleted_at` (`deleted_at`);
+
+ALTER TABLE `releases`
+    ADD COLUMN `deleted_at` DATETIME NULL DEFAULT NULL AFTER `updated_at`,
+    ADD INDEX `idx_release_deleted_at` (`deleted_at`);
+
+ALTER TABLE `tasks`
+    ADD COLUMN `deleted_at` DATETIME NULL DEFAULT NULL AFTER `updated_at`,
+    ADD INDEX `idx_task_deleted_at` (`deleted_at`);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `tasks`
+    DROP INDEX `idx_task_deleted_at`,
+    DROP COLUMN `deleted_at`;
+
+ALTER TABLE `releases`
+    DROP INDEX `idx_release_deleted_at`,
+    DROP COLUMN `deleted_at`;
+
+ALTER TABLE `projects`
+    DROP INDEX `idx_project_deleted_at`,
+    DROP COLUMN `deleted_at`;
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Migration: event-correlation
+-- Created at: 2026-10-18 16:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Events recorded by the same request, a bulk one for instance, share
+-- a correlation id
+ALTER TABLE `events`
+    ADD COLUMN `correlation_id` VARCHAR(36) NULL DEFAULT NULL AFTER `user_id`,
+    ADD INDEX `idx_event_correlation_id` (`correlation_id`);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `events`
+    DROP INDEX `idx_event_correlation_id`,
+    DROP COLUMN `correlation_id`;
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Migration: task-description
+-- Created at: 2026-10-18 17:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- The description of a task is markdown
+ALTER TABLE `tasks`
+    ADD COLUMN `description` TEXT NOT NULL  AFTER `title`;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+ALTER TABLE `tasks`
+    DROP COLUMN `description`;
+
+COMMIT;
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -33,6 +34,11 @@ func TestStores(t *testing.T) {
 		"tonight_v2_test",
 	))
 	require.NoError(t, err)
+
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background(), 0)
+	require.NoError(t, err)
 	defer func() {
 		var err error
 		_, err = db.Exec("DELETE FROM projects")
@@ -42,8 +48,15 @@ func TestStores(t *testing.T) {
 		require.NoError(t, db.Close())
 	}()
 
-	projectStore := NewProjectStore(db)
-	taskStore := NewTaskStore(db)
-	userStore := NewUserStore(db)
-	tonighttest.TestStores(t, projectStore, taskStore, userStore)
+	tonighttest.TestStores(t, tonighttest.Stores{
+		Transactor:    NewTransactor(db),
+		EventStore:    NewEventStore(db),
+		ProjectStore:  NewProjectStore(db),
+		ReleaseStore:  NewReleaseStore(db),
+		TaskStore:     NewTaskStore(db),
+		UserStore:     NewUserStore(db),
+		SnapshotStore: NewSnapshotStore(db),
+		WebhookStore:  NewWebhookStore(db),
+		TrashStore:    NewTrashStore(db),
+	})
 }
@@ -18,53 +18,65 @@ func NewReleaseStore(db *sql.DB) ReleaseStore {
 }
 
 func (s ReleaseStore) Get(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	release, err := s.Head(ctx, id)
+	if err != nil {
+		return tonight.Release{}, err
+	}
+
+	tasks, err := s.loadTasks(ctx, []string{release.UUID.String()})
+	if err != nil {
+		return tonight.Release{}, err
+	}
+
+	release.Tasks = tasks[release.UUID.String()]
+	if release.Tasks == nil {
+		release.Tasks = make([]tonight.Task, 0)
+	}
+
+	return release, nil
+}
+
+func (s ReleaseStore) Head(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
 	query := `
-SELECT uuid, title, description, project_uuid, created_at, updated_at
+SELECT releases.uuid, releases.title, releases.description, releases.version, releases.project_uuid, releases.created_at, releases.updated_at
 FROM releases
-WHERE uuid = ?
+JOIN projects ON projects.uuid = releases.project_uuid
+WHERE releases.uuid = ? AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
 `
 
-	row := s.db.QueryRowContext(ctx, query, id)
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, id)
 	var release tonight.Release
 	err := row.Scan(
 		&release.UUID,
 		&release.Title,
 		&release.Description,
+		&release.Version,
 		&release.Project.UUID,
 		&release.CreatedAt,
 		&release.UpdatedAt,
 	)
 	if err != nil {
-		return tonight.Release{}, err
-	}
-
-	tasks, err := s.loadTasks(ctx, []string{release.UUID.String()})
-	if err != nil {
-		return tonight.Release{}, err
-	}
-
-	release.Tasks = tasks[release.UUID.String()]
-	if release.Tasks == nil {
-		release.Tasks = make([]tonight.Task, 0)
+		return tonight.Release{}, notFound(err, "release", id)
 	}
 
+	release.Tasks = make([]tonight.Task, 0)
 	return release, nil
 }
 
 func (s ReleaseStore) List(ctx context.Context, projectUUID uuid.UUID) ([]tonight.Release, error) {
 	query := `
-SELECT uuid, title, description, project_uuid, created_at, updated_at
+SELECT releases.uuid, releases.title, releases.description, releases.version, releases.project_uuid, releases.created_at, releases.updated_at
 FROM releases
-WHERE project_uuid = ?
+JOIN projects ON projects.uuid = releases.project_uuid
+WHERE releases.project_uuid = ? AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
 ORDER BY
-	CASE WHEN project_uuid = uuid
+	CASE WHEN releases.project_uuid = releases.uuid
 	THEN 1
-	OTHER 0
-	END
-	ASC,
-	title ASC
+	ELSE 0
+	END ASC,
+	releases.title ASC
 `
-	rows, err := s.db.QueryContext(ctx, query, projectUUID)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, projectUUID)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +90,7 @@ ORDER BY
 			&release.UUID,
 			&release.Title,
 			&release.Description,
+			&release.Version,
 			&release.Project.UUID,
 			&release.CreatedAt,
 			&release.UpdatedAt,
@@ -113,28 +126,45 @@ ORDER BY
 }
 
 func (s ReleaseStore) Upsert(ctx context.Context, release tonight.Release) error {
+	if release.Version == 0 {
+		query := `
+INSERT INTO releases (uuid, title, description, version, project_uuid, created_at, updated_at)
+VALUE (?, ?, ?, 1, ?, ?, ?)
+`
+		_, err := conn(ctx, s.db).ExecContext(
+			ctx,
+			query,
+			release.UUID,
+			release.Title,
+			release.Description,
+			release.Project.UUID,
+			release.CreatedAt,
+			release.UpdatedAt,
+		)
+		if isDuplicateEntry(err) {
+			return fmt.Errorf("release %s already exists: %w", release.UUID, tonight.ErrVersionConflict)
+		}
+		return err
+	}
+
 	query := `
-	INSERT INTO releases (uuid, title, description, project_uuid, created_at, updated_at)
-	VALUE (?, ?, ?, ?, ?, ?)
-	ON DUPLICATE KEY UPDATE
-		title = ?
-	`
-	_, err := s.db.ExecContext(
+UPDATE releases
+SET title = ?, description = ?, updated_at = ?, version = version + 1
+WHERE uuid = ? AND version = ?
+`
+	res, err := conn(ctx, s.db).ExecContext(
 		ctx,
 		query,
-		release.UUID,
 		release.Title,
 		release.Description,
-		release.Project.UUID,
-		release.CreatedAt,
 		release.UpdatedAt,
-		release.Title,
+		release.UUID,
+		release.Version,
 	)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return checkVersion(res, "release", release.UUID)
 }
 
 func (s ReleaseStore) loadTasks(ctx context.Context, uuids []string) (map[string][]tonight.Task, error) {
@@ -144,12 +174,12 @@ func (s ReleaseStore) loadTasks(ctx context.Context, uuids []string) (map[string
 
 	qArgs, args := prepareArgs(uuids)
 	query := fmt.Sprintf(`
-SELECT uuid, title, status, release_uuid, created_at, updated_at
+SELECT uuid, title, description, status, version, rank, release_uuid, created_at, updated_at
 FROM tasks
-WHERE release_uuid IN %s
-ORDER BY -rank DESC, created_at
+WHERE release_uuid IN %s AND deleted_at IS NULL
+ORDER BY rank IS NULL, rank, created_at, uuid
 `, qArgs...)
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -158,11 +188,15 @@ ORDER BY -rank DESC, created_at
 	tasksByProjectUUID := make(map[string][]tonight.Task)
 	for rows.Next() {
 		var t tonight.Task
+		var rank sql.NullString
 		var projectUUID string
 		err := rows.Scan(
 			&t.UUID,
 			&t.Title,
+			&t.Description,
 			&t.Status,
+			&t.Version,
+			&rank,
 			&projectUUID,
 			&t.CreatedAt,
 			&t.UpdatedAt,
@@ -170,6 +204,7 @@ ORDER BY -rank DESC, created_at
 		if err != nil {
 			return nil, err
 		}
+		t.Rank = rank.String
 
 		tasksByProjectUUID[projectUUID] = append(tasksByProjectUUID[projectUUID], t)
 	}
@@ -3,6 +3,7 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"fmt"
 
 	uuid "github.com/satori/go.uuid"
 
@@ -18,74 +19,176 @@ func NewTaskStore(db *sql.DB) TaskStore {
 }
 
 func (s TaskStore) Upsert(ctx context.Context, t tonight.Task) error {
+	if t.Version == 0 {
+		query := `
+INSERT INTO tasks (uuid, title, description, status, version, release_uuid, created_at, updated_at)
+VALUE (?, ?, ?, ?, 1, ?, ?, ?)
+`
+		_, err := conn(ctx, s.db).ExecContext(
+			ctx,
+			query,
+			t.UUID,
+			t.Title,
+			t.Description,
+			t.Status,
+			t.Release.UUID,
+			t.CreatedAt,
+			t.UpdatedAt,
+		)
+		if isDuplicateEntry(err) {
+			return fmt.Errorf("task %s already exists: %w", t.UUID, tonight.ErrVersionConflict)
+		}
+		return err
+	}
+
+	// A task moved to another release loses its rank, the rank is
+	// updated first to compare with the previous release
 	query := `
-INSERT INTO tasks (uuid, title, status, release_uuid, created_at, updated_at)
-VALUE (?, ?, ?, ?, ?, ?)
-ON DUPLICATE KEY UPDATE
-	status = ?,
-	title = ?
+UPDATE tasks
+SET status = ?, title = ?, description = ?, rank = CASE WHEN release_uuid = ? THEN rank ELSE NULL END, release_uuid = ?, version = version + 1
+WHERE uuid = ? AND version = ?
 `
-	_, err := s.db.ExecContext(
+	res, err := conn(ctx, s.db).ExecContext(
 		ctx,
 		query,
-		t.UUID,
-		t.Title,
-		t.Status,
-		t.Release.UUID,
-		t.CreatedAt,
-		t.UpdatedAt,
 		t.Status,
 		t.Title,
+		t.Description,
+		t.Release.UUID,
+		t.Release.UUID,
+		t.UUID,
+		t.Version,
 	)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return checkVersion(res, "task", t.UUID)
 }
 
 func (s TaskStore) Get(ctx context.Context, uuid uuid.UUID, user tonight.User) (tonight.Task, error) {
 	query := `
-SELECT tasks.uuid, tasks.title, tasks.status, tasks.release_uuid, tasks.created_at, tasks.updated_at
+SELECT tasks.uuid, tasks.title, tasks.description, tasks.status, tasks.version, tasks.rank, tasks.release_uuid, tasks.created_at, tasks.updated_at
 FROM tasks
 JOIN releases ON releases.uuid = tasks.release_uuid
+JOIN projects ON projects.uuid = releases.project_uuid
 JOIN user_permission_on_project ON user_permission_on_project.project_uuid = releases.project_uuid
 WHERE user_permission_on_project.user_id = ? AND tasks.uuid = ?
+AND tasks.deleted_at IS NULL AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
 `
-	row := s.db.QueryRowContext(ctx, query, user.ID, uuid)
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, user.ID, uuid)
 	var t tonight.Task
+	var rank sql.NullString
 	err := row.Scan(
 		&t.UUID,
 		&t.Title,
+		&t.Description,
 		&t.Status,
+		&t.Version,
+		&rank,
 		&t.Release.UUID,
 		&t.CreatedAt,
 		&t.UpdatedAt,
 	)
 	if err != nil {
-		return tonight.Task{}, err
+		return tonight.Task{}, notFound(err, "task", uuid)
 	}
+	t.Rank = rank.String
 	return t, nil
 }
 
-func (s TaskStore) Reorder(ctx context.Context, rankedUUIDs []uuid.UUID) (err error) {
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+func (s TaskStore) Rank(ctx context.Context, ranks map[uuid.UUID]string) error {
+	return withTx(ctx, s.db, func(tx querier) error {
+		query := "UPDATE tasks SET rank = ? WHERE uuid = ?"
+		for taskUUID, rank := range ranks {
+			// An empty rank unranks the task
+			value := sql.NullString{String: rank, Valid: rank != ""}
+			if _, err := tx.ExecContext(ctx, query, value, taskUUID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s TaskStore) List(ctx context.Context, releaseUUID uuid.UUID, filter tonight.TaskFilter) ([]tonight.Task, error) {
+	query := `
+SELECT tasks.uuid, tasks.title, tasks.description, tasks.status, tasks.version, tasks.rank, tasks.release_uuid, tasks.created_at, tasks.updated_at
+FROM tasks
+`
+	args := make([]interface{}, 0)
+	where := "WHERE tasks.release_uuid = ? AND tasks.deleted_at IS NULL\n"
+	if filter.After != uuid.Nil {
+		// The page starts after the task of the cursor, in the order
+		// of the list: ranked tasks first, then the unranked ones
+		query += "JOIN tasks AS cursor_task ON cursor_task.uuid = ?\n"
+		args = append(args, filter.After)
+		where += "AND " + afterCursorTask
 	}
-	defer func() {
-		e := tx.Rollback()
-		if err == nil && e != sql.ErrTxDone {
-			err = e
+	args = append(args, releaseUUID)
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
 		}
-	}()
+		qArgs, statusArgs := prepareArgs(statuses)
+		where += fmt.Sprintf("AND tasks.status IN %s\n", qArgs...)
+		args = append(args, statusArgs...)
+	}
+	query += where + "ORDER BY tasks.rank IS NULL, tasks.rank, tasks.created_at, tasks.uuid\n"
+	if filter.Limit > 0 {
+		query += "LIMIT ?\n"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	query := "UPDATE tasks SET rank = ? WHERE uuid = ?"
-	for rank, taskUUID := range rankedUUIDs {
-		if _, err := tx.ExecContext(ctx, query, rank, taskUUID); err != nil {
-			return err
+	tasks := make([]tonight.Task, 0)
+	for rows.Next() {
+		var t tonight.Task
+		var rank sql.NullString
+		err := rows.Scan(
+			&t.UUID,
+			&t.Title,
+			&t.Description,
+			&t.Status,
+			&t.Version,
+			&rank,
+			&t.Release.UUID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
 		}
+		t.Rank = rank.String
+
+		tasks = append(tasks, t)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	return tasks, nil
 }
+
+// afterCursorTask selects the tasks coming after cursor_task.
+const afterCursorTask = `(
+	(cursor_task.rank IS NOT NULL AND (
+		tasks.rank IS NULL
+		OR tasks.rank > cursor_task.rank
+		OR (tasks.rank = cursor_task.rank AND (
+			tasks.created_at > cursor_task.created_at
+			OR (tasks.created_at = cursor_task.created_at AND tasks.uuid > cursor_task.uuid)
+		))
+	))
+	OR (cursor_task.rank IS NULL AND tasks.rank IS NULL AND (
+		tasks.created_at > cursor_task.created_at
+		OR (tasks.created_at = cursor_task.created_at AND tasks.uuid > cursor_task.uuid)
+	))
+)
+`
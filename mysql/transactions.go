@@ -0,0 +1,65 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+)
+
+type txKey struct{}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn returns the transaction started by a Transactor if ctx
+// carries one, db otherwise.
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// withTx runs f in the transaction carried by ctx if any, or in a new
+// one that is committed when f succeeds.
+func withTx(ctx context.Context, db *sql.DB, f func(q querier) error) (err error) {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return f(tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		e := tx.Rollback()
+		if err == nil && e != sql.ErrTxDone {
+			err = e
+		}
+	}()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type Transactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) Transactor {
+	return Transactor{db: db}
+}
+
+// Transaction runs f in a transaction. Nested calls take part in the
+// outermost transaction.
+func (t Transactor) Transaction(ctx context.Context, f func(ctx context.Context) error) error {
+	return withTx(ctx, t.db, func(q querier) error {
+		return f(context.WithValue(ctx, txKey{}, q))
+	})
+}
@@ -1,10 +1,47 @@
 package mysql
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+
+	driver "github.com/go-sql-driver/mysql"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
 )
 
+// checkVersion returns tonight.ErrVersionConflict if the update whose
+// result is res, conditioned on the version of the entity, did not
+// modify anything.
+func checkVersion(res sql.Result, kind string, id uuid.UUID) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s: %w", kind, id, tonight.ErrVersionConflict)
+	}
+	return nil
+}
+
+// notFound returns tonight.ErrNotFound if err, the error of looking up
+// the entity kind identified by key, is sql.ErrNoRows.
+func notFound(err error, kind string, key interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s %v: %w", kind, key, tonight.ErrNotFound)
+	}
+	return err
+}
+
+// isDuplicateEntry returns true if err is due to a duplicate primary or
+// unique key.
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *driver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
 func prepareArgs(params ...interface{}) ([]interface{}, []interface{}) {
 	qArgs := make([]interface{}, 0)
 	args := make([]interface{}, 0)
@@ -24,3 +61,16 @@ func prepareArgs(params ...interface{}) ([]interface{}, []interface{}) {
 	}
 	return qArgs, args
 }
+
+// checkFound returns tonight.ErrNotFound if the statement whose result
+// is res did not modify anything.
+func checkFound(res sql.Result, kind string, id uuid.UUID) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s: %w", kind, id, tonight.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package tonight
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// encodeCursor returns the cursor of the page starting after the entity
+// identified by id. Cursors are opaque to the clients, they are sent
+// back as they were received.
+func encodeCursor(id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString(id.Bytes())
+}
+
+func decodeCursor(cursor string) (uuid.UUID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return uuid.Nil, invalid("cursor", "is invalid")
+	}
+	id, err := uuid.FromBytes(b)
+	if err != nil {
+		return uuid.Nil, invalid("cursor", "is invalid")
+	}
+	return id, nil
+}
+
+// pageParams returns the cursor and the limit of the page requested.
+func pageParams(c echo.Context) (uuid.UUID, int, error) {
+	after := uuid.Nil
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		id, err := decodeCursor(cursor)
+		if err != nil {
+			return uuid.Nil, 0, err
+		}
+		after = id
+	}
+
+	limit := defaultPageLimit
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			return uuid.Nil, 0, invalid("limit", "should be between 1 and %d, got %q", maxPageLimit, param)
+		}
+		limit = parsed
+	}
+
+	return after, limit, nil
+}
+
+// pagination returns the pagination of a page of n entities, fetched
+// with one more than the limit to know whether there are more. last is
+// the id of the last entity of the page.
+func pagination(limit, n int, last uuid.UUID) map[string]interface{} {
+	p := map[string]interface{}{
+		"limit":    limit,
+		"has_more": n > limit,
+	}
+	if n > limit {
+		p["next"] = encodeCursor(last)
+	}
+	return p
+}
+
+func (s service) listProjects(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	after, limit, err := pageParams(c)
+	if err != nil {
+		return err
+	}
+
+	summaries, err := s.projectStore.Summaries(ctx, user, ProjectFilter{After: after, Limit: limit + 1})
+	if err != nil {
+		return err
+	}
+
+	n := len(summaries)
+	if n > limit {
+		summaries = summaries[:limit]
+	}
+	var last uuid.UUID
+	if len(summaries) > 0 {
+		last = summaries[len(summaries)-1].UUID
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       summaries,
+		"pagination": pagination(limit, n, last),
+	})
+}
+
+func (s service) listTasks(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	projectUUID, err := uuidParam(c, "project_uuid")
+	if err != nil {
+		return err
+	}
+
+	perm, err := s.userStore.Permission(ctx, user, projectUUID.String())
+	if err != nil {
+		return err
+	}
+	if perm == "" {
+		return ErrForbidden
+	}
+
+	releaseUUID, err := uuidParam(c, "release_uuid")
+	if err != nil {
+		return err
+	}
+	release, err := s.releaseStore.Head(ctx, releaseUUID)
+	if err != nil {
+		return err
+	}
+	if release.Project.UUID != projectUUID {
+		return fmt.Errorf("release %s: %w", releaseUUID, ErrNotFound)
+	}
+
+	var filter TaskFilter
+	for _, param := range c.QueryParams()["status"] {
+		for _, status := range strings.Split(param, ",") {
+			switch TaskStatus(status) {
+			case TaskStatusTODO, TaskStatusDONE:
+				filter.Statuses = append(filter.Statuses, TaskStatus(status))
+			default:
+				return invalid("status", "has an unknown status %s", status)
+			}
+		}
+	}
+
+	after, limit, err := pageParams(c)
+	if err != nil {
+		return err
+	}
+	filter.After = after
+	filter.Limit = limit + 1
+
+	tasks, err := s.taskStore.List(ctx, releaseUUID, filter)
+	if err != nil {
+		return err
+	}
+
+	n := len(tasks)
+	if n > limit {
+		tasks = tasks[:limit]
+	}
+	var last uuid.UUID
+	if len(tasks) > 0 {
+		last = tasks[len(tasks)-1].UUID
+	}
+
+	res, err := renderTasks(ctx, s.projectStore, user, tasks...)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data":       res,
+		"pagination": pagination(limit, n, last),
+	})
+}
@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type EventStore struct {
+	db *sql.DB
+}
+
+func NewEventStore(db *sql.DB) EventStore {
+	return EventStore{db: db}
+}
+
+func (s EventStore) Store(ctx context.Context, e tonight.Event) error {
+	query := `
+INSERT INTO events (uuid, type, entity_uuid, project_uuid, user_id, correlation_id, payload, schema_version, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`
+	var projectUUID sql.NullString
+	if e.ProjectUUID != uuid.Nil {
+		projectUUID = sql.NullString{String: e.ProjectUUID.String(), Valid: true}
+	}
+	var correlationID sql.NullString
+	if e.CorrelationID != uuid.Nil {
+		correlationID = sql.NullString{String: e.CorrelationID.String(), Valid: true}
+	}
+
+	// A []byte would be sent as bytea, payloads are JSONB
+	_, err := conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		e.UUID,
+		e.Type,
+		e.EntityUUID,
+		projectUUID,
+		e.UserID,
+		correlationID,
+		string(e.Payload),
+		e.SchemaVersion,
+		e.CreatedAt,
+	)
+	if isDuplicateEntry(err) {
+		return fmt.Errorf("event %s already exists: %w", e.UUID, tonight.ErrDuplicateEvent)
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s EventStore) List(ctx context.Context, filter tonight.EventFilter, ch chan<- tonight.Event) error {
+	defer close(ch)
+
+	where, args := eventFilterClause(filter)
+	order := "ORDER BY created_at, uuid"
+	if filter.Reverse {
+		order = "ORDER BY created_at DESC, uuid DESC"
+	}
+	// A NULL limit does not limit anything
+	var limit sql.NullInt64
+	if filter.Limit > 0 {
+		limit = sql.NullInt64{Int64: int64(filter.Limit), Valid: true}
+	}
+	query := fmt.Sprintf(`
+SELECT uuid, type, entity_uuid, project_uuid, user_id, correlation_id, payload, schema_version, created_at
+FROM events
+%s
+%s
+LIMIT %s OFFSET %s
+`, where, order, args.add(limit), args.add(filter.Offset))
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e tonight.Event
+		var projectUUID, userID, correlationID sql.NullString
+		err := rows.Scan(
+			&e.UUID,
+			&e.Type,
+			&e.EntityUUID,
+			&projectUUID,
+			&userID,
+			&correlationID,
+			&e.Payload,
+			&e.SchemaVersion,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		e.UserID = userID.String
+		if projectUUID.Valid {
+			if e.ProjectUUID, err = uuid.FromString(projectUUID.String); err != nil {
+				return err
+			}
+		}
+		if correlationID.Valid {
+			if e.CorrelationID, err = uuid.FromString(correlationID.String); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case ch <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+func eventFilterClause(filter tonight.EventFilter) (string, queryArgs) {
+	conditions := make([]string, 0)
+	args := make(queryArgs, 0)
+
+	if len(filter.Types) > 0 {
+		types := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			types[i] = string(t)
+		}
+		conditions = append(conditions, fmt.Sprintf("type = ANY(%s)", args.add(pq.Array(types))))
+	}
+
+	if len(filter.EntityUUIDs) > 0 {
+		uuids := make([]string, len(filter.EntityUUIDs))
+		for i, id := range filter.EntityUUIDs {
+			uuids[i] = id.String()
+		}
+		conditions = append(conditions, fmt.Sprintf("entity_uuid = ANY(%s)", args.add(pq.Array(uuids))))
+	}
+
+	if filter.ProjectUUID != uuid.Nil {
+		conditions = append(conditions, fmt.Sprintf("project_uuid = %s", args.add(filter.ProjectUUID)))
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, fmt.Sprintf("user_id = %s", args.add(filter.UserID)))
+	}
+
+	if filter.CorrelationID != uuid.Nil {
+		conditions = append(conditions, fmt.Sprintf("correlation_id = %s", args.add(filter.CorrelationID)))
+	}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at >= %s", args.add(filter.Since)))
+	}
+
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at <= %s", args.add(filter.Until)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
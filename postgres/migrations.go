@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/bobinette/tonight/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+var dialect = migrate.Dialect{
+	CreateTable: `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT NOT NULL,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (version)
+)`,
+	Placeholder: migrate.Dollar,
+}
+
+// NewMigrator returns a migrator running the migrations of the
+// migrations directory, which are embedded in the binary.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, dialect, fsys)
+}
@@ -0,0 +1,178 @@
+-- Migration: init
+-- Created at: 2026-10-18 13:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT NOT NULL,
+    name TEXT NOT NULL,
+
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS projects (
+    uuid UUID NOT NULL,
+
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL,
+    description TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0,
+
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    CONSTRAINT u_project_slug UNIQUE (slug)
+);
+
+CREATE TABLE IF NOT EXISTS user_permission_on_project (
+    user_id TEXT NOT NULL,
+    project_uuid UUID NOT NULL,
+    permission TEXT NOT NULL,
+
+    PRIMARY KEY (user_id, project_uuid),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (project_uuid) REFERENCES projects (uuid) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS releases (
+    uuid UUID NOT NULL,
+
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0,
+
+    project_uuid UUID NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    FOREIGN KEY (project_uuid) REFERENCES projects (uuid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_release_project_uuid ON releases (project_uuid);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    uuid UUID NOT NULL,
+
+    title TEXT NOT NULL,
+    status TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0,
+    rank INTEGER NULL DEFAULT NULL,
+
+    release_uuid UUID NULL DEFAULT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    FOREIGN KEY (release_uuid) REFERENCES releases (uuid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_release_uuid ON tasks (release_uuid);
+
+CREATE TABLE IF NOT EXISTS events (
+    uuid UUID NOT NULL,
+
+    type TEXT NOT NULL,
+    entity_uuid UUID NOT NULL,
+    project_uuid UUID NULL DEFAULT NULL,
+    user_id TEXT NULL,
+    payload JSONB NOT NULL,
+    schema_version INTEGER NOT NULL DEFAULT 1,
+
+    created_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_entity_uuid ON events (entity_uuid);
+CREATE INDEX IF NOT EXISTS idx_event_project_uuid ON events (project_uuid);
+CREATE INDEX IF NOT EXISTS idx_event_created_at ON events (created_at);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+    project_uuid UUID NOT NULL,
+
+    event_uuid UUID NOT NULL,
+    event_created_at TIMESTAMPTZ NOT NULL,
+    events INTEGER NOT NULL,
+
+    state JSONB NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (project_uuid, event_uuid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_project_event_created_at ON snapshots (project_uuid, event_created_at);
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    uuid UUID NOT NULL,
+    project_uuid UUID NOT NULL,
+
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    -- Array of event types, all of them if empty
+    types JSONB NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    FOREIGN KEY (project_uuid) REFERENCES projects (uuid) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS webhook_queue (
+    uuid UUID NOT NULL,
+    webhook_uuid UUID NOT NULL,
+
+    event JSONB NOT NULL,
+    attempt INTEGER NOT NULL,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    FOREIGN KEY (webhook_uuid) REFERENCES webhooks (uuid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_queue_next_attempt_at ON webhook_queue (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    uuid UUID NOT NULL,
+    webhook_uuid UUID NOT NULL,
+
+    event_uuid UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+
+    status_code INTEGER NOT NULL,
+    error TEXT NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL,
+
+    PRIMARY KEY (uuid),
+    FOREIGN KEY (webhook_uuid) REFERENCES webhooks (uuid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_created_at ON webhook_deliveries (webhook_uuid, created_at);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_queue;
+DROP TABLE webhooks;
+DROP TABLE snapshots;
+DROP TABLE events;
+DROP TABLE tasks;
+DROP TABLE releases;
+DROP TABLE user_permission_on_project;
+DROP TABLE projects;
+DROP TABLE users;
+
+COMMIT;
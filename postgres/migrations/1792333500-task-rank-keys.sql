@@ -0,0 +1,28 @@
+-- Migration: task-rank-keys
+-- Created at: 2026-10-18 14:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Ranks are lexicographic keys, compared byte by byte
+ALTER TABLE tasks
+    ALTER COLUMN rank TYPE TEXT COLLATE "C"
+    USING CASE WHEN rank IS NULL THEN NULL ELSE LPAD(rank::TEXT, 5, '0') || 'i' END;
+
+-- The snapshots hold integer ranks, they are rebuilt from the events
+DELETE FROM snapshots;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+-- Only the ranks converted by the UP migration can be restored
+ALTER TABLE tasks
+    ALTER COLUMN rank TYPE INTEGER
+    USING CASE WHEN rank ~ '^[0-9]{5}i$' THEN LEFT(rank, 5)::INTEGER ELSE NULL END;
+
+DELETE FROM snapshots;
+
+COMMIT;
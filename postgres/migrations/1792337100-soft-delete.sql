@@ -0,0 +1,32 @@
+-- Migration: soft-delete
+-- Created at: 2026-10-18 15:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Deleted entities stay in the trash until they are purged
+ALTER TABLE projects ADD COLUMN deleted_at TIMESTAMPTZ NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_project_deleted_at ON projects (deleted_at);
+
+ALTER TABLE releases ADD COLUMN deleted_at TIMESTAMPTZ NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_release_deleted_at ON releases (deleted_at);
+
+ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMPTZ NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_task_deleted_at ON tasks (deleted_at);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_task_deleted_at;
+ALTER TABLE tasks DROP COLUMN deleted_at;
+
+DROP INDEX IF EXISTS idx_release_deleted_at;
+ALTER TABLE releases DROP COLUMN deleted_at;
+
+DROP INDEX IF EXISTS idx_project_deleted_at;
+ALTER TABLE projects DROP COLUMN deleted_at;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Migration: event-correlation
+-- Created at: 2026-10-18 16:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Events recorded by the same request, a bulk one for instance, share
+-- a correlation id
+ALTER TABLE events ADD COLUMN correlation_id UUID NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS idx_event_correlation_id ON events (correlation_id);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_event_correlation_id;
+ALTER TABLE events DROP COLUMN correlation_id;
+
+COMMIT;
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight/tonighttest"
+)
+
+func orString(s, def string) string {
+	if s != "" {
+		return s
+	}
+	return def
+}
+
+func TestStores(t *testing.T) {
+	host := orString(os.Getenv("POSTGRES_HOST"), "127.0.0.1")
+	port := orString(os.Getenv("POSTGRES_PORT"), "5432")
+	user := orString(os.Getenv("POSTGRES_USER"), "postgres")
+	password := orString(os.Getenv("POSTGRES_PASSWORD"), "postgres")
+	db, err := sql.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable connect_timeout=1",
+		host,
+		port,
+		user,
+		password,
+		"tonight_v2_test",
+	))
+	require.NoError(t, err)
+
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background(), 0)
+	require.NoError(t, err)
+	defer func() {
+		var err error
+		_, err = db.Exec("DELETE FROM projects")
+		require.NoError(t, err)
+		_, err = db.Exec("DELETE FROM users")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+	}()
+
+	tonighttest.TestStores(t, tonighttest.Stores{
+		Transactor:    NewTransactor(db),
+		EventStore:    NewEventStore(db),
+		ProjectStore:  NewProjectStore(db),
+		ReleaseStore:  NewReleaseStore(db),
+		TaskStore:     NewTaskStore(db),
+		UserStore:     NewUserStore(db),
+		SnapshotStore: NewSnapshotStore(db),
+		WebhookStore:  NewWebhookStore(db),
+		TrashStore:    NewTrashStore(db),
+	})
+}
@@ -0,0 +1,360 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type ProjectStore struct {
+	db *sql.DB
+}
+
+func NewProjectStore(db *sql.DB) ProjectStore {
+	return ProjectStore{db: db}
+}
+
+func (s ProjectStore) Upsert(ctx context.Context, p tonight.Project, u tonight.User) error {
+	return withTx(ctx, s.db, func(tx querier) error {
+		if p.Version == 0 {
+			query := `
+INSERT INTO projects (uuid, name, description, slug, version, created_at, updated_at)
+VALUES ($1, $2, $3, $4, 1, $5, $6)
+`
+			_, err := tx.ExecContext(
+				ctx,
+				query,
+				p.UUID,
+				p.Name,
+				p.Description,
+				p.Slug,
+				p.CreatedAt,
+				p.UpdatedAt,
+			)
+			if isDuplicateEntry(err) {
+				return fmt.Errorf("project %s already exists: %w", p.UUID, tonight.ErrVersionConflict)
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			query := `
+UPDATE projects
+SET name = $1, description = $2, slug = $3, updated_at = $4, version = version + 1
+WHERE uuid = $5 AND version = $6
+`
+			res, err := tx.ExecContext(
+				ctx,
+				query,
+				p.Name,
+				p.Description,
+				p.Slug,
+				p.UpdatedAt,
+				p.UUID,
+				p.Version,
+			)
+			if isDuplicateEntry(err) {
+				return fmt.Errorf("slug %s of project %s is taken: %w", p.Slug, p.UUID, tonight.ErrConflict)
+			}
+			if err != nil {
+				return err
+			}
+			if err := checkVersion(res, "project", p.UUID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+INSERT INTO user_permission_on_project (user_id, project_uuid, permission)
+VALUES ($1, $2, $3)
+ON CONFLICT DO NOTHING
+`
+		if _, err := tx.ExecContext(ctx, query, u.ID, p.UUID, "owner"); err != nil {
+			return err
+		}
+
+		query = `
+INSERT INTO releases (uuid, title, description, project_uuid, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT DO NOTHING
+`
+		if _, err := tx.ExecContext(ctx, query, p.UUID, "Backlog", "", p.UUID, p.CreatedAt, p.UpdatedAt); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s ProjectStore) List(ctx context.Context, u tonight.User) ([]tonight.Project, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE user_permission_on_project.user_id = $1 AND projects.deleted_at IS NULL
+ORDER BY projects.created_at, projects.uuid
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make([]tonight.Project, 0)
+	uuids := make([]string, 0)
+	for rows.Next() {
+		var p tonight.Project
+		err := rows.Scan(
+			&p.UUID,
+			&p.Name,
+			&p.Description,
+			&p.Slug,
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, p)
+		uuids = append(uuids, p.UUID.String())
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(projects) == 0 {
+		return projects, nil
+	}
+
+	releases, err := loadReleases(ctx, conn(ctx, s.db), uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range projects {
+		p.Releases = releases[p.UUID.String()]
+		if p.Releases == nil {
+			p.Releases = make([]tonight.Release, 0)
+		}
+		projects[i] = p
+	}
+
+	return projects, nil
+}
+
+func (s ProjectStore) Get(ctx context.Context, uuid uuid.UUID, u tonight.User) (tonight.Project, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE projects.uuid = $1 AND user_permission_on_project.user_id = $2 AND projects.deleted_at IS NULL
+`
+	return s.get(ctx, query, uuid, u.ID)
+}
+
+func (s ProjectStore) Find(ctx context.Context, slug string, u tonight.User) (tonight.Project, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE projects.slug = $1 AND user_permission_on_project.user_id = $2 AND projects.deleted_at IS NULL
+`
+	return s.get(ctx, query, slug, u.ID)
+}
+
+func (s ProjectStore) Slugs(ctx context.Context, slugs []string, u tonight.User) ([]string, error) {
+	if len(slugs) == 0 {
+		return make([]string, 0), nil
+	}
+
+	query := `
+SELECT DISTINCT projects.slug
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE projects.slug = ANY($1) AND user_permission_on_project.user_id = $2 AND projects.deleted_at IS NULL
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, pq.Array(slugs), u.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make([]string, 0, len(slugs))
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		found = append(found, slug)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return found, rows.Close()
+}
+
+func (s ProjectStore) Summaries(ctx context.Context, u tonight.User, filter tonight.ProjectFilter) ([]tonight.ProjectSummary, error) {
+	var args queryArgs
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+`
+	if filter.After != uuid.Nil {
+		// The page starts after the project of the cursor, in the
+		// order of the list
+		query += fmt.Sprintf("JOIN projects AS cursor_project ON cursor_project.uuid = %s\n", args.add(filter.After))
+	}
+	query += fmt.Sprintf("WHERE user_permission_on_project.user_id = %s AND projects.deleted_at IS NULL\n", args.add(u.ID))
+	if filter.After != uuid.Nil {
+		query += `AND (
+	projects.created_at > cursor_project.created_at
+	OR (projects.created_at = cursor_project.created_at AND projects.uuid > cursor_project.uuid)
+)
+`
+	}
+	query += "ORDER BY projects.created_at, projects.uuid\n"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf("LIMIT %s\n", args.add(filter.Limit))
+	}
+
+	q := conn(ctx, s.db)
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]tonight.ProjectSummary, 0)
+	uuids := make([]string, 0)
+	for rows.Next() {
+		var p tonight.Project
+		err := rows.Scan(
+			&p.UUID,
+			&p.Name,
+			&p.Description,
+			&p.Slug,
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		summaries = append(summaries, tonight.ProjectSummary{
+			Project:    p,
+			TaskCounts: map[tonight.TaskStatus]int{tonight.TaskStatusTODO: 0, tonight.TaskStatusDONE: 0},
+		})
+		uuids = append(uuids, p.UUID.String())
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(summaries) == 0 {
+		return summaries, nil
+	}
+
+	releases, err := listReleases(ctx, q, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := countTasks(ctx, q, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, summary := range summaries {
+		summary.Releases = releases[summary.UUID.String()]
+		if summary.Releases == nil {
+			summary.Releases = make([]tonight.Release, 0)
+		}
+		for status, n := range counts[summary.UUID.String()] {
+			summary.TaskCounts[status] = n
+		}
+		summaries[i] = summary
+	}
+
+	return summaries, nil
+}
+
+// countTasks returns the number of tasks of the projects by status, by
+// project uuid.
+func countTasks(ctx context.Context, q querier, projectUUIDs []string) (map[string]map[tonight.TaskStatus]int, error) {
+	query := `
+SELECT releases.project_uuid, tasks.status, COUNT(*)
+FROM tasks
+JOIN releases ON releases.uuid = tasks.release_uuid
+WHERE releases.project_uuid = ANY($1) AND releases.deleted_at IS NULL AND tasks.deleted_at IS NULL
+GROUP BY releases.project_uuid, tasks.status
+`
+	rows, err := q.QueryContext(ctx, query, pq.Array(projectUUIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[tonight.TaskStatus]int)
+	for rows.Next() {
+		var projectUUID string
+		var status tonight.TaskStatus
+		var n int
+		if err := rows.Scan(&projectUUID, &status, &n); err != nil {
+			return nil, err
+		}
+
+		if counts[projectUUID] == nil {
+			counts[projectUUID] = make(map[tonight.TaskStatus]int)
+		}
+		counts[projectUUID][status] = n
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// get returns the project selected by query, with its releases. The
+// first argument of the query identifies the project.
+func (s ProjectStore) get(ctx context.Context, query string, args ...interface{}) (tonight.Project, error) {
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, args...)
+	var p tonight.Project
+	err := row.Scan(
+		&p.UUID,
+		&p.Name,
+		&p.Description,
+		&p.Slug,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Project{}, notFound(err, "project", args[0])
+	}
+
+	releases, err := loadReleases(ctx, conn(ctx, s.db), []string{p.UUID.String()})
+	if err != nil {
+		return tonight.Project{}, err
+	}
+
+	p.Releases = releases[p.UUID.String()]
+	if p.Releases == nil {
+		p.Releases = make([]tonight.Release, 0)
+	}
+
+	return p, nil
+}
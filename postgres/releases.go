@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type ReleaseStore struct {
+	db *sql.DB
+}
+
+func NewReleaseStore(db *sql.DB) ReleaseStore {
+	return ReleaseStore{db: db}
+}
+
+func (s ReleaseStore) Get(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	release, err := s.Head(ctx, id)
+	if err != nil {
+		return tonight.Release{}, err
+	}
+
+	tasks, err := loadTasks(ctx, conn(ctx, s.db), []string{release.UUID.String()})
+	if err != nil {
+		return tonight.Release{}, err
+	}
+
+	release.Tasks = tasks[release.UUID.String()]
+	if release.Tasks == nil {
+		release.Tasks = make([]tonight.Task, 0)
+	}
+
+	return release, nil
+}
+
+func (s ReleaseStore) Head(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	query := `
+SELECT releases.uuid, releases.title, releases.description, releases.version, releases.project_uuid, releases.created_at, releases.updated_at
+FROM releases
+JOIN projects ON projects.uuid = releases.project_uuid
+WHERE releases.uuid = $1 AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
+`
+
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, id)
+	var release tonight.Release
+	err := row.Scan(
+		&release.UUID,
+		&release.Title,
+		&release.Description,
+		&release.Version,
+		&release.Project.UUID,
+		&release.CreatedAt,
+		&release.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Release{}, notFound(err, "release", id)
+	}
+
+	release.Tasks = make([]tonight.Task, 0)
+	return release, nil
+}
+
+func (s ReleaseStore) List(ctx context.Context, projectUUID uuid.UUID) ([]tonight.Release, error) {
+	releases, err := loadReleases(ctx, conn(ctx, s.db), []string{projectUUID.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	if releases[projectUUID.String()] == nil {
+		return make([]tonight.Release, 0), nil
+	}
+	return releases[projectUUID.String()], nil
+}
+
+func (s ReleaseStore) Upsert(ctx context.Context, release tonight.Release) error {
+	if release.Version == 0 {
+		query := `
+INSERT INTO releases (uuid, title, description, version, project_uuid, created_at, updated_at)
+VALUES ($1, $2, $3, 1, $4, $5, $6)
+`
+		_, err := conn(ctx, s.db).ExecContext(
+			ctx,
+			query,
+			release.UUID,
+			release.Title,
+			release.Description,
+			release.Project.UUID,
+			release.CreatedAt,
+			release.UpdatedAt,
+		)
+		if isDuplicateEntry(err) {
+			return fmt.Errorf("release %s already exists: %w", release.UUID, tonight.ErrVersionConflict)
+		}
+		return err
+	}
+
+	query := `
+UPDATE releases
+SET title = $1, description = $2, updated_at = $3, version = version + 1
+WHERE uuid = $4 AND version = $5
+`
+	res, err := conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		release.Title,
+		release.Description,
+		release.UpdatedAt,
+		release.UUID,
+		release.Version,
+	)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res, "release", release.UUID)
+}
+
+// loadReleases returns the releases of the projects with their tasks,
+// by project uuid. The releases of a project are sorted by title, its
+// backlog last.
+func loadReleases(ctx context.Context, q querier, projectUUIDs []string) (map[string][]tonight.Release, error) {
+	releasesByProjectUUID, err := listReleases(ctx, q, projectUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseUUIDs := make([]string, 0)
+	for _, releases := range releasesByProjectUUID {
+		for _, release := range releases {
+			releaseUUIDs = append(releaseUUIDs, release.UUID.String())
+		}
+	}
+
+	tasksByReleaseUUID, err := loadTasks(ctx, q, releaseUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, releases := range releasesByProjectUUID {
+		for i, release := range releases {
+			releases[i].Tasks = tasksByReleaseUUID[release.UUID.String()]
+			if releases[i].Tasks == nil {
+				releases[i].Tasks = make([]tonight.Task, 0)
+			}
+		}
+	}
+
+	return releasesByProjectUUID, nil
+}
+
+// listReleases returns the releases of the projects like loadReleases,
+// without their tasks.
+func listReleases(ctx context.Context, q querier, projectUUIDs []string) (map[string][]tonight.Release, error) {
+	if len(projectUUIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+SELECT releases.uuid, releases.title, releases.description, releases.version, releases.project_uuid, releases.created_at, releases.updated_at
+FROM releases
+JOIN projects ON projects.uuid = releases.project_uuid
+WHERE releases.project_uuid = ANY($1) AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
+ORDER BY releases.uuid = releases.project_uuid ASC, releases.title ASC
+`
+	rows, err := q.QueryContext(ctx, query, pq.Array(projectUUIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releasesByProjectUUID := make(map[string][]tonight.Release)
+	for rows.Next() {
+		var release tonight.Release
+		err := rows.Scan(
+			&release.UUID,
+			&release.Title,
+			&release.Description,
+			&release.Version,
+			&release.Project.UUID,
+			&release.CreatedAt,
+			&release.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		releasesByProjectUUID[release.Project.UUID.String()] = append(
+			releasesByProjectUUID[release.Project.UUID.String()],
+			release,
+		)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return releasesByProjectUUID, nil
+}
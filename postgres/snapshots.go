@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type SnapshotStore struct {
+	db *sql.DB
+}
+
+func NewSnapshotStore(db *sql.DB) SnapshotStore {
+	return SnapshotStore{db: db}
+}
+
+func (s SnapshotStore) Store(ctx context.Context, snap tonight.Snapshot) error {
+	state, err := json.Marshal(snap.Projection)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO snapshots (project_uuid, event_uuid, event_created_at, events, state, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (project_uuid, event_uuid) DO UPDATE
+SET events = EXCLUDED.events, state = EXCLUDED.state, created_at = EXCLUDED.created_at
+`
+	_, err = conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		snap.ProjectUUID,
+		snap.EventUUID,
+		snap.EventCreatedAt,
+		snap.Events,
+		string(state),
+		time.Now(),
+	)
+	return err
+}
+
+func (s SnapshotStore) Latest(ctx context.Context, projectUUID uuid.UUID, until time.Time) (tonight.Snapshot, error) {
+	args := queryArgs{}
+	where := fmt.Sprintf("WHERE project_uuid = %s", args.add(projectUUID))
+	if !until.IsZero() {
+		where += fmt.Sprintf(" AND event_created_at <= %s", args.add(until))
+	}
+
+	query := fmt.Sprintf(`
+SELECT project_uuid, event_uuid, event_created_at, events, state
+FROM snapshots
+%s
+ORDER BY event_created_at DESC, event_uuid DESC
+LIMIT 1
+`, where)
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, args...)
+
+	var snap tonight.Snapshot
+	var state []byte
+	err := row.Scan(&snap.ProjectUUID, &snap.EventUUID, &snap.EventCreatedAt, &snap.Events, &state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tonight.Snapshot{}, fmt.Errorf("project %s: %w", projectUUID, tonight.ErrNoSnapshot)
+	}
+	if err != nil {
+		return tonight.Snapshot{}, err
+	}
+
+	snap.Projection = tonight.NewProjection()
+	if err := json.Unmarshal(state, snap.Projection); err != nil {
+		return tonight.Snapshot{}, fmt.Errorf("error decoding snapshot of project %s: %w", projectUUID, err)
+	}
+
+	return snap, nil
+}
+
+func (s SnapshotStore) Clear(ctx context.Context) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx, "DELETE FROM snapshots")
+	return err
+}
@@ -0,0 +1,231 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type TaskStore struct {
+	db *sql.DB
+}
+
+func NewTaskStore(db *sql.DB) TaskStore {
+	return TaskStore{db: db}
+}
+
+func (s TaskStore) Upsert(ctx context.Context, t tonight.Task) error {
+	if t.Version == 0 {
+		query := `
+INSERT INTO tasks (uuid, title, description, status, version, release_uuid, created_at, updated_at)
+VALUES ($1, $2, $3, $4, 1, $5, $6, $7)
+`
+		_, err := conn(ctx, s.db).ExecContext(
+			ctx,
+			query,
+			t.UUID,
+			t.Title,
+			t.Description,
+			t.Status,
+			t.Release.UUID,
+			t.CreatedAt,
+			t.UpdatedAt,
+		)
+		if isDuplicateEntry(err) {
+			return fmt.Errorf("task %s already exists: %w", t.UUID, tonight.ErrVersionConflict)
+		}
+		return err
+	}
+
+	// A task moved to another release loses its rank
+	query := `
+UPDATE tasks
+SET status = $1, title = $2, description = $3, rank = CASE WHEN release_uuid = $4 THEN rank ELSE NULL END, release_uuid = $4, version = version + 1
+WHERE uuid = $5 AND version = $6
+`
+	res, err := conn(ctx, s.db).ExecContext(ctx, query, t.Status, t.Title, t.Description, t.Release.UUID, t.UUID, t.Version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res, "task", t.UUID)
+}
+
+func (s TaskStore) Get(ctx context.Context, uuid uuid.UUID, user tonight.User) (tonight.Task, error) {
+	query := `
+SELECT tasks.uuid, tasks.title, tasks.description, tasks.status, tasks.version, tasks.rank, tasks.release_uuid, tasks.created_at, tasks.updated_at
+FROM tasks
+JOIN releases ON releases.uuid = tasks.release_uuid
+JOIN projects ON projects.uuid = releases.project_uuid
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = releases.project_uuid
+WHERE user_permission_on_project.user_id = $1 AND tasks.uuid = $2
+AND tasks.deleted_at IS NULL AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
+`
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, user.ID, uuid)
+	var t tonight.Task
+	var rank sql.NullString
+	err := row.Scan(
+		&t.UUID,
+		&t.Title,
+		&t.Description,
+		&t.Status,
+		&t.Version,
+		&rank,
+		&t.Release.UUID,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Task{}, notFound(err, "task", uuid)
+	}
+	t.Rank = rank.String
+	return t, nil
+}
+
+func (s TaskStore) Rank(ctx context.Context, ranks map[uuid.UUID]string) error {
+	return withTx(ctx, s.db, func(tx querier) error {
+		query := "UPDATE tasks SET rank = $1 WHERE uuid = $2"
+		for taskUUID, rank := range ranks {
+			// An empty rank unranks the task
+			value := sql.NullString{String: rank, Valid: rank != ""}
+			if _, err := tx.ExecContext(ctx, query, value, taskUUID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s TaskStore) List(ctx context.Context, releaseUUID uuid.UUID, filter tonight.TaskFilter) ([]tonight.Task, error) {
+	var args queryArgs
+	query := `
+SELECT tasks.uuid, tasks.title, tasks.description, tasks.status, tasks.version, tasks.rank, tasks.release_uuid, tasks.created_at, tasks.updated_at
+FROM tasks
+`
+	if filter.After != uuid.Nil {
+		// The page starts after the task of the cursor, in the order
+		// of the list: ranked tasks first, then the unranked ones
+		query += fmt.Sprintf("JOIN tasks AS cursor_task ON cursor_task.uuid = %s\n", args.add(filter.After))
+	}
+	query += fmt.Sprintf("WHERE tasks.release_uuid = %s AND tasks.deleted_at IS NULL\n", args.add(releaseUUID))
+	if filter.After != uuid.Nil {
+		query += "AND " + afterCursorTask
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = string(status)
+		}
+		query += fmt.Sprintf("AND tasks.status = ANY(%s)\n", args.add(pq.Array(statuses)))
+	}
+	query += "ORDER BY tasks.rank ASC NULLS LAST, tasks.created_at, tasks.uuid\n"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf("LIMIT %s\n", args.add(filter.Limit))
+	}
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]tonight.Task, 0)
+	for rows.Next() {
+		var t tonight.Task
+		var rank sql.NullString
+		err := rows.Scan(
+			&t.UUID,
+			&t.Title,
+			&t.Description,
+			&t.Status,
+			&t.Version,
+			&rank,
+			&t.Release.UUID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		t.Rank = rank.String
+
+		tasks = append(tasks, t)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+// afterCursorTask selects the tasks coming after cursor_task.
+const afterCursorTask = `(
+	(cursor_task.rank IS NOT NULL AND (
+		tasks.rank IS NULL
+		OR tasks.rank > cursor_task.rank
+		OR (tasks.rank = cursor_task.rank AND (
+			tasks.created_at > cursor_task.created_at
+			OR (tasks.created_at = cursor_task.created_at AND tasks.uuid > cursor_task.uuid)
+		))
+	))
+	OR (cursor_task.rank IS NULL AND tasks.rank IS NULL AND (
+		tasks.created_at > cursor_task.created_at
+		OR (tasks.created_at = cursor_task.created_at AND tasks.uuid > cursor_task.uuid)
+	))
+)
+`
+
+// loadTasks returns the tasks of the releases by release uuid, the
+// ranked ones first by rank, then the others by creation date.
+func loadTasks(ctx context.Context, q querier, releaseUUIDs []string) (map[string][]tonight.Task, error) {
+	if len(releaseUUIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+SELECT uuid, title, description, status, version, rank, release_uuid, created_at, updated_at
+FROM tasks
+WHERE release_uuid = ANY($1) AND deleted_at IS NULL
+ORDER BY rank ASC NULLS LAST, created_at, uuid
+`
+	rows, err := q.QueryContext(ctx, query, pq.Array(releaseUUIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasksByReleaseUUID := make(map[string][]tonight.Task)
+	for rows.Next() {
+		var t tonight.Task
+		var rank sql.NullString
+		err := rows.Scan(
+			&t.UUID,
+			&t.Title,
+			&t.Description,
+			&t.Status,
+			&t.Version,
+			&rank,
+			&t.Release.UUID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		t.Rank = rank.String
+
+		releaseUUID := t.Release.UUID.String()
+		tasksByReleaseUUID[releaseUUID] = append(tasksByReleaseUUID[releaseUUID], t)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return tasksByReleaseUUID, nil
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+
+	"github.com/bobinette/tonight"
+)
+
+type UserStore struct {
+	db *sql.DB
+}
+
+func NewUserStore(db *sql.DB) UserStore {
+	return UserStore{db: db}
+}
+
+func (s UserStore) Ensure(ctx context.Context, user *tonight.User) error {
+	query := `
+SELECT id, name FROM users
+WHERE id = $1
+`
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, user.ID)
+	if err := row.Scan(&user.ID, &user.Name); err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		return s.insertUser(ctx, user)
+	}
+
+	return nil
+}
+
+func (s UserStore) insertUser(ctx context.Context, user *tonight.User) error {
+	query := `
+INSERT INTO users (id, name)
+VALUES ($1, $2)
+`
+	_, err := conn(ctx, s.db).ExecContext(ctx, query, user.ID, user.Name)
+	return err
+}
+
+func (s UserStore) Permission(ctx context.Context, user tonight.User, projectUUID string) (string, error) {
+	query := `
+SELECT permission
+FROM user_permission_on_project
+WHERE user_id = $1 AND project_uuid::text = $2
+`
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, user.ID, projectUUID)
+	var perm string
+	if err := row.Scan(&perm); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return perm, nil
+}
+
+func (s UserStore) List(ctx context.Context, ids []string) ([]tonight.User, error) {
+	if len(ids) == 0 {
+		return make([]tonight.User, 0), nil
+	}
+
+	query := `
+SELECT id, name FROM users
+WHERE id = ANY($1)
+ORDER BY id
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]tonight.User, 0, len(ids))
+	for rows.Next() {
+		var user tonight.User
+		if err := rows.Scan(&user.ID, &user.Name); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, rows.Close()
+}
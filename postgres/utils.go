@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+// checkVersion returns tonight.ErrVersionConflict if the update whose
+// result is res, conditioned on the version of the entity, did not
+// modify anything.
+func checkVersion(res sql.Result, kind string, id uuid.UUID) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s: %w", kind, id, tonight.ErrVersionConflict)
+	}
+	return nil
+}
+
+// notFound returns tonight.ErrNotFound if err, the error of looking up
+// the entity kind identified by key, is sql.ErrNoRows.
+func notFound(err error, kind string, key interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s %v: %w", kind, key, tonight.ErrNotFound)
+	}
+	return err
+}
+
+// isDuplicateEntry returns true if err is due to a duplicate primary or
+// unique key.
+func isDuplicateEntry(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation"
+}
+
+// queryArgs collects the arguments of a query built piece by piece,
+// numbering their placeholders.
+type queryArgs []interface{}
+
+// add appends v to the arguments and returns its placeholder.
+func (a *queryArgs) add(v interface{}) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// checkFound returns tonight.ErrNotFound if the statement whose result
+// is res did not modify anything.
+func checkFound(res sql.Result, kind string, id uuid.UUID) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s: %w", kind, id, tonight.ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type WebhookStore struct {
+	db *sql.DB
+}
+
+func NewWebhookStore(db *sql.DB) WebhookStore {
+	return WebhookStore{db: db}
+}
+
+func (s WebhookStore) Upsert(ctx context.Context, w tonight.Webhook) error {
+	types, err := json.Marshal(w.Types)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO webhooks (uuid, project_uuid, url, secret, types, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (uuid) DO UPDATE
+SET url = EXCLUDED.url, secret = EXCLUDED.secret, types = EXCLUDED.types, updated_at = EXCLUDED.updated_at
+`
+	_, err = conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		w.UUID,
+		w.ProjectUUID,
+		w.URL,
+		w.Secret,
+		string(types),
+		w.CreatedAt,
+		w.UpdatedAt,
+	)
+	return err
+}
+
+func (s WebhookStore) Get(ctx context.Context, uuid uuid.UUID) (tonight.Webhook, error) {
+	query := `
+SELECT uuid, project_uuid, url, secret, types, created_at, updated_at
+FROM webhooks
+WHERE uuid = $1
+`
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, uuid)
+	w, err := scanWebhook(row)
+	if err != nil {
+		return tonight.Webhook{}, notFound(err, "webhook", uuid)
+	}
+	return w, nil
+}
+
+func (s WebhookStore) List(ctx context.Context, projectUUID uuid.UUID) ([]tonight.Webhook, error) {
+	query := `
+SELECT uuid, project_uuid, url, secret, types, created_at, updated_at
+FROM webhooks
+WHERE project_uuid = $1
+ORDER BY created_at
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, projectUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]tonight.Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, rows.Close()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row scanner) (tonight.Webhook, error) {
+	var w tonight.Webhook
+	var types []byte
+	err := row.Scan(
+		&w.UUID,
+		&w.ProjectUUID,
+		&w.URL,
+		&w.Secret,
+		&types,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Webhook{}, err
+	}
+
+	if err := json.Unmarshal(types, &w.Types); err != nil {
+		return tonight.Webhook{}, err
+	}
+	return w, nil
+}
+
+func (s WebhookStore) Delete(ctx context.Context, uuid uuid.UUID) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx, "DELETE FROM webhooks WHERE uuid = $1", uuid)
+	return err
+}
+
+func (s WebhookStore) LogDelivery(ctx context.Context, d tonight.WebhookDelivery) error {
+	query := `
+INSERT INTO webhook_deliveries (uuid, webhook_uuid, event_uuid, event_type, attempt, status_code, error, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+`
+	_, err := conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		d.UUID,
+		d.WebhookUUID,
+		d.EventUUID,
+		d.EventType,
+		d.Attempt,
+		d.StatusCode,
+		d.Error,
+		d.CreatedAt,
+	)
+	return err
+}
+
+func (s WebhookStore) Deliveries(ctx context.Context, webhookUUID uuid.UUID, limit int) ([]tonight.WebhookDelivery, error) {
+	query := `
+SELECT uuid, webhook_uuid, event_uuid, event_type, attempt, status_code, error, created_at
+FROM webhook_deliveries
+WHERE webhook_uuid = $1
+ORDER BY created_at DESC, uuid DESC
+LIMIT $2
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, webhookUUID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]tonight.WebhookDelivery, 0)
+	for rows.Next() {
+		var d tonight.WebhookDelivery
+		err := rows.Scan(
+			&d.UUID,
+			&d.WebhookUUID,
+			&d.EventUUID,
+			&d.EventType,
+			&d.Attempt,
+			&d.StatusCode,
+			&d.Error,
+			&d.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, rows.Close()
+}
+
+func (s WebhookStore) Enqueue(ctx context.Context, d tonight.QueuedDelivery) error {
+	event, err := json.Marshal(d.Event)
+	if err != nil {
+		return err
+	}
+
+	query := `
+INSERT INTO webhook_queue (uuid, webhook_uuid, event, attempt, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (uuid) DO UPDATE
+SET attempt = EXCLUDED.attempt, next_attempt_at = EXCLUDED.next_attempt_at
+`
+	_, err = conn(ctx, s.db).ExecContext(ctx, query, d.UUID, d.WebhookUUID, string(event), d.Attempt, d.NextAttemptAt)
+	return err
+}
+
+func (s WebhookStore) Due(ctx context.Context, now time.Time, limit int) ([]tonight.QueuedDelivery, error) {
+	query := `
+SELECT uuid, webhook_uuid, event, attempt, next_attempt_at
+FROM webhook_queue
+WHERE next_attempt_at <= $1
+ORDER BY next_attempt_at, uuid
+LIMIT $2
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	due := make([]tonight.QueuedDelivery, 0)
+	for rows.Next() {
+		var d tonight.QueuedDelivery
+		var event []byte
+		err := rows.Scan(&d.UUID, &d.WebhookUUID, &event, &d.Attempt, &d.NextAttemptAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(event, &d.Event); err != nil {
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return due, rows.Close()
+}
+
+func (s WebhookStore) Dequeue(ctx context.Context, uuid uuid.UUID) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx, "DELETE FROM webhook_queue WHERE uuid = $1", uuid)
+	return err
+}
@@ -0,0 +1,476 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A Projection is the state of Tonight obtained by folding events,
+// independently of any store. It holds what the stores keep in their
+// tables: projects, releases, tasks and their ranks, and the
+// permissions of users on projects.
+type Projection struct {
+	Projects    map[uuid.UUID]Project           `json:"projects"`
+	Releases    map[uuid.UUID]Release           `json:"releases"`
+	Tasks       map[uuid.UUID]Task              `json:"tasks"`
+	Ranks       map[uuid.UUID]string            `json:"ranks"`
+	Permissions map[uuid.UUID]map[string]string `json:"permissions"`
+}
+
+// A ProjectionStore can load the whole state of a store as a
+// Projection, and replace it by another one.
+type ProjectionStore interface {
+	Load(ctx context.Context) (*Projection, error)
+	Reset(ctx context.Context, p *Projection) error
+}
+
+func NewProjection() *Projection {
+	return &Projection{
+		Projects:    make(map[uuid.UUID]Project),
+		Releases:    make(map[uuid.UUID]Release),
+		Tasks:       make(map[uuid.UUID]Task),
+		Ranks:       make(map[uuid.UUID]string),
+		Permissions: make(map[uuid.UUID]map[string]string),
+	}
+}
+
+// A SkippedEvent is an event Replay could not apply, and why.
+type SkippedEvent struct {
+	Event Event
+	Err   error
+}
+
+// Replay folds all the events of store matching filter into a new
+// Projection.
+//
+// The oldest events do not hold everything the projection needs: the
+// releases were created without their project, and the tasks created
+// from a release without their release. These are taken from live,
+// the state of the tables, when it has them. The events that cannot be
+// applied, those older than the entity uuids for instance, are skipped
+// and returned rather than failing the whole replay.
+func Replay(ctx context.Context, store EventStore, filter EventFilter, live *Projection) (*Projection, []SkippedEvent, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() { errc <- store.List(ctx, filter, ch) }()
+
+	p := NewProjection()
+	skipped := make([]SkippedEvent, 0)
+	for e := range ch {
+		completed, err := completeEvent(e, live)
+		if err == nil {
+			err = p.Apply(completed)
+		}
+		if err != nil {
+			skipped = append(skipped, SkippedEvent{Event: e, Err: err})
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, nil, err
+	}
+
+	return p, skipped, nil
+}
+
+// completeEvent fills the project of the release created by e, or the
+// release of the task, from live if the payload of e has none.
+func completeEvent(e Event, live *Projection) (Event, error) {
+	e, err := UpcastEvent(e)
+	if err != nil {
+		return Event{}, err
+	}
+	if live == nil {
+		return e, nil
+	}
+
+	decoded, err := decodePayload(e)
+	if err != nil {
+		return Event{}, err
+	}
+
+	switch payload := decoded.(type) {
+	case *releaseCreatePayload:
+		release, ok := live.Releases[e.EntityUUID]
+		if payload.Project.UUID != uuid.Nil || !ok {
+			return e, nil
+		}
+		payload.Project.UUID = release.Project.UUID
+
+	case *taskCreatePayload:
+		task, ok := live.Tasks[e.EntityUUID]
+		if payload.Release.UUID != uuid.Nil || !ok {
+			return e, nil
+		}
+		payload.Release.UUID = task.Release.UUID
+
+	default:
+		return e, nil
+	}
+
+	if e.Payload, err = json.Marshal(decoded); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
+
+// Apply e to the projection, doing what the handler that recorded e
+// did to the stores. The payload of e is upcast to the current version
+// of its schema first.
+func (p *Projection) Apply(e Event) error {
+	e, err := UpcastEvent(e)
+	if err != nil {
+		return err
+	}
+
+	decoded, err := decodePayload(e)
+	if err != nil {
+		return err
+	}
+	if e.EntityUUID == uuid.Nil {
+		return fmt.Errorf("%s event has no entity", e.Type)
+	}
+
+	switch payload := decoded.(type) {
+	case *projectCreatePayload:
+		p.Projects[e.EntityUUID] = Project{
+			UUID:        e.EntityUUID,
+			Name:        payload.Name,
+			Slug:        projectSlug(payload.Name, e.EntityUUID),
+			Description: payload.Description,
+			Version:     1,
+			CreatedAt:   e.CreatedAt,
+			UpdatedAt:   e.CreatedAt,
+		}
+		p.grant(e.EntityUUID, e.UserID, "owner")
+
+		// Every project comes with a backlog sharing its uuid
+		p.Releases[e.EntityUUID] = Release{
+			UUID:      e.EntityUUID,
+			Title:     "Backlog",
+			Project:   Project{UUID: e.EntityUUID},
+			CreatedAt: e.CreatedAt,
+			UpdatedAt: e.CreatedAt,
+		}
+
+	case *projectUpdatePayload:
+		project, ok := p.Projects[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("project %s not found", e.EntityUUID)
+		}
+
+		project.Name = payload.Name
+		project.Description = payload.Description
+		project.Slug = payload.Slug
+		project.Version++
+		project.UpdatedAt = e.CreatedAt
+		p.Projects[e.EntityUUID] = project
+		p.grant(e.EntityUUID, e.UserID, "owner")
+
+	case *projectReorderTasksPayload:
+		for i, taskUUID := range payload.Ranks {
+			p.Ranks[taskUUID] = legacyRank(i)
+		}
+
+		if project, ok := p.Projects[e.EntityUUID]; ok {
+			project.Version++
+			project.UpdatedAt = e.CreatedAt
+			p.Projects[e.EntityUUID] = project
+		}
+
+	case *releaseRebalanceTasksPayload:
+		for taskUUID, rank := range payload.Ranks {
+			if rank == "" {
+				delete(p.Ranks, taskUUID)
+				continue
+			}
+			p.Ranks[taskUUID] = rank
+		}
+
+	case *releaseCreatePayload:
+		if payload.Project.UUID == uuid.Nil {
+			return fmt.Errorf("release %s has no project", e.EntityUUID)
+		}
+
+		p.Releases[e.EntityUUID] = Release{
+			UUID:        e.EntityUUID,
+			Title:       payload.Title,
+			Description: payload.Description,
+			Project:     Project{UUID: payload.Project.UUID},
+			Version:     1,
+			CreatedAt:   e.CreatedAt,
+			UpdatedAt:   e.CreatedAt,
+		}
+
+	case *taskCreatePayload:
+		if payload.Release.UUID == uuid.Nil {
+			return fmt.Errorf("task %s has no release", e.EntityUUID)
+		}
+
+		p.Tasks[e.EntityUUID] = Task{
+			UUID:        e.EntityUUID,
+			Title:       payload.Title,
+			Description: payload.Description,
+			Status:      TaskStatusTODO,
+			Release:     Release{UUID: payload.Release.UUID},
+			Version:     1,
+			CreatedAt:   e.CreatedAt,
+			UpdatedAt:   e.CreatedAt,
+		}
+
+	case *taskUpdatePayload:
+		task, ok := p.Tasks[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("task %s not found", e.EntityUUID)
+		}
+
+		task.Title = payload.Title
+		task.Status = payload.Status
+		if payload.Description != nil {
+			task.Description = *payload.Description
+		}
+		task.Version++
+		task.UpdatedAt = e.CreatedAt
+		p.Tasks[e.EntityUUID] = task
+
+	case *taskDonePayload:
+		task, ok := p.Tasks[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("task %s not found", e.EntityUUID)
+		}
+
+		task.Status = TaskStatusDONE
+		task.Version++
+		task.UpdatedAt = e.CreatedAt
+		p.Tasks[e.EntityUUID] = task
+
+	case *taskMovePayload:
+		if _, ok := p.Tasks[e.EntityUUID]; !ok {
+			return fmt.Errorf("task %s not found", e.EntityUUID)
+		}
+
+		// Moves do not conflict with the other modifications of the
+		// task, they leave its version alone
+		p.Ranks[e.EntityUUID] = payload.Rank
+
+	case *taskMoveToReleasePayload:
+		task, ok := p.Tasks[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("task %s not found", e.EntityUUID)
+		}
+		if payload.Release.UUID == uuid.Nil {
+			return fmt.Errorf("task %s moved to no release", e.EntityUUID)
+		}
+
+		// The rank of the task was the one of its previous release
+		task.Release = Release{UUID: payload.Release.UUID}
+		task.Version++
+		task.UpdatedAt = e.CreatedAt
+		p.Tasks[e.EntityUUID] = task
+		delete(p.Ranks, e.EntityUUID)
+
+	case *trashPayload:
+		return p.applyTrash(e)
+
+	case *undoPayload:
+		compensation := e
+		compensation.Type = payload.Event.Type
+		compensation.Payload = payload.Event.Payload
+		compensation.SchemaVersion = 0
+		return p.Apply(compensation)
+
+	default:
+		return fmt.Errorf("unknown event type %s", e.Type)
+	}
+
+	return nil
+}
+
+// applyTrash applies e, an event moving an entity to the trash, out of
+// it, or purging it. Purging an entity purges what it contains, like
+// the foreign keys of the stores.
+func (p *Projection) applyTrash(e Event) error {
+	var deletedAt *time.Time
+	switch e.Type {
+	case TaskDelete, ReleaseDelete, ProjectDelete:
+		at := e.CreatedAt
+		deletedAt = &at
+	}
+
+	switch e.Type {
+	case TaskDelete, TaskRestore:
+		task, ok := p.Tasks[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("task %s not found", e.EntityUUID)
+		}
+		task.DeletedAt = deletedAt
+		p.Tasks[e.EntityUUID] = task
+
+	case ReleaseDelete, ReleaseRestore:
+		release, ok := p.Releases[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("release %s not found", e.EntityUUID)
+		}
+		release.DeletedAt = deletedAt
+		p.Releases[e.EntityUUID] = release
+
+	case ProjectDelete, ProjectRestore:
+		project, ok := p.Projects[e.EntityUUID]
+		if !ok {
+			return fmt.Errorf("project %s not found", e.EntityUUID)
+		}
+		project.DeletedAt = deletedAt
+		p.Projects[e.EntityUUID] = project
+
+	case TaskPurge:
+		p.purgeTask(e.EntityUUID)
+
+	case ReleasePurge:
+		p.purgeRelease(e.EntityUUID)
+
+	case ProjectPurge:
+		for id, release := range p.Releases {
+			if release.Project.UUID == e.EntityUUID {
+				p.purgeRelease(id)
+			}
+		}
+		delete(p.Projects, e.EntityUUID)
+		delete(p.Permissions, e.EntityUUID)
+
+	default:
+		return fmt.Errorf("unknown event type %s", e.Type)
+	}
+
+	return nil
+}
+
+func (p *Projection) purgeRelease(id uuid.UUID) {
+	for taskUUID, task := range p.Tasks {
+		if task.Release.UUID == id {
+			p.purgeTask(taskUUID)
+		}
+	}
+	delete(p.Releases, id)
+}
+
+func (p *Projection) purgeTask(id uuid.UUID) {
+	delete(p.Tasks, id)
+	delete(p.Ranks, id)
+}
+
+func (p *Projection) grant(projectUUID uuid.UUID, userID, perm string) {
+	// The events recorded before users existed have none, and nobody
+	// is granted anything in the tables either
+	if userID == "" {
+		return
+	}
+
+	perms, ok := p.Permissions[projectUUID]
+	if !ok {
+		perms = make(map[string]string)
+		p.Permissions[projectUUID] = perms
+	}
+
+	// Same as the stores: the first permission granted wins
+	if _, ok := perms[userID]; !ok {
+		perms[userID] = perm
+	}
+}
+
+// Diff lists, in a human readable way, the differences between p and
+// other. Dates are not compared: the stores set them from the clock
+// rather than from the events.
+func (p *Projection) Diff(other *Projection) []string {
+	diffs := make([]string, 0)
+	field := func(kind string, id uuid.UUID, name, a, b string) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("%s %s: %s %q != %q", kind, id, name, a, b))
+		}
+	}
+	only := func(kind string, id uuid.UUID, which string) {
+		diffs = append(diffs, fmt.Sprintf("%s %s: only in the %s projection", kind, id, which))
+	}
+
+	for id, project := range p.Projects {
+		o, ok := other.Projects[id]
+		if !ok {
+			only("project", id, "first")
+			continue
+		}
+		field("project", id, "name", project.Name, o.Name)
+		field("project", id, "slug", project.Slug, o.Slug)
+		field("project", id, "description", project.Description, o.Description)
+		field("project", id, "version", fmt.Sprint(project.Version), fmt.Sprint(o.Version))
+		field("project", id, "deleted", fmt.Sprint(project.DeletedAt != nil), fmt.Sprint(o.DeletedAt != nil))
+
+		for userID, perm := range p.Permissions[id] {
+			field("project", id, fmt.Sprintf("permission of %s", userID), perm, other.Permissions[id][userID])
+		}
+		for userID, perm := range other.Permissions[id] {
+			if _, ok := p.Permissions[id][userID]; !ok {
+				field("project", id, fmt.Sprintf("permission of %s", userID), "", perm)
+			}
+		}
+	}
+	for id := range other.Projects {
+		if _, ok := p.Projects[id]; !ok {
+			only("project", id, "second")
+		}
+	}
+
+	for id, release := range p.Releases {
+		o, ok := other.Releases[id]
+		if !ok {
+			only("release", id, "first")
+			continue
+		}
+		field("release", id, "title", release.Title, o.Title)
+		field("release", id, "description", release.Description, o.Description)
+		field("release", id, "project", release.Project.UUID.String(), o.Project.UUID.String())
+		field("release", id, "version", fmt.Sprint(release.Version), fmt.Sprint(o.Version))
+		field("release", id, "deleted", fmt.Sprint(release.DeletedAt != nil), fmt.Sprint(o.DeletedAt != nil))
+	}
+	for id := range other.Releases {
+		if _, ok := p.Releases[id]; !ok {
+			only("release", id, "second")
+		}
+	}
+
+	for id, task := range p.Tasks {
+		o, ok := other.Tasks[id]
+		if !ok {
+			only("task", id, "first")
+			continue
+		}
+		field("task", id, "title", task.Title, o.Title)
+		field("task", id, "description", task.Description, o.Description)
+		field("task", id, "status", string(task.Status), string(o.Status))
+		field("task", id, "release", task.Release.UUID.String(), o.Release.UUID.String())
+		field("task", id, "rank", rankString(p.Ranks, id), rankString(other.Ranks, id))
+		field("task", id, "version", fmt.Sprint(task.Version), fmt.Sprint(o.Version))
+		field("task", id, "deleted", fmt.Sprint(task.DeletedAt != nil), fmt.Sprint(o.DeletedAt != nil))
+	}
+	for id := range other.Tasks {
+		if _, ok := p.Tasks[id]; !ok {
+			only("task", id, "second")
+		}
+	}
+
+	sort.Strings(diffs)
+	return diffs
+}
+
+func rankString(ranks map[uuid.UUID]string, id uuid.UUID) string {
+	rank, ok := ranks[id]
+	if !ok {
+		return "none"
+	}
+	return rank
+}
@@ -0,0 +1,307 @@
+package tonight
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjection(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	legacyTaskUUID := uuid.NewV1()
+	now := time.Now()
+
+	events := []Event{
+		{
+			Type:       ProjectCreate,
+			EntityUUID: projectUUID,
+			UserID:     "user",
+			Payload:    []byte(`{"name": "My project"}`),
+		},
+		{
+			Type:       ReleaseCreate,
+			EntityUUID: releaseUUID,
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"title": "v1", "project": {"uuid": "%s"}}`, projectUUID)),
+		},
+		{
+			Type:       TaskCreate,
+			EntityUUID: taskUUID,
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, releaseUUID)),
+		},
+		{
+			Type:       TaskCreate,
+			EntityUUID: legacyTaskUUID,
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"title": "legacy", "project": {"uuid": "%s"}}`, projectUUID)),
+		},
+		{
+			Type:       TaskUpdate,
+			EntityUUID: taskUUID,
+			UserID:     "other",
+			Payload:    []byte(`{"title": "updated task", "status": "TODO"}`),
+		},
+		{
+			Type:       TaskDone,
+			EntityUUID: legacyTaskUUID,
+			UserID:     "user",
+			Payload:    []byte(`{}`),
+		},
+		{
+			Type:       ProjectReorderTasks,
+			EntityUUID: projectUUID,
+			UserID:     "user",
+			Payload:    []byte(fmt.Sprintf(`{"ranks": ["%s", "%s"]}`, legacyTaskUUID, taskUUID)),
+		},
+	}
+
+	p := NewProjection()
+	for i, e := range events {
+		e.UUID = uuid.NewV1()
+		e.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		require.NoError(t, p.Apply(e))
+	}
+
+	require.Len(t, p.Projects, 1)
+	require.Equal(t, "My project", p.Projects[projectUUID].Name)
+	require.Equal(t, projectSlug("My project", projectUUID), p.Projects[projectUUID].Slug)
+	require.Equal(t, 2, p.Projects[projectUUID].Version)
+	require.Equal(t, map[string]string{"user": "owner"}, p.Permissions[projectUUID])
+
+	require.Len(t, p.Releases, 2)
+	require.Equal(t, "Backlog", p.Releases[projectUUID].Title)
+	require.Equal(t, 0, p.Releases[projectUUID].Version)
+	require.Equal(t, 1, p.Releases[releaseUUID].Version)
+	require.Equal(t, projectUUID, p.Releases[releaseUUID].Project.UUID)
+
+	require.Len(t, p.Tasks, 2)
+	require.Equal(t, "updated task", p.Tasks[taskUUID].Title)
+	require.Equal(t, TaskStatusTODO, p.Tasks[taskUUID].Status)
+	require.Equal(t, releaseUUID, p.Tasks[taskUUID].Release.UUID)
+	require.Equal(t, TaskStatusDONE, p.Tasks[legacyTaskUUID].Status)
+	require.Equal(t, projectUUID, p.Tasks[legacyTaskUUID].Release.UUID)
+	require.Equal(t, map[uuid.UUID]string{legacyTaskUUID: "00000i", taskUUID: "00001i"}, p.Ranks)
+
+	require.Empty(t, p.Diff(p))
+
+	other := NewProjection()
+	for i, e := range events[:4] {
+		e.UUID = uuid.NewV1()
+		e.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		require.NoError(t, other.Apply(e))
+	}
+	require.Equal(t, []string{
+		fmt.Sprintf(`task %s: rank "00000i" != "none"`, legacyTaskUUID),
+		fmt.Sprintf(`task %s: status "DONE" != "TODO"`, legacyTaskUUID),
+		fmt.Sprintf(`task %s: version "2" != "1"`, legacyTaskUUID),
+		fmt.Sprintf(`task %s: rank "00001i" != "none"`, taskUUID),
+		fmt.Sprintf(`task %s: title "updated task" != "task"`, taskUUID),
+		fmt.Sprintf(`task %s: version "2" != "1"`, taskUUID),
+	}, sortedByTask(p.Diff(other), legacyTaskUUID, taskUUID))
+
+	require.Error(t, NewProjection().Apply(Event{Type: TaskDone, EntityUUID: taskUUID}))
+	require.Error(t, NewProjection().Apply(Event{Type: TaskCreate, EntityUUID: taskUUID, Payload: []byte(`{"title": "orphan"}`)}))
+}
+
+// sortedByTask puts the diffs of the first task first, as uuids do not
+// sort the same way as they are generated.
+func sortedByTask(diffs []string, first, second uuid.UUID) []string {
+	res := make([]string, 0, len(diffs))
+	for _, id := range []uuid.UUID{first, second} {
+		prefix := fmt.Sprintf("task %s", id)
+		for _, diff := range diffs {
+			if strings.HasPrefix(diff, prefix) {
+				res = append(res, diff)
+			}
+		}
+	}
+	return res
+}
+
+func TestProjectionTrash(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	now := time.Now()
+
+	p := NewProjection()
+	apply := func(typ EventType, id uuid.UUID, payload string) error {
+		return p.Apply(Event{
+			UUID:       uuid.NewV1(),
+			Type:       typ,
+			EntityUUID: id,
+			UserID:     "user",
+			Payload:    []byte(payload),
+			CreatedAt:  now,
+		})
+	}
+	require.NoError(t, apply(ProjectCreate, projectUUID, `{"name": "My project"}`))
+	require.NoError(t, apply(ReleaseCreate, releaseUUID, fmt.Sprintf(`{"title": "v1", "project": {"uuid": "%s"}}`, projectUUID)))
+	require.NoError(t, apply(TaskCreate, taskUUID, fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, releaseUUID)))
+
+	require.NoError(t, apply(TaskDelete, taskUUID, `{}`))
+	require.True(t, now.Equal(*p.Tasks[taskUUID].DeletedAt))
+	require.NoError(t, apply(TaskRestore, taskUUID, `{}`))
+	require.Nil(t, p.Tasks[taskUUID].DeletedAt)
+
+	require.NoError(t, apply(ReleaseDelete, releaseUUID, `{}`))
+	require.NoError(t, apply(ReleasePurge, releaseUUID, `{}`))
+	require.NotContains(t, p.Releases, releaseUUID)
+	require.NotContains(t, p.Tasks, taskUUID)
+
+	require.NoError(t, apply(ProjectDelete, projectUUID, `{}`))
+	require.NotNil(t, p.Projects[projectUUID].DeletedAt)
+	require.NoError(t, apply(ProjectPurge, projectUUID, `{}`))
+	require.Empty(t, p.Projects)
+	require.Empty(t, p.Releases)
+	require.Empty(t, p.Permissions)
+
+	require.Error(t, apply(TaskDelete, taskUUID, `{}`))
+}
+
+func TestProjectionMoveToRelease(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+
+	p := NewProjection()
+	for _, e := range []Event{
+		{Type: ProjectCreate, EntityUUID: projectUUID, Payload: []byte(`{"name": "My project"}`)},
+		{Type: ReleaseCreate, EntityUUID: releaseUUID, Payload: []byte(fmt.Sprintf(`{"title": "v1", "project": {"uuid": "%s"}}`, projectUUID))},
+		{Type: TaskCreate, EntityUUID: taskUUID, Payload: []byte(fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, projectUUID))},
+		{Type: TaskMove, EntityUUID: taskUUID, Payload: []byte(`{"rank": "i"}`)},
+		{Type: TaskMoveToRelease, EntityUUID: taskUUID, Payload: []byte(fmt.Sprintf(`{"release": {"uuid": "%s"}}`, releaseUUID))},
+	} {
+		e.UUID = uuid.NewV1()
+		e.UserID = "user"
+		e.CreatedAt = time.Now()
+		require.NoError(t, p.Apply(e))
+	}
+
+	require.Equal(t, releaseUUID, p.Tasks[taskUUID].Release.UUID)
+	require.Equal(t, 2, p.Tasks[taskUUID].Version)
+	require.NotContains(t, p.Ranks, taskUUID)
+
+	require.Error(t, p.Apply(Event{Type: TaskMoveToRelease, EntityUUID: taskUUID, Payload: []byte(`{}`)}))
+}
+
+func TestProjectionTaskDescription(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+
+	p := NewProjection()
+	steps := []struct {
+		event       Event
+		description string
+	}{
+		{
+			event:       Event{Type: ProjectCreate, EntityUUID: projectUUID, Payload: []byte(`{"name": "My project"}`)},
+			description: "",
+		},
+		{
+			event:       Event{Type: TaskCreate, EntityUUID: taskUUID, Payload: []byte(fmt.Sprintf(`{"title": "task", "description": "*spec*", "release": {"uuid": "%s"}}`, projectUUID))},
+			description: "*spec*",
+		},
+		// The updates without a description leave it alone
+		{
+			event:       Event{Type: TaskUpdate, EntityUUID: taskUUID, Payload: []byte(`{"title": "renamed", "status": "TODO"}`)},
+			description: "*spec*",
+		},
+		{
+			event:       Event{Type: TaskUpdate, EntityUUID: taskUUID, Payload: []byte(`{"title": "renamed", "status": "TODO", "description": "repro"}`)},
+			description: "repro",
+		},
+		{
+			event:       Event{Type: TaskUpdate, EntityUUID: taskUUID, Payload: []byte(`{"title": "renamed", "status": "TODO", "description": ""}`)},
+			description: "",
+		},
+	}
+	for _, step := range steps {
+		e := step.event
+		e.UUID = uuid.NewV1()
+		e.UserID = "user"
+		e.CreatedAt = time.Now()
+		require.NoError(t, p.Apply(e))
+		require.Equal(t, step.description, p.Tasks[taskUUID].Description)
+	}
+}
+
+func TestProjectionStoredPayloads(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+
+	// Events stored before today's rules are applied as they are
+	p := NewProjection()
+	for _, e := range []Event{
+		{Type: ProjectCreate, EntityUUID: projectUUID, Payload: []byte(`{"name": ""}`)},
+		{Type: ProjectUpdate, EntityUUID: projectUUID, Payload: []byte(`{"name": "", "description": "unnamed"}`)},
+		{Type: TaskCreate, EntityUUID: taskUUID, Payload: []byte(fmt.Sprintf(`{"title": "", "release": {"uuid": "%s"}}`, projectUUID))},
+	} {
+		e.UUID = uuid.NewV1()
+		e.UserID = "user"
+		e.CreatedAt = time.Now()
+		require.Error(t, ValidateEvent(e), e.Type)
+		require.NoError(t, p.Apply(e), e.Type)
+	}
+
+	require.Equal(t, "unnamed", p.Projects[projectUUID].Description)
+	require.Equal(t, "", p.Tasks[taskUUID].Title)
+}
+
+func TestReplayBaselineEvents(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	lostReleaseUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	legacyTaskUUID := uuid.NewV1()
+
+	// The live tables know the release and the task created from it
+	live := NewProjection()
+	live.Releases[releaseUUID] = Release{UUID: releaseUUID, Project: Project{UUID: projectUUID}}
+	live.Tasks[taskUUID] = Task{UUID: taskUUID, Release: Release{UUID: releaseUUID}}
+
+	now := time.Now()
+	store := &sliceEventStore{}
+	for i, e := range []Event{
+		// Recorded before users existed
+		{Type: ProjectCreate, EntityUUID: projectUUID, Payload: []byte(`{"name": "baseline"}`)},
+		{Type: ReleaseCreate, EntityUUID: releaseUUID, Payload: []byte(`{"title": "v1"}`)},
+		{Type: ReleaseCreate, EntityUUID: lostReleaseUUID, Payload: []byte(`{"title": "v0"}`)},
+		{Type: TaskCreate, EntityUUID: taskUUID, Payload: []byte(`{"title": "from the release"}`)},
+		{Type: TaskCreate, EntityUUID: legacyTaskUUID, Payload: []byte(fmt.Sprintf(`{"title": "legacy", "project": {"uuid": "%s"}}`, projectUUID))},
+		// Recorded before the entity uuids
+		{Type: TaskDone, Payload: []byte(`{}`)},
+	} {
+		e.UUID = uuid.NewV1()
+		e.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		require.NoError(t, store.Store(ctx, e))
+	}
+
+	p, skipped, err := Replay(ctx, store, EventFilter{}, live)
+	require.NoError(t, err)
+
+	require.Len(t, skipped, 2)
+	require.Equal(t, (*store)[2].UUID, skipped[0].Event.UUID)
+	require.Equal(t, (*store)[5].UUID, skipped[1].Event.UUID)
+
+	require.Empty(t, p.Permissions[projectUUID])
+	require.Equal(t, projectUUID, p.Releases[releaseUUID].Project.UUID)
+	require.NotContains(t, p.Releases, lostReleaseUUID)
+	require.Equal(t, releaseUUID, p.Tasks[taskUUID].Release.UUID)
+	require.Equal(t, projectUUID, p.Tasks[legacyTaskUUID].Release.UUID)
+
+	// Without the live tables, the task created from the release is
+	// skipped as well
+	_, skipped, err = Replay(ctx, store, EventFilter{}, nil)
+	require.NoError(t, err)
+	require.Len(t, skipped, 4)
+}
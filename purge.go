@@ -0,0 +1,144 @@
+package tonight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A Purger deletes for good the entities that have been in the trash
+// for longer than the retention, every interval.
+type Purger struct {
+	transactor Transactor
+	events     EventStore
+	trash      TrashStore
+	bus        *EventBus
+
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(
+	transactor Transactor,
+	events EventStore,
+	trash TrashStore,
+	bus *EventBus,
+	retention time.Duration,
+	interval time.Duration,
+) *Purger {
+	return &Purger{
+		transactor: transactor,
+		events:     events,
+		trash:      trash,
+		bus:        bus,
+		retention:  retention,
+		interval:   interval,
+	}
+}
+
+// Run purges the trash every interval, until ctx is done. Failing to
+// purge is only logged: the entities will be purged at the next tick.
+func (p *Purger) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if _, err := p.Purge(ctx, now); err != nil {
+				log.Printf("error purging the trash: %v", err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Purge deletes for good the entities deleted more than the retention
+// before now, and returns how many there were. Each purge is recorded
+// as an event in the name of the user who deleted the entity.
+func (p *Purger) Purge(ctx context.Context, now time.Time) (int, error) {
+	items, err := p.trash.Expired(ctx, now.Add(-p.retention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range items {
+		userID, err := p.deletedBy(ctx, item)
+		if err != nil {
+			return purged, fmt.Errorf("error finding who deleted %s %s: %w", item.Kind, item.UUID, err)
+		}
+
+		evt := Event{
+			UUID:        uuid.NewV1(),
+			Type:        trashEvents[item.Kind].purge,
+			EntityUUID:  item.UUID,
+			ProjectUUID: item.ProjectUUID,
+			UserID:      userID,
+			Payload:     []byte(`{}`),
+			CreatedAt:   time.Now(),
+		}
+		err = p.transactor.Transaction(ctx, func(ctx context.Context) error {
+			if err := p.events.Store(ctx, evt); err != nil {
+				return fmt.Errorf("error storing event: %w", err)
+			}
+
+			return p.trash.Purge(ctx, item.Kind, item.UUID)
+		})
+		// Already purged with what contained it
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("error purging %s %s: %w", item.Kind, item.UUID, err)
+		}
+
+		if p.bus != nil {
+			if err := p.bus.Publish(ctx, evt); err != nil {
+				log.Printf("error publishing event %s: %v", evt.UUID, err)
+			}
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// deletedBy returns the id of the user who last deleted item.
+func (p *Purger) deletedBy(ctx context.Context, item TrashItem) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.events.List(ctx, EventFilter{
+			Types:       []EventType{trashEvents[item.Kind].delete},
+			EntityUUIDs: []uuid.UUID{item.UUID},
+			Reverse:     true,
+			Limit:       1,
+		}, ch)
+	}()
+
+	var userID string
+	for e := range ch {
+		userID = e.UserID
+	}
+	if err := <-errc; err != nil {
+		return "", err
+	}
+	if userID == "" {
+		return "", fmt.Errorf("no %s event: %w", trashEvents[item.Kind].delete, ErrNotFound)
+	}
+	return userID, nil
+}
@@ -0,0 +1,80 @@
+package tonight_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+	"github.com/bobinette/tonight/inmem"
+)
+
+func TestPurger(t *testing.T) {
+	ctx := context.Background()
+	store := inmem.NewStore()
+	now := time.Now()
+
+	user := tonight.User{ID: "user"}
+	require.NoError(t, store.UserStore().Ensure(ctx, &user))
+	project := tonight.Project{UUID: uuid.NewV1(), Name: "purged", Slug: "purged", CreatedAt: now, UpdatedAt: now}
+	require.NoError(t, store.ProjectStore().Upsert(ctx, project, user))
+
+	tasks := make([]tonight.Task, 2)
+	for i := range tasks {
+		tasks[i] = tonight.Task{
+			UUID:      uuid.NewV1(),
+			Title:     "task",
+			Status:    tonight.TaskStatusTODO,
+			Release:   tonight.Release{UUID: project.UUID},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		require.NoError(t, store.TaskStore().Upsert(ctx, tasks[i]))
+	}
+
+	// The first task expired, the second one is still in the retention
+	for i, deletedAt := range []time.Time{now.Add(-2 * time.Hour), now.Add(-time.Minute)} {
+		require.NoError(t, store.EventStore().Store(ctx, tonight.Event{
+			UUID:        uuid.NewV1(),
+			Type:        tonight.TaskDelete,
+			EntityUUID:  tasks[i].UUID,
+			ProjectUUID: project.UUID,
+			UserID:      user.ID,
+			Payload:     []byte(`{}`),
+			CreatedAt:   deletedAt,
+		}))
+		require.NoError(t, store.TrashStore().Delete(ctx, tonight.TrashTask, tasks[i].UUID, deletedAt))
+	}
+
+	purger := tonight.NewPurger(store.Transactor(), store.EventStore(), store.TrashStore(), nil, time.Hour, 0)
+	purged, err := purger.Purge(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+
+	items, err := store.TrashStore().List(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	require.Equal(t, tasks[1].UUID, items[0].UUID)
+
+	// The purge is recorded in the name of who deleted the task
+	ch := make(chan tonight.Event)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- store.EventStore().List(ctx, tonight.EventFilter{Types: []tonight.EventType{tonight.TaskPurge}}, ch)
+	}()
+	var purges []tonight.Event
+	for e := range ch {
+		purges = append(purges, e)
+	}
+	require.NoError(t, <-errc)
+	require.Len(t, purges, 1)
+	require.Equal(t, tasks[0].UUID, purges[0].EntityUUID)
+	require.Equal(t, user.ID, purges[0].UserID)
+
+	purged, err = purger.Purge(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, 0, purged)
+}
@@ -0,0 +1,329 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Ranks are keys sorting the tasks of a release in lexicographic
+// order. They are the digits of a fraction between 0 and 1 in base 36,
+// without the trailing zeros, so that there is always room for a rank
+// between two others: moving a task only changes its own rank.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// maxRankLength is the length above which the ranks of a release are
+// spread evenly again, when moving tasks to the same place over and
+// over has made them too long.
+const maxRankLength = 16
+
+// legacyRank is the rank of the task at index i of the ranks of a
+// ProjectReorderTasks event, that ranked tasks with integers. The
+// migrations converting the rank columns use the same format.
+func legacyRank(i int) string {
+	return fmt.Sprintf("%05di", i)
+}
+
+func validateRank(rank string) error {
+	if rank == "" {
+		return errors.New("rank cannot be empty")
+	}
+	for _, r := range rank {
+		if !strings.ContainsRune(rankDigits, r) {
+			return fmt.Errorf("invalid rank %q: %q is not a base 36 digit", rank, r)
+		}
+	}
+	if strings.HasSuffix(rank, "0") {
+		return fmt.Errorf("invalid rank %q: trailing zero", rank)
+	}
+	return nil
+}
+
+// rankBetween returns a rank sorting after a and before b. An empty a
+// stands for the beginning of the list and an empty b for its end.
+func rankBetween(a, b string) (string, error) {
+	for _, rank := range []string{a, b} {
+		if rank == "" {
+			continue
+		}
+		if err := validateRank(rank); err != nil {
+			return "", err
+		}
+	}
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("rank %q is not before %q", a, b)
+	}
+	return midRank(a, b), nil
+}
+
+// midRank returns a rank between a and b, a being padded with zeros
+// where they are compared.
+func midRank(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			if n > len(a) {
+				return b[:n] + midRank("", b[n:])
+			}
+			return b[:n] + midRank(a[n:], b[n:])
+		}
+	}
+
+	digitA := strings.IndexByte(rankDigits, rankDigitAt(a, 0))
+	digitB := len(rankDigits)
+	if b != "" {
+		digitB = strings.IndexByte(rankDigits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(rankDigits[(digitA+digitB+1)/2])
+	}
+
+	// No digit in between: the rank starts like a and continues after
+	// it, unless b has more digits to stop before.
+	if len(b) > 1 {
+		return b[:1]
+	}
+	if a == "" {
+		return string(rankDigits[0]) + midRank("", "")
+	}
+	return a[:1] + midRank(a[1:], "")
+}
+
+func rankDigitAt(rank string, i int) byte {
+	if i < len(rank) {
+		return rank[i]
+	}
+	return rankDigits[0]
+}
+
+// spreadRanks returns n ranks in ascending order, spread evenly with
+// room for a few ranks between each of them.
+func spreadRanks(n int) []string {
+	width, space := 1, len(rankDigits)
+	for space < (n+1)*len(rankDigits) {
+		width++
+		space *= len(rankDigits)
+	}
+	step := space / (n + 1)
+
+	ranks := make([]string, n)
+	for i := range ranks {
+		digits := make([]byte, width)
+		value := (i + 1) * step
+		for j := width - 1; j >= 0; j-- {
+			digits[j] = rankDigits[value%len(rankDigits)]
+			value /= len(rankDigits)
+		}
+		ranks[i] = strings.TrimRight(string(digits), rankDigits[:1])
+	}
+	return ranks
+}
+
+// planMove returns the ranks to set to move the task identified by id
+// among tasks, the tasks of its release in their order, right before
+// the task before and/or right after the task after. Only the rank of
+// the moved task changes, unless the release needs rebalancing: when
+// the task is moved among unranked tasks, or its rank would be too
+// long. Then every task of the release is ranked again, and rebalanced
+// is true.
+func planMove(tasks []Task, id, before, after uuid.UUID) (ranks map[uuid.UUID]string, rebalanced bool, err error) {
+	if before == uuid.Nil && after == uuid.Nil {
+		return nil, false, invalid("before", "or after is required")
+	}
+	if before == id {
+		return nil, false, invalid("before", "cannot be the moved task")
+	}
+	if after == id {
+		return nil, false, invalid("after", "cannot be the moved task")
+	}
+
+	var moved Task
+	others := make([]Task, 0, len(tasks))
+	for _, t := range tasks {
+		if t.UUID == id {
+			moved = t
+			continue
+		}
+		others = append(others, t)
+	}
+	if moved.UUID != id {
+		return nil, false, fmt.Errorf("task %s is not in the release", id)
+	}
+
+	index := func(field string, neighbor uuid.UUID) (int, error) {
+		for i, t := range others {
+			if t.UUID == neighbor {
+				return i, nil
+			}
+		}
+		return 0, invalid(field, "is not in the release of task %s", id)
+	}
+
+	position := -1
+	if after != uuid.Nil {
+		i, err := index("after", after)
+		if err != nil {
+			return nil, false, err
+		}
+		position = i + 1
+	}
+	if before != uuid.Nil {
+		i, err := index("before", before)
+		if err != nil {
+			return nil, false, err
+		}
+		if position >= 0 && position != i {
+			return nil, false, invalid("before", "is not right after task %s", after)
+		}
+		position = i
+	}
+
+	var prev, next string
+	if position > 0 {
+		prev = others[position-1].Rank
+	}
+	if position < len(others) {
+		next = others[position].Rank
+	}
+	// Unranked tasks come last, so they only bound the rank when they
+	// come before the moved task.
+	if position == 0 || prev != "" {
+		rank, err := rankBetween(prev, next)
+		if err == nil && len(rank) <= maxRankLength {
+			return map[uuid.UUID]string{id: rank}, false, nil
+		}
+	}
+
+	order := make([]Task, 0, len(tasks))
+	order = append(order, others[:position]...)
+	order = append(order, moved)
+	order = append(order, others[position:]...)
+
+	ranks = make(map[uuid.UUID]string, len(order))
+	for i, rank := range spreadRanks(len(order)) {
+		ranks[order[i].UUID] = rank
+	}
+	return ranks, true, nil
+}
+
+func (s service) moveTask(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	id, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Before uuid.UUID `json:"before"`
+		After  uuid.UUID `json:"after"`
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return invalidBody(err)
+	}
+
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	task, err := s.taskStore.Get(ctx, id, user)
+	if err != nil {
+		return fmt.Errorf("error retrieving task: %w", err)
+	}
+
+	// The release lists its tasks in their current order
+	release, err := s.releaseStore.Get(ctx, task.Release.UUID)
+	if err != nil {
+		return err
+	}
+
+	ranks, rebalanced, err := planMove(release.Tasks, id, body.Before, body.After)
+	if err != nil {
+		return err
+	}
+
+	// The move and the rebalance it causes are undone together, see
+	// undoStacks
+	correlationID := uuid.NewV1()
+	now := time.Now()
+	movePayload, err := json.Marshal(taskMovePayload{
+		Rank:   ranks[id],
+		Before: body.Before,
+		After:  body.After,
+	})
+	if err != nil {
+		return err
+	}
+	events := []Event{{
+		UUID:          uuid.NewV1(),
+		Type:          TaskMove,
+		EntityUUID:    id,
+		ProjectUUID:   release.Project.UUID,
+		UserID:        user.ID,
+		CorrelationID: correlationID,
+		Payload:       movePayload,
+		CreatedAt:     now,
+	}}
+	if rebalanced {
+		rebalancePayload, err := json.Marshal(releaseRebalanceTasksPayload{Ranks: ranks})
+		if err != nil {
+			return err
+		}
+		events = append(events, Event{
+			UUID:          uuid.NewV1(),
+			Type:          ReleaseRebalanceTasks,
+			EntityUUID:    release.UUID,
+			ProjectUUID:   release.Project.UUID,
+			UserID:        user.ID,
+			CorrelationID: correlationID,
+			Payload:       rebalancePayload,
+			CreatedAt:     now,
+		})
+	}
+
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		for _, evt := range events {
+			if err := s.eventStore.Store(ctx, evt); err != nil {
+				return fmt.Errorf("error storing event: %w", err)
+			}
+		}
+
+		if err := s.taskStore.Rank(ctx, ranks); err != nil {
+			return fmt.Errorf("error ranking tasks: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, evt := range events {
+		publish(c, s.bus, evt)
+	}
+
+	task.Rank = ranks[id]
+	res, err := renderTasks(ctx, s.projectStore, user, task)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": res[0],
+	})
+}
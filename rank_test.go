@@ -0,0 +1,169 @@
+package tonight
+
+import (
+	"sort"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankBetween(t *testing.T) {
+	tests := map[string]struct {
+		a, b     string
+		expected string
+		err      bool
+	}{
+		"empty list":         {a: "", b: "", expected: "i"},
+		"first":              {a: "", b: "i", expected: "9"},
+		"last":               {a: "i", b: "", expected: "r"},
+		"next digits":        {a: "a", b: "b", expected: "ai"},
+		"common prefix":      {a: "1", b: "12", expected: "11"},
+		"before zeros":       {a: "", b: "0i", expected: "09"},
+		"legacy ranks":       {a: "00000i", b: "00001i", expected: "00001"},
+		"prefix of the next": {a: "1", b: "1i", expected: "19"},
+		"same rank":          {a: "i", b: "i", err: true},
+		"wrong order":        {a: "r", b: "i", err: true},
+		"trailing zero":      {a: "i0", b: "", err: true},
+		"invalid digit":      {a: "", b: "I", err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rank, err := rankBetween(test.a, test.b)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expected, rank)
+			require.NoError(t, validateRank(rank))
+		})
+	}
+
+	// Moving a task to the top over and over makes the ranks longer,
+	// but there is always room for another
+	next := "1"
+	for i := 0; i < 100; i++ {
+		rank, err := rankBetween("", next)
+		require.NoError(t, err)
+		require.True(t, rank < next, "%q is not before %q", rank, next)
+		next = rank
+	}
+}
+
+func TestSpreadRanks(t *testing.T) {
+	require.Equal(t, []string{"9", "i", "r"}, spreadRanks(3))
+
+	ranks := spreadRanks(1000)
+	require.Len(t, ranks, 1000)
+	require.True(t, sort.StringsAreSorted(ranks))
+	for i, rank := range ranks {
+		require.NoError(t, validateRank(rank))
+		if i > 0 {
+			require.NotEqual(t, ranks[i-1], rank)
+		}
+	}
+}
+
+func TestPlanMove(t *testing.T) {
+	tasks := make([]Task, 4)
+	for i, rank := range []string{"9", "i", "r", ""} {
+		tasks[i] = Task{UUID: uuid.NewV1(), Rank: rank}
+	}
+	unknown := uuid.NewV1()
+
+	tests := map[string]struct {
+		id, before, after uuid.UUID
+		expected          map[uuid.UUID]string
+		rebalanced        bool
+		err               bool
+	}{
+		"to the top": {
+			id:       tasks[2].UUID,
+			before:   tasks[0].UUID,
+			expected: map[uuid.UUID]string{tasks[2].UUID: "5"},
+		},
+		"between two tasks": {
+			id:       tasks[0].UUID,
+			before:   tasks[2].UUID,
+			after:    tasks[1].UUID,
+			expected: map[uuid.UUID]string{tasks[0].UUID: "n"},
+		},
+		"after the last ranked task": {
+			id:       tasks[3].UUID,
+			after:    tasks[2].UUID,
+			expected: map[uuid.UUID]string{tasks[3].UUID: "w"},
+		},
+		"among unranked tasks": {
+			id:    tasks[0].UUID,
+			after: tasks[3].UUID,
+			expected: map[uuid.UUID]string{
+				tasks[1].UUID: "77",
+				tasks[2].UUID: "ee",
+				tasks[3].UUID: "ll",
+				tasks[0].UUID: "ss",
+			},
+			rebalanced: true,
+		},
+		"no neighbor":         {id: tasks[0].UUID, err: true},
+		"next to itself":      {id: tasks[0].UUID, before: tasks[0].UUID, err: true},
+		"unknown task":        {id: unknown, before: tasks[0].UUID, err: true},
+		"unknown neighbor":    {id: tasks[0].UUID, before: unknown, err: true},
+		"not next to another": {id: tasks[3].UUID, before: tasks[2].UUID, after: tasks[0].UUID, err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ranks, rebalanced, err := planMove(tasks, test.id, test.before, test.after)
+			if test.err {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, test.expected, ranks)
+			require.Equal(t, test.rebalanced, rebalanced)
+		})
+	}
+
+	// Ranks too long to be extended rebalance the release
+	crowded := []Task{
+		{UUID: uuid.NewV1(), Rank: "1"},
+		{UUID: uuid.NewV1(), Rank: "1000000000000001"},
+		{UUID: uuid.NewV1(), Rank: "2"},
+	}
+	ranks, rebalanced, err := planMove(crowded, crowded[2].UUID, crowded[1].UUID, crowded[0].UUID)
+	require.NoError(t, err)
+	require.True(t, rebalanced)
+	require.Equal(t, map[uuid.UUID]string{crowded[0].UUID: "9", crowded[2].UUID: "i", crowded[1].UUID: "r"}, ranks)
+}
+
+func TestProjectionMove(t *testing.T) {
+	releaseUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	otherUUID := uuid.NewV1()
+
+	p := NewProjection()
+	p.Tasks[taskUUID] = Task{UUID: taskUUID, Version: 1}
+	p.Tasks[otherUUID] = Task{UUID: otherUUID, Version: 1}
+
+	require.NoError(t, p.Apply(Event{
+		Type:       TaskMove,
+		EntityUUID: taskUUID,
+		Payload:    []byte(`{"rank": "i"}`),
+	}))
+	require.Equal(t, map[uuid.UUID]string{taskUUID: "i"}, p.Ranks)
+	require.Equal(t, 1, p.Tasks[taskUUID].Version)
+
+	require.NoError(t, p.Apply(Event{
+		Type:       ReleaseRebalanceTasks,
+		EntityUUID: releaseUUID,
+		Payload:    []byte(`{"ranks": {"` + otherUUID.String() + `": "9", "` + taskUUID.String() + `": "r"}}`),
+	}))
+	require.Equal(t, map[uuid.UUID]string{otherUUID: "9", taskUUID: "r"}, p.Ranks)
+
+	require.Error(t, p.Apply(Event{Type: TaskMove, EntityUUID: uuid.NewV1(), Payload: []byte(`{"rank": "i"}`)}))
+	require.Error(t, ValidateEvent(Event{Type: TaskMove, EntityUUID: taskUUID, Payload: []byte(`{"rank": "i0"}`)}))
+}
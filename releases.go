@@ -3,7 +3,6 @@ package tonight
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -21,18 +20,28 @@ type Release struct {
 	Project Project `json:"project"`
 	Tasks   []Task  `json:"tasks"`
 
+	Version int `json:"version"`
+
 	CreatedAt time.Time `json:"createdat"`
 	UpdatedAt time.Time `json:"updatedat"`
+	// DeletedAt is only set for the releases in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// A ReleaseStore is responsible for storing releases. Upsert checks
+// and increments versions like TaskStore.Upsert.
 type ReleaseStore interface {
 	Get(ctx context.Context, id uuid.UUID) (Release, error)
+	// Head returns the release like Get, without its tasks.
+	Head(ctx context.Context, id uuid.UUID) (Release, error)
 	List(ctx context.Context, projectUUID uuid.UUID) ([]Release, error)
 
 	Upsert(ctx context.Context, release Release) error
 }
 
 type releaseService struct {
+	bus        *EventBus
+	transactor Transactor
 	store      ReleaseStore
 	userStore  UserStore
 	eventStore EventStore
@@ -46,12 +55,11 @@ func (s *releaseService) create(c echo.Context) error {
 		v: &release,
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&interceptor); err != nil {
-		fmt.Println("trololo")
-		return err
+		return invalidBody(err)
 	}
 
 	if release.UUID.String() != "" && release.UUID.String() != emptyUUID {
-		return errors.New("uuid should be empty")
+		return invalid("uuid", "should be empty")
 	}
 
 	ctx := c.Request().Context()
@@ -64,7 +72,7 @@ func (s *releaseService) create(c echo.Context) error {
 		return fmt.Errorf("error ensuring user: %w", err)
 	}
 
-	projectUUID, err := uuid.FromString(c.Param("project_uuid"))
+	projectUUID, err := uuidParam(c, "project_uuid")
 	if err != nil {
 		return err
 	}
@@ -74,31 +82,50 @@ func (s *releaseService) create(c echo.Context) error {
 		return err
 	}
 	if perm != "owner" {
-		return errors.New("insufficient permissions")
+		return ErrForbidden
+	}
+
+	// The project comes from the url, record it in the event
+	payload, err := setPayloadField(interceptor.raw, "project", map[string]interface{}{"uuid": projectUUID})
+	if err != nil {
+		return err
 	}
 
 	id := uuid.NewV1()
 	now := time.Now()
 	evt := Event{
-		UUID:       id,
-		Type:       ReleaseCreate,
-		EntityUUID: id,
-		UserID:     user.ID,
-		Payload:    interceptor.raw,
-		CreatedAt:  now,
+		UUID:        id,
+		Type:        ReleaseCreate,
+		EntityUUID:  id,
+		ProjectUUID: projectUUID,
+		UserID:      user.ID,
+		Payload:     payload,
+		CreatedAt:   now,
 	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return err
+		}
+
+		release.UUID = id
+		release.Project.UUID = projectUUID
+		release.Version = 0
+		release.CreatedAt = now
+		release.UpdatedAt = now
+		if err := s.store.Upsert(ctx, release); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
-	release.UUID = id
-	release.Project.UUID = projectUUID
-	release.CreatedAt = now
-	release.UpdatedAt = now
-	if err := s.store.Upsert(ctx, release); err != nil {
-		return err
-	}
+	publish(c, s.bus, evt)
 
+	release.Version = 1
+	setETag(c, release.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data": release,
 	})
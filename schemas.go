@@ -0,0 +1,379 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A Schema describes the payload of the events of a type: the struct
+// it decodes into, and the upcasters converting the payloads recorded
+// with the previous versions of the schema to the current one.
+type Schema struct {
+	// Payload returns a pointer to a new payload struct.
+	Payload func() payload
+
+	// Upcasters[i] converts a payload from version i+1 to i+2.
+	Upcasters []Upcaster
+}
+
+// An Upcaster converts a payload to the next version of its schema.
+type Upcaster func(payload []byte) ([]byte, error)
+
+// Version of the schema, starting at 1.
+func (s Schema) Version() int {
+	return len(s.Upcasters) + 1
+}
+
+type payload interface {
+	validate() error
+}
+
+var schemas = map[EventType]Schema{
+	TaskCreate: {
+		Payload: func() payload { return &taskCreatePayload{} },
+		Upcasters: []Upcaster{
+			upcastTaskCreateRelease,
+		},
+	},
+	TaskUpdate:  {Payload: func() payload { return &taskUpdatePayload{} }},
+	TaskDone:    {Payload: func() payload { return &taskDonePayload{} }},
+	TaskMove:    {Payload: func() payload { return &taskMovePayload{} }},
+	TaskDelete:  {Payload: func() payload { return &trashPayload{} }},
+	TaskRestore: {Payload: func() payload { return &trashPayload{} }},
+	TaskPurge:   {Payload: func() payload { return &trashPayload{} }},
+	TaskMoveToRelease: {
+		Payload: func() payload { return &taskMoveToReleasePayload{} },
+	},
+
+	ReleaseCreate:         {Payload: func() payload { return &releaseCreatePayload{} }},
+	ReleaseRebalanceTasks: {Payload: func() payload { return &releaseRebalanceTasksPayload{} }},
+	ReleaseDelete:         {Payload: func() payload { return &trashPayload{} }},
+	ReleaseRestore:        {Payload: func() payload { return &trashPayload{} }},
+	ReleasePurge:          {Payload: func() payload { return &trashPayload{} }},
+
+	ProjectCreate:       {Payload: func() payload { return &projectCreatePayload{} }},
+	ProjectUpdate:       {Payload: func() payload { return &projectUpdatePayload{} }},
+	ProjectReorderTasks: {Payload: func() payload { return &projectReorderTasksPayload{} }},
+	ProjectDelete:       {Payload: func() payload { return &trashPayload{} }},
+	ProjectRestore:      {Payload: func() payload { return &trashPayload{} }},
+	ProjectPurge:        {Payload: func() payload { return &trashPayload{} }},
+
+	Undo: {Payload: func() payload { return &undoPayload{} }},
+	Redo: {Payload: func() payload { return &undoPayload{} }},
+}
+
+// UpcastEvent converts the payload of e to the current version of its
+// schema. Events without schema version are considered as version 1.
+func UpcastEvent(e Event) (Event, error) {
+	schema, ok := schemas[e.Type]
+	if !ok {
+		return Event{}, fmt.Errorf("unknown event type %s", e.Type)
+	}
+
+	version := e.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	if version > schema.Version() {
+		return Event{}, fmt.Errorf("unknown version %d of %s schema", version, e.Type)
+	}
+
+	for ; version < schema.Version(); version++ {
+		payload, err := schema.Upcasters[version-1](e.Payload)
+		if err != nil {
+			return Event{}, fmt.Errorf("error upcasting %s payload to version %d: %w", e.Type, version+1, err)
+		}
+		e.Payload = payload
+	}
+	e.SchemaVersion = version
+	return e, nil
+}
+
+// ValidateEvent checks the payload of e against the current version of
+// its schema.
+func ValidateEvent(e Event) error {
+	p, err := decodePayload(e)
+	if err != nil {
+		return err
+	}
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", e.Type, err)
+	}
+	return nil
+}
+
+// decodePayload unmarshals the payload of e, in the current version of
+// its schema, without validating it: the rules only apply to the new
+// events, the stored ones were valid under the rules of their time.
+func decodePayload(e Event) (payload, error) {
+	schema, ok := schemas[e.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %s", e.Type)
+	}
+
+	p := schema.Payload()
+	if err := json.Unmarshal(e.Payload, p); err != nil {
+		return nil, fmt.Errorf("invalid %s payload: %w", e.Type, err)
+	}
+	return p, nil
+}
+
+// A SchemaEventStore wraps an EventStore to stamp and validate the
+// events stored, rejecting the invalid ones, and to upcast the events
+// listed.
+type SchemaEventStore struct {
+	store EventStore
+}
+
+func NewSchemaEventStore(store EventStore) SchemaEventStore {
+	return SchemaEventStore{store: store}
+}
+
+func (s SchemaEventStore) Store(ctx context.Context, e Event) error {
+	e, err := UpcastEvent(e)
+	if err != nil {
+		return err
+	}
+	if err := ValidateEvent(e); err != nil {
+		return err
+	}
+
+	return s.store.Store(ctx, e)
+}
+
+func (s SchemaEventStore) List(ctx context.Context, filter EventFilter, ch chan<- Event) error {
+	defer close(ch)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan Event)
+	errc := make(chan error, 1)
+	go func() { errc <- s.store.List(ctx, filter, events) }()
+
+	var err error
+	for e := range events {
+		if err != nil {
+			continue
+		}
+
+		upcast, upcastErr := UpcastEvent(e)
+		if upcastErr != nil {
+			err = fmt.Errorf("error upcasting event %s: %w", e.UUID, upcastErr)
+			cancel()
+			continue
+		}
+
+		select {
+		case ch <- upcast:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if listErr := <-errc; err == nil {
+		err = listErr
+	}
+	return err
+}
+
+// Payloads, in their current version
+
+type taskCreatePayload struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Release     struct {
+		UUID uuid.UUID `json:"uuid"`
+	} `json:"release"`
+}
+
+func (p *taskCreatePayload) validate() error {
+	if p.Title == "" {
+		return invalid("title", "cannot be empty")
+	}
+	if err := validateDescription(p.Description); err != nil {
+		return err
+	}
+	if p.Release.UUID == uuid.Nil {
+		return invalid("release", "is required")
+	}
+	return nil
+}
+
+// upcastTaskCreateRelease moves the project of the tasks created
+// before releases existed to their release: the project backlog, that
+// shares its uuid.
+func upcastTaskCreateRelease(b []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	project, ok := fields["project"]
+	if !ok {
+		return b, nil
+	}
+	if _, ok := fields["release"]; !ok {
+		fields["release"] = project
+	}
+	delete(fields, "project")
+
+	return json.Marshal(fields)
+}
+
+// taskUpdatePayload leaves the description of the task alone if it has
+// none, like the updates recorded before tasks had descriptions.
+type taskUpdatePayload struct {
+	Title       string     `json:"title"`
+	Status      TaskStatus `json:"status"`
+	Description *string    `json:"description,omitempty"`
+}
+
+func (p *taskUpdatePayload) validate() error {
+	if p.Title == "" {
+		return invalid("title", "cannot be empty")
+	}
+	if p.Description != nil {
+		if err := validateDescription(*p.Description); err != nil {
+			return err
+		}
+	}
+	if p.Status != TaskStatusTODO && p.Status != TaskStatusDONE {
+		return invalid("status", "should be %s or %s, got %q", TaskStatusTODO, TaskStatusDONE, p.Status)
+	}
+	return nil
+}
+
+func validateDescription(description string) error {
+	if n := utf8.RuneCountInString(description); n > maxDescriptionLength {
+		return invalid("description", "should be at most %d characters long, got %d", maxDescriptionLength, n)
+	}
+	return nil
+}
+
+type taskDonePayload struct{}
+
+func (p *taskDonePayload) validate() error {
+	return nil
+}
+
+// taskMovePayload records the neighbors the task was moved between,
+// and the rank it got.
+type taskMovePayload struct {
+	Rank   string    `json:"rank"`
+	Before uuid.UUID `json:"before"`
+	After  uuid.UUID `json:"after"`
+}
+
+func (p *taskMovePayload) validate() error {
+	return validateRank(p.Rank)
+}
+
+type taskMoveToReleasePayload struct {
+	Release struct {
+		UUID uuid.UUID `json:"uuid"`
+	} `json:"release"`
+}
+
+func (p *taskMoveToReleasePayload) validate() error {
+	if p.Release.UUID == uuid.Nil {
+		return invalid("release", "is required")
+	}
+	return nil
+}
+
+type releaseCreatePayload struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Project     struct {
+		UUID uuid.UUID `json:"uuid"`
+	} `json:"project"`
+}
+
+func (p *releaseCreatePayload) validate() error {
+	if p.Title == "" {
+		return invalid("title", "cannot be empty")
+	}
+	if p.Project.UUID == uuid.Nil {
+		return invalid("project", "is required")
+	}
+	return nil
+}
+
+// releaseRebalanceTasksPayload sets the ranks of tasks of a release.
+// An empty rank unranks a task, undoing its first move for instance.
+type releaseRebalanceTasksPayload struct {
+	Ranks map[uuid.UUID]string `json:"ranks"`
+}
+
+func (p *releaseRebalanceTasksPayload) validate() error {
+	for _, rank := range p.Ranks {
+		if rank == "" {
+			continue
+		}
+		if err := validateRank(rank); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type projectCreatePayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func (p *projectCreatePayload) validate() error {
+	if p.Name == "" {
+		return invalid("name", "cannot be empty")
+	}
+	return nil
+}
+
+type projectUpdatePayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Slug        string `json:"slug"`
+}
+
+func (p *projectUpdatePayload) validate() error {
+	if p.Name == "" {
+		return invalid("name", "cannot be empty")
+	}
+	return nil
+}
+
+// projectReorderTasksPayload is the payload of the events recorded
+// when tasks were ranked by sending the whole list, see legacyRank.
+type projectReorderTasksPayload struct {
+	Ranks []uuid.UUID `json:"ranks"`
+}
+
+func (p *projectReorderTasksPayload) validate() error {
+	return nil
+}
+
+// trashPayload is the payload of the events moving an entity to the
+// trash, out of it, or purging it. The type of the event tells which.
+type trashPayload struct{}
+
+func (p *trashPayload) validate() error {
+	return nil
+}
+
+func (p *undoPayload) validate() error {
+	if p.EventUUID == uuid.Nil {
+		return errors.New("no event to undo or redo")
+	}
+
+	switch p.Event.Type {
+	case TaskUpdate, ProjectReorderTasks, ReleaseRebalanceTasks:
+	default:
+		return fmt.Errorf("invalid compensating event type %s", p.Event.Type)
+	}
+	return ValidateEvent(Event{Type: p.Event.Type, Payload: p.Event.Payload})
+}
@@ -0,0 +1,72 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaEventStore(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+
+	inner := &sliceEventStore{}
+	store := NewSchemaEventStore(inner)
+
+	// Invalid payloads are rejected
+	err := store.Store(ctx, Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskUpdate,
+		EntityUUID: uuid.NewV1(),
+		Payload:    []byte(`{"title": "task", "status": "NOPE"}`),
+	})
+	require.Error(t, err)
+	err = store.Store(ctx, Event{
+		UUID:       uuid.NewV1(),
+		Type:       ProjectCreate,
+		EntityUUID: projectUUID,
+		Payload:    []byte(`{"name": 12}`),
+	})
+	require.Error(t, err)
+	require.Empty(t, *inner)
+
+	// Valid ones are stamped with the current version of their schema
+	require.NoError(t, store.Store(ctx, Event{
+		UUID:       uuid.NewV1(),
+		Type:       ProjectCreate,
+		EntityUUID: projectUUID,
+		Payload:    []byte(`{"name": "project"}`),
+	}))
+	require.Equal(t, 1, (*inner)[0].SchemaVersion)
+
+	// Legacy task payloads are upcast on read
+	legacy := Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskCreate,
+		EntityUUID: uuid.NewV1(),
+		Payload:    []byte(fmt.Sprintf(`{"title": "legacy", "project": {"uuid": "%s"}}`, projectUUID)),
+	}
+	require.NoError(t, inner.Store(ctx, legacy))
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() { errc <- store.List(ctx, EventFilter{EntityUUIDs: []uuid.UUID{legacy.EntityUUID}}, ch) }()
+	events := make([]Event, 0)
+	for e := range ch {
+		events = append(events, e)
+	}
+	require.NoError(t, <-errc)
+	require.Len(t, events, 1)
+	require.Equal(t, 2, events[0].SchemaVersion)
+
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(events[0].Payload, &payload))
+	require.Equal(t, map[string]interface{}{
+		"title":   "legacy",
+		"release": map[string]interface{}{"uuid": projectUUID.String()},
+	}, payload)
+}
@@ -1,10 +1,13 @@
 package tonight
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gosimple/slug"
@@ -18,57 +21,125 @@ const (
 
 func RegisterHTTP(
 	srv *echo.Group,
+	bus *EventBus,
+	transactor Transactor,
 	eventStore EventStore,
+	snapshotStore SnapshotStore,
 	taskStore TaskStore,
 	projectStore ProjectStore,
 	releaseStore ReleaseStore,
 	userStore UserStore,
+	webhookStore WebhookStore,
+	trashStore TrashStore,
 ) error {
-	s := newService(eventStore, taskStore, projectStore, releaseStore, userStore)
+	s := newService(bus, transactor, eventStore, snapshotStore, taskStore, projectStore, releaseStore, userStore)
 	releaseSrv := releaseService{
+		bus:        bus,
+		transactor: transactor,
 		store:      releaseStore,
 		eventStore: eventStore,
 		userStore:  userStore,
 	}
+	trashSrv := trashService{
+		bus:          bus,
+		transactor:   transactor,
+		eventStore:   eventStore,
+		store:        trashStore,
+		taskStore:    taskStore,
+		releaseStore: releaseStore,
+		projectStore: projectStore,
+		userStore:    userStore,
+	}
+	bulkSrv := bulkService{
+		bus:          bus,
+		transactor:   transactor,
+		eventStore:   eventStore,
+		taskStore:    taskStore,
+		projectStore: projectStore,
+		releaseStore: releaseStore,
+		trashStore:   trashStore,
+		userStore:    userStore,
+	}
+	webhookSrv := webhookService{
+		store:     webhookStore,
+		userStore: userStore,
+	}
+	streamSrv := streamService{
+		bus:        bus,
+		eventStore: eventStore,
+		userStore:  userStore,
+		heartbeat:  15 * time.Second,
+	}
 
 	srv.POST("/tasks/:uuid", s.updateTask)
+	srv.DELETE("/tasks/:uuid", trashSrv.deleteTask)
 	srv.POST("/tasks/:uuid/done", s.markAsDone)
+	srv.POST("/tasks/:uuid/move", s.moveTask)
+	srv.GET("/tasks/:uuid/history", s.taskHistory)
 	// srv.POST("/tasks", s.createTask)
 
+	srv.POST("/undo", s.undo)
+	srv.POST("/redo", s.redo)
+
 	srv.POST("/projects", s.createProject)
 	srv.GET("/projects", s.listProjects)
 	srv.GET("/projects/:uuid", s.getProject)
 	srv.GET("/projects/slug/:slug", s.findProject)
 	srv.POST("/projects/:uuid", s.updateProject)
 	srv.POST("/projects/:uuid/tasks/ranks", s.rankTasks)
+	srv.DELETE("/projects/:uuid", trashSrv.deleteProject)
+	srv.GET("/projects/:uuid/history", s.projectHistory)
+	srv.GET("/projects/:uuid/audit", s.audit)
+	srv.POST("/projects/:uuid/tasks/bulk", bulkSrv.apply)
+	srv.GET("/projects/:uuid/events/stream", streamSrv.stream)
+	srv.GET("/projects/:uuid/webhooks", webhookSrv.list)
+	srv.POST("/projects/:uuid/webhooks", webhookSrv.create)
+	srv.POST("/projects/:uuid/webhooks/:webhook_uuid", webhookSrv.update)
+	srv.DELETE("/projects/:uuid/webhooks/:webhook_uuid", webhookSrv.delete)
+	srv.GET("/projects/:uuid/webhooks/:webhook_uuid/deliveries", webhookSrv.deliveries)
 
 	srv.POST("/projects/:project_uuid/releases", releaseSrv.create)
+	srv.DELETE("/projects/:project_uuid/releases/:release_uuid", trashSrv.deleteRelease)
+	srv.GET("/projects/:project_uuid/releases/:release_uuid/tasks", s.listTasks)
 	srv.POST("/projects/:project_uuid/releases/:release_uuid/tasks", s.createTask)
+	srv.GET("/projects/:project_uuid/releases/:release_uuid/history", s.releaseHistory)
+
+	srv.GET("/trash", trashSrv.list)
+	srv.POST("/trash/:uuid/restore", trashSrv.restore)
 
 	return nil
 }
 
 type service struct {
-	eventStore   EventStore
-	taskStore    TaskStore
-	projectStore ProjectStore
-	releaseStore ReleaseStore
-	userStore    UserStore
+	bus           *EventBus
+	transactor    Transactor
+	eventStore    EventStore
+	snapshotStore SnapshotStore
+	taskStore     TaskStore
+	projectStore  ProjectStore
+	releaseStore  ReleaseStore
+	userStore     UserStore
 }
 
 func newService(
+	bus *EventBus,
+	transactor Transactor,
 	eventStore EventStore,
+	snapshotStore SnapshotStore,
 	taskStore TaskStore,
 	projectStore ProjectStore,
 	releaseStore ReleaseStore,
 	userStore UserStore,
 ) service {
 	return service{
-		eventStore:   eventStore,
-		taskStore:    taskStore,
-		projectStore: projectStore,
-		releaseStore: releaseStore,
-		userStore:    userStore,
+		bus:           bus,
+		transactor:    transactor,
+		eventStore:    eventStore,
+		snapshotStore: snapshotStore,
+		taskStore:     taskStore,
+		projectStore:  projectStore,
+		releaseStore:  releaseStore,
+		userStore:     userStore,
 	}
 }
 
@@ -80,11 +151,11 @@ func (s service) createTask(c echo.Context) error {
 		v: &t,
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&interceptor); err != nil {
-		return err
+		return invalidBody(err)
 	}
 
 	if t.UUID.String() != "" && t.UUID.String() != emptyUUID {
-		return errors.New("uuid should be empty")
+		return invalid("uuid", "should be empty")
 	}
 
 	ctx := c.Request().Context()
@@ -97,7 +168,7 @@ func (s service) createTask(c echo.Context) error {
 		return fmt.Errorf("error ensuring user: %w", err)
 	}
 
-	projectUUID, err := uuid.FromString(c.Param("project_uuid"))
+	projectUUID, err := uuidParam(c, "project_uuid")
 	if err != nil {
 		return err
 	}
@@ -107,10 +178,10 @@ func (s service) createTask(c echo.Context) error {
 		return err
 	}
 	if perm != "owner" {
-		return errors.New("insufficient permissions")
+		return ErrForbidden
 	}
 
-	releaseUUID, err := uuid.FromString(c.Param("release_uuid"))
+	releaseUUID, err := uuidParam(c, "release_uuid")
 	if err != nil {
 		return err
 	}
@@ -119,41 +190,64 @@ func (s service) createTask(c echo.Context) error {
 		return err
 	}
 	if release.Project.UUID.String() != projectUUID.String() {
-		return errors.New("release not found")
+		return fmt.Errorf("release %s: %w", releaseUUID, ErrNotFound)
+	}
+
+	// The release comes from the url, record it in the event
+	payload, err := setPayloadField(interceptor.raw, "release", map[string]interface{}{"uuid": releaseUUID})
+	if err != nil {
+		return err
 	}
 
 	id := uuid.NewV1()
 	now := time.Now()
 	evt := Event{
-		UUID:       id,
-		Type:       TaskCreate,
-		EntityUUID: id,
-		UserID:     user.ID,
-		Payload:    interceptor.raw,
-		CreatedAt:  now,
-	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
+		UUID:        id,
+		Type:        TaskCreate,
+		EntityUUID:  id,
+		ProjectUUID: projectUUID,
+		UserID:      user.ID,
+		Payload:     payload,
+		CreatedAt:   now,
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return err
+		}
+
+		t.UUID = id
+		t.Status = TaskStatusTODO
+		t.Release.UUID = releaseUUID
+		t.Version = 0
+		t.CreatedAt = now
+		t.UpdatedAt = now
+		if err := s.taskStore.Upsert(ctx, t); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
-	t.UUID = id
-	t.Status = TaskStatusTODO
-	t.Release.UUID = releaseUUID
-	t.CreatedAt = now
-	t.UpdatedAt = now
-	if err := s.taskStore.Upsert(ctx, t); err != nil {
+	publish(c, s.bus, evt)
+
+	t.Version = 1
+	res, err := renderTasks(ctx, s.projectStore, user, t)
+	if err != nil {
 		return err
 	}
-
+	setETag(c, t.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"data": t,
+		"data": res[0],
 	})
 }
 
 func (s service) updateTask(c echo.Context) error {
 	defer c.Request().Body.Close()
 
-	id, err := uuid.FromString(c.Param("uuid"))
+	id, err := uuidParam(c, "uuid")
 	if err != nil {
 		return err
 	}
@@ -163,11 +257,11 @@ func (s service) updateTask(c echo.Context) error {
 		v: &t,
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&interceptor); err != nil {
-		return err
+		return invalidBody(err)
 	}
 
 	if t.UUID.String() != id.String() {
-		return fmt.Errorf("invalid data: %w", errors.New("uuids should be the same"))
+		return invalid("uuid", "should be the uuid of the url")
 	}
 
 	ctx := c.Request().Context()
@@ -185,7 +279,7 @@ func (s service) updateTask(c echo.Context) error {
 		return fmt.Errorf("error retrieving task: %w", err)
 	}
 	if task.UUID.String() == emptyUUID {
-		return fmt.Errorf("task %s not found", id)
+		return fmt.Errorf("task %s: %w", id, ErrNotFound)
 	}
 
 	release, err := s.releaseStore.Get(ctx, task.Release.UUID)
@@ -198,28 +292,58 @@ func (s service) updateTask(c echo.Context) error {
 	}
 
 	if t.Title == "" {
-		return errors.New("title cannot be empty")
+		return invalid("title", "cannot be empty")
+	}
+	// Tasks change release through the bulk endpoint only
+	t.Release = task.Release
+
+	// The description is kept if the body has none
+	var update taskUpdatePayload
+	if err := json.Unmarshal(interceptor.raw, &update); err != nil {
+		return invalidBody(err)
+	}
+	if update.Description == nil {
+		t.Description = task.Description
+	}
+
+	t.Version, err = expectedVersion(c, t.Version, task.Version)
+	if err != nil {
+		return err
 	}
 
 	eventUUID := uuid.NewV1()
 	now := time.Now()
 	evt := Event{
-		UUID:       eventUUID,
-		Type:       TaskUpdate,
-		EntityUUID: id,
-		UserID:     user.ID,
-		Payload:    interceptor.raw,
-		CreatedAt:  now,
+		UUID:        eventUUID,
+		Type:        TaskUpdate,
+		EntityUUID:  id,
+		ProjectUUID: release.Project.UUID,
+		UserID:      user.ID,
+		Payload:     interceptor.raw,
+		CreatedAt:   now,
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		t.UpdatedAt = time.Now()
+		if err := s.taskStore.Upsert(ctx, t); err != nil {
+			return fmt.Errorf("error updating task: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return s.taskConflict(c, err, id, user)
 	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
-		return fmt.Errorf("error storing event: %w", err)
+	if err != nil {
+		return err
 	}
 
-	t.UpdatedAt = time.Now()
-	if err := s.taskStore.Upsert(ctx, t); err != nil {
-		return fmt.Errorf("error updating task: %w", err)
-	}
+	publish(c, s.bus, evt)
 
+	setETag(c, t.Version+1)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data": "ok",
 	})
@@ -228,7 +352,7 @@ func (s service) updateTask(c echo.Context) error {
 func (s service) markAsDone(c echo.Context) error {
 	defer c.Request().Body.Close()
 
-	id, err := uuid.FromString(c.Param("uuid"))
+	id, err := uuidParam(c, "uuid")
 	if err != nil {
 		return err
 	}
@@ -248,7 +372,7 @@ func (s service) markAsDone(c echo.Context) error {
 		return fmt.Errorf("error retrieving task: %w", err)
 	}
 	if task.UUID.String() == emptyUUID {
-		return fmt.Errorf("task %s not found", id)
+		return fmt.Errorf("task %s: %w", id, ErrNotFound)
 	}
 
 	release, err := s.releaseStore.Get(ctx, task.Release.UUID)
@@ -260,26 +384,45 @@ func (s service) markAsDone(c echo.Context) error {
 		return err
 	}
 
+	task.Version, err = expectedVersion(c, 0, task.Version)
+	if err != nil {
+		return err
+	}
+
 	eventUUID := uuid.NewV1()
 	now := time.Now()
 	evt := Event{
-		UUID:       eventUUID,
-		Type:       TaskDone,
-		EntityUUID: id,
-		UserID:     user.ID,
-		Payload:    []byte("{}"),
-		CreatedAt:  now,
+		UUID:        eventUUID,
+		Type:        TaskDone,
+		EntityUUID:  id,
+		ProjectUUID: release.Project.UUID,
+		UserID:      user.ID,
+		Payload:     []byte("{}"),
+		CreatedAt:   now,
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		task.Status = TaskStatusDONE
+		task.UpdatedAt = time.Now()
+		if err := s.taskStore.Upsert(ctx, task); err != nil {
+			return fmt.Errorf("error updating task: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return s.taskConflict(c, err, id, user)
 	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
-		return fmt.Errorf("error storing event: %w", err)
+	if err != nil {
+		return err
 	}
 
-	task.Status = TaskStatusDONE
-	task.UpdatedAt = time.Now()
-	if err := s.taskStore.Upsert(ctx, task); err != nil {
-		return fmt.Errorf("error updating task: %w", err)
-	}
+	publish(c, s.bus, evt)
 
+	setETag(c, task.Version+1)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data": "ok",
 	})
@@ -293,11 +436,11 @@ func (s service) createProject(c echo.Context) error {
 		v: &project,
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&interceptor); err != nil {
-		return fmt.Errorf("error deconding request: %w", err)
+		return invalidBody(err)
 	}
 
 	if project.UUID.String() != "" && project.UUID.String() != emptyUUID {
-		return fmt.Errorf("invalid data: %w", errors.New("uuid should be empty"))
+		return invalid("uuid", "should be empty")
 	}
 
 	ctx := c.Request().Context()
@@ -313,25 +456,38 @@ func (s service) createProject(c echo.Context) error {
 	id := uuid.NewV1()
 	now := time.Now()
 	evt := Event{
-		UUID:       id,
-		Type:       ProjectCreate,
-		EntityUUID: id,
-		UserID:     user.ID,
-		Payload:    interceptor.raw,
-		CreatedAt:  now,
-	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
-		return fmt.Errorf("error storing event: %w", err)
+		UUID:        id,
+		Type:        ProjectCreate,
+		EntityUUID:  id,
+		ProjectUUID: id,
+		UserID:      user.ID,
+		Payload:     interceptor.raw,
+		CreatedAt:   now,
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		project.UUID = id
+		project.Slug = projectSlug(project.Name, id)
+		project.Version = 0
+		project.CreatedAt = now
+		project.UpdatedAt = now
+		if err := s.projectStore.Upsert(ctx, project, user); err != nil {
+			return fmt.Errorf("error storing project: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	project.UUID = id
-	project.Slug = fmt.Sprintf("%s-%s", slug.Make(project.Name), id.String()[:8])
-	project.CreatedAt = now
-	project.UpdatedAt = now
-	if err := s.projectStore.Upsert(ctx, project, user); err != nil {
-		return fmt.Errorf("error storing project: %w", err)
-	}
+	publish(c, s.bus, evt)
 
+	project.Version = 1
+	setETag(c, project.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"data": project,
 	})
@@ -340,7 +496,7 @@ func (s service) createProject(c echo.Context) error {
 func (s service) updateProject(c echo.Context) error {
 	defer c.Request().Body.Close()
 
-	id, err := uuid.FromString(c.Param("uuid"))
+	id, err := uuidParam(c, "uuid")
 	if err != nil {
 		return err
 	}
@@ -350,11 +506,11 @@ func (s service) updateProject(c echo.Context) error {
 		v: &project,
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&interceptor); err != nil {
-		return fmt.Errorf("error deconding request: %w", err)
+		return invalidBody(err)
 	}
 
 	if project.UUID.String() != id.String() {
-		return fmt.Errorf("invalid data: %w", errors.New("uuids should be the same"))
+		return invalid("uuid", "should be the uuid of the url")
 	}
 
 	user, err := userFromHeader(c)
@@ -364,31 +520,55 @@ func (s service) updateProject(c echo.Context) error {
 
 	ctx := c.Request().Context()
 
-	_, err = s.projectStore.Get(ctx, id, user)
+	current, err := s.projectStore.Get(ctx, id, user)
+	if err != nil {
+		return err
+	}
+
+	project.Version, err = expectedVersion(c, project.Version, current.Version)
 	if err != nil {
 		return err
 	}
 
 	now := time.Now()
 	evt := Event{
-		UUID:       uuid.NewV1(),
-		Type:       ProjectUpdate,
-		EntityUUID: id,
-		UserID:     user.ID,
-		Payload:    interceptor.raw,
-		CreatedAt:  now,
+		UUID:        uuid.NewV1(),
+		Type:        ProjectUpdate,
+		EntityUUID:  id,
+		ProjectUUID: id,
+		UserID:      user.ID,
+		Payload:     interceptor.raw,
+		CreatedAt:   now,
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		project.UpdatedAt = now
+		if err := s.projectStore.Upsert(ctx, project, user); err != nil {
+			return fmt.Errorf("error storing project: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return s.projectConflict(c, err, id, user)
 	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
-		return fmt.Errorf("error storing event: %w", err)
+	if err != nil {
+		return err
 	}
 
-	project.UpdatedAt = now
-	if err := s.projectStore.Upsert(ctx, project, user); err != nil {
-		return fmt.Errorf("error storing project: %w", err)
-	}
+	publish(c, s.bus, evt)
 
+	project.Version++
+	res, err := renderProject(ctx, s.projectStore, user, project)
+	if err != nil {
+		return err
+	}
+	setETag(c, project.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"data": project,
+		"data": res,
 	})
 }
 
@@ -404,14 +584,18 @@ func (s service) findProject(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	res, err := renderProject(ctx, s.projectStore, user, project)
+	if err != nil {
+		return err
+	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"data": project,
+		"data": res,
 	})
 }
 
 func (s service) getProject(c echo.Context) error {
-	id, err := uuid.FromString(c.Param("uuid"))
+	id, err := uuidParam(c, "uuid")
 	if err != nil {
 		return err
 	}
@@ -421,54 +605,46 @@ func (s service) getProject(c echo.Context) error {
 		return err
 	}
 
-	ctx := c.Request().Context()
-	project, err := s.projectStore.Get(ctx, id, user)
-	if err != nil {
-		return err
+	if asOf := c.QueryParam("as_of"); asOf != "" {
+		return s.projectAsOf(c, user, id, asOf)
 	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
-		"data": project,
-	})
-}
-
-func (s service) listProjects(c echo.Context) error {
 	ctx := c.Request().Context()
-
-	user, err := userFromHeader(c)
+	project, err := s.projectStore.Get(ctx, id, user)
 	if err != nil {
 		return err
 	}
-	if err := s.userStore.Ensure(ctx, &user); err != nil {
-		return fmt.Errorf("error ensuring user: %w", err)
-	}
-
-	projects, err := s.projectStore.List(ctx, user)
+	res, err := renderProject(ctx, s.projectStore, user, project)
 	if err != nil {
 		return err
 	}
 
+	setETag(c, project.Version)
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"data": projects,
+		"data": res,
 	})
 }
 
+// rankTasks ranks the tasks of the project in the order of the list.
+// It predates moveTask and records the same ProjectReorderTasks events
+// as before, the listed tasks getting their legacy rank.
 func (s service) rankTasks(c echo.Context) error {
 	defer c.Request().Body.Close()
 
-	projectUUID, err := uuid.FromString(c.Param("uuid"))
+	projectUUID, err := uuidParam(c, "uuid")
 	if err != nil {
 		return err
 	}
 
 	var body struct {
-		Ranks []uuid.UUID `json:"ranks"`
+		Ranks   []uuid.UUID `json:"ranks"`
+		Version int         `json:"version"`
 	}
 	interceptor := payloadInterceptor{
 		v: &body,
 	}
 	if err := json.NewDecoder(c.Request().Body).Decode(&interceptor); err != nil {
-		return fmt.Errorf("error deconding request: %w", err)
+		return invalidBody(err)
 	}
 
 	ctx := c.Request().Context()
@@ -486,31 +662,143 @@ func (s service) rankTasks(c echo.Context) error {
 		return err
 	}
 	if perm != "owner" {
-		return errors.New("insufficient permissions")
+		return ErrForbidden
 	}
 
-	evt := Event{
-		UUID:       uuid.NewV1(),
-		Type:       ProjectReorderTasks,
-		EntityUUID: projectUUID,
-		UserID:     user.ID,
-		Payload:    interceptor.raw,
-		CreatedAt:  time.Now(),
+	// Reordering is an event of the project, so it bumps its version
+	project, err := s.projectStore.Get(ctx, projectUUID, user)
+	if err != nil {
+		return err
 	}
-	if err := s.eventStore.Store(ctx, evt); err != nil {
-		return fmt.Errorf("error storing event: %w", err)
+	project.Version, err = expectedVersion(c, body.Version, project.Version)
+	if err != nil {
+		return err
 	}
 
-	// Check that all uuids belong to the same project, at that all the uuids
-	// of todo tasks have been sent
+	tasks := make(map[uuid.UUID]bool)
+	for _, release := range project.Releases {
+		for _, task := range release.Tasks {
+			tasks[task.UUID] = true
+		}
+	}
+	ranks := make(map[uuid.UUID]string, len(body.Ranks))
+	for i, id := range body.Ranks {
+		if !tasks[id] {
+			return invalid(fmt.Sprintf("ranks[%d]", i), "is not a task of the project")
+		}
+		ranks[id] = legacyRank(i)
+	}
 
-	if err := s.taskStore.Reorder(ctx, body.Ranks); err != nil {
+	now := time.Now()
+	evt := Event{
+		UUID:        uuid.NewV1(),
+		Type:        ProjectReorderTasks,
+		EntityUUID:  projectUUID,
+		ProjectUUID: projectUUID,
+		UserID:      user.ID,
+		Payload:     interceptor.raw,
+		CreatedAt:   now,
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		if err := s.taskStore.Rank(ctx, ranks); err != nil {
+			return fmt.Errorf("error ranking tasks: %w", err)
+		}
+
+		project.UpdatedAt = now
+		if err := s.projectStore.Upsert(ctx, project, user); err != nil {
+			return fmt.Errorf("error storing project: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return s.projectConflict(c, err, projectUUID, user)
+	}
+	if err != nil {
 		return err
 	}
 
+	publish(c, s.bus, evt)
+
+	setETag(c, project.Version+1)
 	return c.JSON(http.StatusOK, map[string]interface{}{"data": "done"})
 }
 
+// taskConflict responds to a write rejected because of err, a version
+// conflict, with the current state of the task.
+func (s service) taskConflict(c echo.Context, err error, id uuid.UUID, user User) error {
+	ctx := c.Request().Context()
+	current, getErr := s.taskStore.Get(ctx, id, user)
+	if getErr != nil {
+		return getErr
+	}
+	res, getErr := renderTasks(ctx, s.projectStore, user, current)
+	if getErr != nil {
+		return getErr
+	}
+	return conflict(c, err, res[0])
+}
+
+// projectConflict responds to a write rejected because of err, a
+// version conflict, with the current state of the project.
+func (s service) projectConflict(c echo.Context, err error, id uuid.UUID, user User) error {
+	ctx := c.Request().Context()
+	current, getErr := s.projectStore.Get(ctx, id, user)
+	if getErr != nil {
+		return getErr
+	}
+	res, getErr := renderProject(ctx, s.projectStore, user, current)
+	if getErr != nil {
+		return getErr
+	}
+	return conflict(c, err, res)
+}
+
+// publish e once it has been stored. Publishing errors do not fail the
+// request since the modification has been committed already.
+func publish(c echo.Context, bus *EventBus, e Event) {
+	if err := bus.Publish(c.Request().Context(), e); err != nil {
+		c.Logger().Errorf("error publishing event %s: %s", e.UUID, err)
+	}
+}
+
+// expectedVersion returns the version of the entity the client based
+// its modification on, taken from the If-Match header or else from the
+// body. Clients that send neither write unconditionally, against the
+// current version.
+func expectedVersion(c echo.Context, bodyVersion, currentVersion int) (int, error) {
+	if header := c.Request().Header.Get("If-Match"); header != "" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+		if err != nil {
+			return 0, invalid("If-Match", "should be a version, got %q", header)
+		}
+		return version, nil
+	}
+
+	if bodyVersion != 0 {
+		return bodyVersion, nil
+	}
+	return currentVersion, nil
+}
+
+func setETag(c echo.Context, version int) {
+	c.Response().Header().Set("ETag", fmt.Sprintf(`"%d"`, version))
+}
+
+// conflict responds to a write rejected because of err, a version
+// conflict, with the current state of the entity.
+func conflict(c echo.Context, err error, current interface{}) error {
+	return c.JSON(http.StatusConflict, map[string]interface{}{
+		"error": err.Error(),
+		"code":  CodeConflict,
+		"data":  current,
+	})
+}
+
 type payloadInterceptor struct {
 	raw []byte
 
@@ -526,10 +814,34 @@ func (i *payloadInterceptor) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// setPayloadField sets key to v in the raw JSON object, for events
+// to record data that is not part of the request body.
+func setPayloadField(raw []byte, key string, v interface{}) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = make(map[string]json.RawMessage)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields[key] = b
+
+	return json.Marshal(fields)
+}
+
+func projectSlug(name string, id uuid.UUID) string {
+	return fmt.Sprintf("%s-%s", slug.Make(name), id.String()[:8])
+}
+
 func userFromHeader(c echo.Context) (User, error) {
 	id := c.Request().Header.Get("Token-Claim-Sub")
 	if id == "" {
-		return User{}, errors.New("no user")
+		return User{}, echo.NewHTTPError(http.StatusUnauthorized, "no user")
 	}
 
 	name := c.Request().Header.Get("Token-Claim-Name")
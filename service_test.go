@@ -1,86 +1,440 @@
 package tonight_test
 
-// import (
-// 	"encoding/json"
-// 	"fmt"
-// 	"net/http"
-// 	"net/http/httptest"
-// 	"strings"
-// 	"testing"
-
-// 	"github.com/labstack/echo"
-// 	"github.com/stretchr/testify/require"
-
-// 	"github.com/bobinette/tonight"
-// 	"github.com/bobinette/tonight/inmem"
-// )
-
-// func TestAPI(t *testing.T) {
-// 	e := echo.New()
-// 	projectJSON := `{"name": "test project"}`
-// 	store := inmem.NewStore()
-// 	require.NoError(t, tonight.RegisterHTTP(
-// 		e.Group("/api"),
-// 		store.EventStore(),
-// 		store.TaskStore(),
-// 		store.ProjectStore(),
-// 		store.UserStore(),
-// 	))
-
-// 	ts := httptest.NewServer(e)
-// 	defer ts.Close()
-// 	client := http.Client{}
-
-// 	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/projects", ts.URL), strings.NewReader(projectJSON))
-// 	require.NoError(t, err)
-// 	req.Header.Set("Token-Claim-Sub", "user")
-// 	res, err := client.Do(req)
-// 	require.NoError(t, err)
-// 	require.Equal(t, 200, res.StatusCode)
-// 	defer res.Body.Close()
-
-// 	var resBody struct {
-// 		Data tonight.Project
-// 	}
-// 	require.NoError(t, json.NewDecoder(res.Body).Decode(&resBody))
-// 	res.Body.Close()
-// 	project := resBody.Data
-
-// 	taskJSON := fmt.Sprintf(`{"title": "task", "project": {"uuid": "%s"}}`, project.UUID)
-// 	req, err = http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/tasks", ts.URL), strings.NewReader(taskJSON))
-// 	require.NoError(t, err)
-// 	req.Header.Set("Token-Claim-Sub", "user")
-// 	res, err = client.Do(req)
-// 	require.NoError(t, err)
-// 	require.Equal(t, 200, res.StatusCode)
-// 	defer res.Body.Close()
-
-// 	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/projects", ts.URL), strings.NewReader(projectJSON))
-// 	require.NoError(t, err)
-// 	req.Header.Set("Token-Claim-Sub", "user")
-// 	res, err = client.Do(req)
-// 	require.NoError(t, err)
-// 	require.Equal(t, 200, res.StatusCode)
-// 	defer res.Body.Close()
-
-// 	var response struct {
-// 		Projects []tonight.Project `json:"data"`
-// 	}
-// 	require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
-// 	require.Len(t, response.Projects, 1)
-// 	require.Equal(t, "test project", response.Projects[0].Name)
-// 	require.Len(t, response.Projects[0].Tasks, 1)
-// 	require.Equal(t, "task", response.Projects[0].Tasks[0].Title)
-
-// 	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/projects", ts.URL), strings.NewReader(projectJSON))
-// 	require.NoError(t, err)
-// 	req.Header.Set("Token-Claim-Sub", "other_user")
-// 	res, err = client.Do(req)
-// 	require.NoError(t, err)
-// 	require.Equal(t, 200, res.StatusCode)
-// 	defer res.Body.Close()
-
-// 	response.Projects = nil
-// 	require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
-// 	require.Len(t, response.Projects, 0)
-// }
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+	"github.com/bobinette/tonight/inmem"
+)
+
+func TestAPI(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = tonight.HTTPErrorHandler
+	store := inmem.NewStore()
+	bus := tonight.NewEventBus(10)
+	defer bus.Close()
+	require.NoError(t, tonight.RegisterHTTP(
+		e.Group("/api"),
+		bus,
+		store.Transactor(),
+		tonight.NewSchemaEventStore(store.EventStore()),
+		store.SnapshotStore(),
+		store.TaskStore(),
+		store.ProjectStore(),
+		store.ReleaseStore(),
+		store.UserStore(),
+		store.WebhookStore(),
+		store.TrashStore(),
+	))
+
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+	client := http.Client{}
+
+	send := func(method, path, userID, body string) *http.Response {
+		req, err := http.NewRequest(method, fmt.Sprintf("%s/api%s", ts.URL, path), strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Token-Claim-Sub", userID)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	do := func(method, path, userID, body string, v interface{}) {
+		res := send(method, path, userID, body)
+		defer res.Body.Close()
+		require.Equal(t, 200, res.StatusCode)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+	}
+	// fail checks the status and the code of a failed request
+	fail := func(method, path, userID, body string, status int, code string) map[string]string {
+		res := send(method, path, userID, body)
+		defer res.Body.Close()
+		require.Equal(t, status, res.StatusCode)
+
+		var errRes struct {
+			Code   string
+			Fields map[string]string
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&errRes))
+		require.Equal(t, code, errRes.Code)
+		return errRes.Fields
+	}
+
+	var projectRes struct {
+		Data tonight.Project
+	}
+	do(http.MethodPost, "/projects", "user", `{"name": "test project"}`, &projectRes)
+	project := projectRes.Data
+
+	// The backlog shares the uuid of its project
+	var taskRes struct {
+		Data tonight.Task
+	}
+	do(
+		http.MethodPost,
+		fmt.Sprintf("/projects/%s/releases/%s/tasks", project.UUID, project.UUID),
+		"user",
+		`{"title": "task"}`,
+		&taskRes,
+	)
+	var doneRes struct {
+		Data string
+	}
+	do(http.MethodPost, fmt.Sprintf("/tasks/%s/done", taskRes.Data.UUID), "user", ``, &doneRes)
+
+	// Projects are listed without their tasks, only their counts
+	var response struct {
+		Projects   []tonight.ProjectSummary `json:"data"`
+		Pagination struct {
+			Next    string
+			HasMore bool `json:"has_more"`
+		}
+	}
+	do(http.MethodGet, "/projects", "user", ``, &response)
+	require.Len(t, response.Projects, 1)
+	require.Equal(t, "test project", response.Projects[0].Name)
+	require.Equal(t, map[tonight.TaskStatus]int{tonight.TaskStatusTODO: 0, tonight.TaskStatusDONE: 1}, response.Projects[0].TaskCounts)
+	require.Len(t, response.Projects[0].Releases, 1)
+	require.Equal(t, "Backlog", response.Projects[0].Releases[0].Title)
+	require.Nil(t, response.Projects[0].Releases[0].Tasks)
+	require.False(t, response.Pagination.HasMore)
+
+	tasksPath := fmt.Sprintf("/projects/%s/releases/%s/tasks", project.UUID, project.UUID)
+	type taskPage struct {
+		Data       []tonight.Task
+		Pagination struct {
+			Next    string
+			HasMore bool `json:"has_more"`
+		}
+	}
+	var tasksRes taskPage
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 1)
+	require.Equal(t, "task", tasksRes.Data[0].Title)
+	require.Equal(t, tonight.TaskStatusDONE, tasksRes.Data[0].Status)
+
+	// Moving a task only ranks the moved task
+	var secondRes struct {
+		Data tonight.Task
+	}
+	do(
+		http.MethodPost,
+		fmt.Sprintf("/projects/%s/releases/%s/tasks", project.UUID, project.UUID),
+		"user",
+		`{"title": "second"}`,
+		&secondRes,
+	)
+	var moveRes struct {
+		Data tonight.Task
+	}
+	do(
+		http.MethodPost,
+		fmt.Sprintf("/tasks/%s/move", secondRes.Data.UUID),
+		"user",
+		fmt.Sprintf(`{"before": "%s"}`, taskRes.Data.UUID),
+		&moveRes,
+	)
+	require.Equal(t, "i", moveRes.Data.Rank)
+
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	tasks := tasksRes.Data
+	require.Len(t, tasks, 2)
+	require.Equal(t, "second", tasks[0].Title)
+	require.Equal(t, "i", tasks[0].Rank)
+	require.Equal(t, "task", tasks[1].Title)
+	require.Equal(t, "", tasks[1].Rank)
+
+	// Moves can be undone and redone
+	var undoRes struct {
+		Data tonight.Event
+	}
+	do(http.MethodPost, "/undo", "user", ``, &undoRes)
+	require.Equal(t, tonight.Undo, undoRes.Data.Type)
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Equal(t, "task", tasksRes.Data[0].Title)
+	require.Equal(t, "", tasksRes.Data[1].Rank)
+	do(http.MethodPost, "/redo", "user", ``, &undoRes)
+	require.Equal(t, tonight.Redo, undoRes.Data.Type)
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Equal(t, "second", tasksRes.Data[0].Title)
+	require.Equal(t, "i", tasksRes.Data[0].Rank)
+
+	// Ranking the whole list still works, with the legacy ranks
+	ranksPath := fmt.Sprintf("/projects/%s/tasks/ranks", project.UUID)
+	fail(http.MethodPost, ranksPath, "other_user", `{"ranks": []}`, http.StatusForbidden, tonight.CodeForbidden)
+	fields := fail(http.MethodPost, ranksPath, "user", fmt.Sprintf(`{"ranks": ["%s"]}`, uuid.NewV1()), http.StatusUnprocessableEntity, tonight.CodeValidation)
+	require.Contains(t, fields, "ranks[0]")
+	var ranksRes struct {
+		Data string
+	}
+	do(
+		http.MethodPost,
+		ranksPath,
+		"user",
+		fmt.Sprintf(`{"ranks": ["%s", "%s"]}`, secondRes.Data.UUID, taskRes.Data.UUID),
+		&ranksRes,
+	)
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 2)
+	require.Equal(t, "00000i", tasksRes.Data[0].Rank)
+	require.Equal(t, "00001i", tasksRes.Data[1].Rank)
+
+	// Tasks are paged with the cursor of the previous page
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath+"?limit=1", "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 1)
+	require.Equal(t, "second", tasksRes.Data[0].Title)
+	require.True(t, tasksRes.Pagination.HasMore)
+	next := tasksRes.Pagination.Next
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath+"?limit=1&cursor="+next, "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 1)
+	require.Equal(t, "task", tasksRes.Data[0].Title)
+	require.False(t, tasksRes.Pagination.HasMore)
+	require.Equal(t, "", tasksRes.Pagination.Next)
+
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath+"?status=TODO", "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 1)
+	require.Equal(t, "second", tasksRes.Data[0].Title)
+
+	fields = fail(http.MethodGet, tasksPath+"?status=LATER", "user", ``, http.StatusUnprocessableEntity, tonight.CodeValidation)
+	require.Contains(t, fields, "status")
+	fields = fail(http.MethodGet, tasksPath+"?cursor=nope", "user", ``, http.StatusUnprocessableEntity, tonight.CodeValidation)
+	require.Contains(t, fields, "cursor")
+	fail(http.MethodGet, tasksPath, "other_user", ``, http.StatusForbidden, tonight.CodeForbidden)
+
+	response.Projects = nil
+	do(http.MethodGet, "/projects", "other_user", ``, &response)
+	require.Len(t, response.Projects, 0)
+
+	// Errors are served with their status and code
+	taskPath := fmt.Sprintf("/tasks/%s", taskRes.Data.UUID)
+	fail(http.MethodPost, taskPath+"/done", "other_user", ``, http.StatusNotFound, tonight.CodeNotFound)
+	fail(http.MethodPost, "/tasks/nope/done", "user", ``, http.StatusUnprocessableEntity, tonight.CodeValidation)
+	fields = fail(
+		http.MethodPost,
+		taskPath,
+		"user",
+		fmt.Sprintf(`{"uuid": "%s", "title": ""}`, taskRes.Data.UUID),
+		http.StatusUnprocessableEntity,
+		tonight.CodeValidation,
+	)
+	require.Equal(t, map[string]string{"title": "cannot be empty"}, fields)
+	fail(
+		http.MethodPost,
+		fmt.Sprintf("/projects/%s/releases", project.UUID),
+		"other_user",
+		`{"title": "v1"}`,
+		http.StatusForbidden,
+		tonight.CodeForbidden,
+	)
+
+	// Deleted entities go to the trash, until they are restored
+	var itemRes struct {
+		Data tonight.TrashItem
+	}
+	fail(http.MethodDelete, taskPath, "other_user", ``, http.StatusNotFound, tonight.CodeNotFound)
+	do(http.MethodDelete, taskPath, "user", ``, &itemRes)
+	require.Equal(t, tonight.TrashTask, itemRes.Data.Kind)
+	require.Equal(t, project.UUID, itemRes.Data.ProjectUUID)
+	fail(http.MethodPost, taskPath+"/done", "user", ``, http.StatusNotFound, tonight.CodeNotFound)
+
+	var trashRes struct {
+		Data []tonight.TrashItem
+	}
+	do(http.MethodGet, "/trash", "user", ``, &trashRes)
+	require.Len(t, trashRes.Data, 1)
+	require.Equal(t, taskRes.Data.UUID, trashRes.Data[0].UUID)
+	trashRes.Data = nil
+	do(http.MethodGet, "/trash", "other_user", ``, &trashRes)
+	require.Empty(t, trashRes.Data)
+
+	restorePath := fmt.Sprintf("/trash/%s/restore", taskRes.Data.UUID)
+	fail(http.MethodPost, restorePath, "other_user", ``, http.StatusNotFound, tonight.CodeNotFound)
+	do(http.MethodPost, restorePath, "user", ``, &itemRes)
+	fail(http.MethodPost, restorePath, "user", ``, http.StatusNotFound, tonight.CodeNotFound)
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 2)
+
+	// The backlog only goes away with its project
+	backlogPath := fmt.Sprintf("/projects/%s/releases/%s", project.UUID, project.UUID)
+	fields = fail(http.MethodDelete, backlogPath, "user", ``, http.StatusUnprocessableEntity, tonight.CodeValidation)
+	require.Contains(t, fields, "release_uuid")
+
+	projectPath := fmt.Sprintf("/projects/%s", project.UUID)
+	fail(http.MethodDelete, projectPath, "other_user", ``, http.StatusNotFound, tonight.CodeNotFound)
+	do(http.MethodDelete, projectPath, "user", ``, &itemRes)
+	require.Equal(t, tonight.TrashProject, itemRes.Data.Kind)
+	fail(http.MethodGet, tasksPath, "user", ``, http.StatusNotFound, tonight.CodeNotFound)
+	do(http.MethodPost, fmt.Sprintf("/trash/%s/restore", project.UUID), "user", ``, &itemRes)
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 2)
+
+	// Bulk operations are validated as a whole before being applied
+	var releaseRes struct {
+		Data tonight.Release
+	}
+	do(http.MethodPost, fmt.Sprintf("/projects/%s/releases", project.UUID), "user", `{"title": "v1"}`, &releaseRes)
+	release := releaseRes.Data
+	second, first := tasks[0].UUID, taskRes.Data.UUID
+
+	bulkPath := fmt.Sprintf("/projects/%s/tasks/bulk", project.UUID)
+	fail(http.MethodPost, bulkPath, "other_user", `{"operations": [{"op": "done", "tasks": []}]}`, http.StatusForbidden, tonight.CodeForbidden)
+	fields = fail(
+		http.MethodPost,
+		bulkPath,
+		"user",
+		fmt.Sprintf(`{"operations": [
+			{"op": "done", "tasks": ["%s"]},
+			{"op": "archive", "tasks": ["%s"]},
+			{"op": "move", "tasks": ["%s"], "release": "%s"},
+			{"op": "retitle", "tasks": ["%s", "%s"], "title": "renamed"},
+			{"op": "delete", "tasks": ["%s"]},
+			{"op": "reopen", "tasks": ["%s"]}
+		]}`, second, second, second, uuid.NewV1(), second, uuid.NewV1(), first, first),
+		http.StatusUnprocessableEntity,
+		tonight.CodeValidation,
+	)
+	require.Equal(t, map[string]string{
+		"operations[1].op":       `is unknown, got "archive"`,
+		"operations[2].release":  "is not a release of the project",
+		"operations[3].tasks[1]": "is not a task of the project",
+		"operations[5].tasks[0]": "is deleted by a previous operation",
+	}, fields)
+	// Nothing was applied
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath+"?status=TODO", "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 1)
+
+	var bulkRes struct {
+		Data struct {
+			CorrelationID uuid.UUID      `json:"correlation_id"`
+			Events        int            `json:"events"`
+			Tasks         []tonight.Task `json:"tasks"`
+		}
+	}
+	do(
+		http.MethodPost,
+		bulkPath,
+		"user",
+		fmt.Sprintf(`{"operations": [
+			{"op": "move", "tasks": ["%s", "%s"], "release": "%s"},
+			{"op": "retitle", "tasks": ["%s"], "title": "renamed"},
+			{"op": "done", "tasks": ["%s", "%s"]},
+			{"op": "delete", "tasks": ["%s"]}
+		]}`, second, first, release.UUID, second, second, first, first),
+		&bulkRes,
+	)
+	// The first task was done already
+	require.Equal(t, 5, bulkRes.Data.Events)
+	require.Len(t, bulkRes.Data.Tasks, 2)
+	require.Equal(t, "renamed", bulkRes.Data.Tasks[0].Title)
+	require.Equal(t, tonight.TaskStatusDONE, bulkRes.Data.Tasks[0].Status)
+	require.NotNil(t, bulkRes.Data.Tasks[1].DeletedAt)
+
+	tasksRes = taskPage{}
+	do(http.MethodGet, tasksPath, "user", ``, &tasksRes)
+	require.Empty(t, tasksRes.Data)
+	tasksRes = taskPage{}
+	do(http.MethodGet, fmt.Sprintf("/projects/%s/releases/%s/tasks", project.UUID, release.UUID), "user", ``, &tasksRes)
+	require.Len(t, tasksRes.Data, 1)
+	require.Equal(t, "renamed", tasksRes.Data[0].Title)
+	require.Equal(t, 4, tasksRes.Data[0].Version)
+
+	// The events of the batch share its correlation id
+	var auditRes struct {
+		Data []tonight.AuditEntry
+	}
+	do(http.MethodGet, fmt.Sprintf("/projects/%s/audit?correlation_id=%s", project.UUID, bulkRes.Data.CorrelationID), "user", ``, &auditRes)
+	require.Len(t, auditRes.Data, 5)
+	for _, entry := range auditRes.Data {
+		require.Equal(t, bulkRes.Data.CorrelationID, entry.Event.CorrelationID)
+	}
+	// Descriptions are markdown, returned along with their rendering. Only
+	// the slugs of existing projects are linked
+	var describedRes struct {
+		Data struct {
+			tonight.Task
+			DescriptionHTML    string `json:"description_html"`
+			DescriptionExcerpt string `json:"description_excerpt"`
+		}
+	}
+	do(
+		http.MethodPost,
+		tasksPath,
+		"user",
+		fmt.Sprintf(`{"title": "described", "description": "Needs %s, not build-20231018\n\n<script>alert(1)</script>"}`, project.Slug),
+		&describedRes,
+	)
+	described := describedRes.Data.Task
+	require.Equal(t, fmt.Sprintf("Needs %s, not build-20231018\n\n<script>alert(1)</script>", project.Slug), described.Description)
+	require.Equal(
+		t,
+		fmt.Sprintf("<p>Needs <a href=\"/projects/%s\">%s</a>, not build-20231018</p>\n<!-- raw HTML omitted -->\n", project.Slug, project.Slug),
+		describedRes.Data.DescriptionHTML,
+	)
+	require.Equal(t, "Needs "+project.Slug+", not build-20231018", describedRes.Data.DescriptionExcerpt)
+
+	// Updates without a description keep it
+	describedPath := fmt.Sprintf("/tasks/%s", described.UUID)
+	do(http.MethodPost, describedPath, "user", fmt.Sprintf(`{"uuid": "%s", "title": "described", "status": "TODO", "version": 1}`, described.UUID), &doneRes)
+	do(http.MethodPost, describedPath, "user", fmt.Sprintf(`{"uuid": "%s", "title": "described", "status": "TODO", "description": "**new**", "version": 2}`, described.UUID), &doneRes)
+	fields = fail(
+		http.MethodPost,
+		describedPath,
+		"user",
+		fmt.Sprintf(`{"uuid": "%s", "title": "described", "status": "TODO", "description": "%s", "version": 3}`, described.UUID, strings.Repeat("a", 20001)),
+		http.StatusUnprocessableEntity,
+		tonight.CodeValidation,
+	)
+	require.Contains(t, fields, "description")
+
+	var describedPage struct {
+		Data []map[string]interface{}
+	}
+	do(http.MethodGet, tasksPath, "user", ``, &describedPage)
+	require.Len(t, describedPage.Data, 1)
+	require.Equal(t, "**new**", describedPage.Data[0]["description"])
+	require.Equal(t, "<p><strong>new</strong></p>\n", describedPage.Data[0]["description_html"])
+	require.Equal(t, "new", describedPage.Data[0]["description_excerpt"])
+
+	// So are the tasks of the projects
+	var describedProject struct {
+		Data struct {
+			Releases []struct {
+				UUID  uuid.UUID
+				Tasks []map[string]interface{}
+			}
+		}
+	}
+	do(http.MethodGet, projectPath, "user", ``, &describedProject)
+	backlog := describedProject.Data.Releases[len(describedProject.Data.Releases)-1]
+	require.Equal(t, project.UUID, backlog.UUID)
+	require.Len(t, backlog.Tasks, 1)
+	require.Equal(t, "<p><strong>new</strong></p>\n", backlog.Tasks[0]["description_html"])
+
+	// The update events carry the description change
+	var historyRes struct {
+		Data []tonight.HistoryEntry
+	}
+	do(http.MethodGet, describedPath+"/history", "user", ``, &historyRes)
+	require.Len(t, historyRes.Data, 3)
+	require.Empty(t, historyRes.Data[1].Changes)
+	require.Equal(t, []tonight.FieldChange{{Field: "description", From: described.Description, To: "**new**"}}, historyRes.Data[2].Changes)
+}
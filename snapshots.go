@@ -0,0 +1,323 @@
+package tonight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// A Snapshot is the state of a project, its releases, tasks and
+// permissions, after folding its events up to EventUUID. Folding only
+// the events after a snapshot is much faster than folding them all.
+type Snapshot struct {
+	ProjectUUID uuid.UUID
+
+	// EventUUID and EventCreatedAt identify the last event folded
+	EventUUID      uuid.UUID
+	EventCreatedAt time.Time
+
+	// Events is the number of events folded
+	Events int
+
+	Projection *Projection
+}
+
+// ErrNoSnapshot is returned by SnapshotStore.Latest when no snapshot
+// matches.
+var ErrNoSnapshot = errors.New("no snapshot")
+
+// A SnapshotStore stores the snapshots of the projects, next to their
+// events.
+type SnapshotStore interface {
+	Store(ctx context.Context, s Snapshot) error
+
+	// Latest returns the latest snapshot of the project whose last
+	// event was created at or before until, the zero time meaning no
+	// bound, or ErrNoSnapshot.
+	Latest(ctx context.Context, projectUUID uuid.UUID, until time.Time) (Snapshot, error)
+
+	// Clear removes all the snapshots, for instance when events are
+	// imported in the past of existing snapshots.
+	Clear(ctx context.Context) error
+}
+
+// ReplayProject folds the events of the project created at or before
+// until, the zero time meaning all of them. If snapshots is not nil,
+// the fold starts from the latest snapshot before until.
+func ReplayProject(
+	ctx context.Context,
+	store EventStore,
+	snapshots SnapshotStore,
+	projectUUID uuid.UUID,
+	until time.Time,
+) (Snapshot, error) {
+	snap, _, err := replayProject(ctx, store, snapshots, projectUUID, until)
+	return snap, err
+}
+
+// replayProject is ReplayProject, also returning the number of events
+// folded after the snapshot it started from.
+func replayProject(
+	ctx context.Context,
+	store EventStore,
+	snapshots SnapshotStore,
+	projectUUID uuid.UUID,
+	until time.Time,
+) (Snapshot, int, error) {
+	snap := Snapshot{ProjectUUID: projectUUID, Projection: NewProjection()}
+	if snapshots != nil {
+		latest, err := snapshots.Latest(ctx, projectUUID, until)
+		if err != nil && !errors.Is(err, ErrNoSnapshot) {
+			return Snapshot{}, 0, fmt.Errorf("error loading snapshot: %w", err)
+		}
+		if err == nil {
+			snap = latest
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	filter := EventFilter{ProjectUUID: projectUUID, Since: snap.EventCreatedAt, Until: until}
+	go func() { errc <- store.List(ctx, filter, ch) }()
+
+	tail := 0
+	var err error
+	for e := range ch {
+		if err != nil || !snap.precedes(e) {
+			continue
+		}
+
+		if err = snap.Projection.Apply(e); err != nil {
+			err = fmt.Errorf("error applying event %s: %w", e.UUID, err)
+			cancel()
+			continue
+		}
+		snap.EventUUID = e.UUID
+		snap.EventCreatedAt = e.CreatedAt
+		snap.Events++
+		tail++
+	}
+	if listErr := <-errc; err == nil {
+		err = listErr
+	}
+	if err != nil {
+		return Snapshot{}, 0, err
+	}
+
+	return snap, tail, nil
+}
+
+// precedes returns whether e comes after the last event of the
+// snapshot, in the order of EventStore.List: creation date then uuid.
+func (s Snapshot) precedes(e Event) bool {
+	if s.EventUUID == uuid.Nil || e.CreatedAt.After(s.EventCreatedAt) {
+		return true
+	}
+	return e.CreatedAt.Equal(s.EventCreatedAt) && e.UUID.String() > s.EventUUID.String()
+}
+
+// VerifySnapshot compares the latest snapshot of the project plus the
+// events after it with the full replay of its events, and returns the
+// differences, see Projection.Diff.
+func VerifySnapshot(ctx context.Context, store EventStore, snapshots SnapshotStore, projectUUID uuid.UUID) ([]string, error) {
+	fromSnapshot, err := ReplayProject(ctx, store, snapshots, projectUUID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	full, err := ReplayProject(ctx, store, nil, projectUUID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	return fromSnapshot.Projection.Diff(full.Projection), nil
+}
+
+// A Snapshotter takes the snapshots of the projects, whenever a project
+// has every new events and every interval for the projects with new
+// events. Zero disables the corresponding policy.
+type Snapshotter struct {
+	events    EventStore
+	snapshots SnapshotStore
+
+	interval time.Duration
+	every    int
+}
+
+func NewSnapshotter(events EventStore, snapshots SnapshotStore, interval time.Duration, every int) *Snapshotter {
+	return &Snapshotter{
+		events:    events,
+		snapshots: snapshots,
+		interval:  interval,
+		every:     every,
+	}
+}
+
+// Run takes snapshots as the events of sub are received, until sub is
+// closed or ctx is done. Failing to take a snapshot is only logged: it
+// will be taken at the next opportunity.
+//
+// Replaying a project takes time and the bus waits for its subscribers,
+// so the events are only counted here: the snapshots are taken by
+// another goroutine, once per project however many events it received
+// in the meantime.
+func (s *Snapshotter) Run(ctx context.Context, sub *Subscription) {
+	var tick <-chan time.Time
+	if s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	q := newSnapshotQueue()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.work(ctx, q, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if e.ProjectUUID == uuid.Nil {
+				continue
+			}
+			q.record(e.ProjectUUID, s.every)
+
+		case <-tick:
+			q.flush()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// work takes the snapshots of the projects queued in q, until stop is
+// closed or ctx is done.
+func (s *Snapshotter) work(ctx context.Context, q *snapshotQueue, stop <-chan struct{}) {
+	for {
+		select {
+		case <-q.wake:
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		for _, projectUUID := range q.due() {
+			if _, err := s.Snapshot(ctx, projectUUID); err != nil {
+				log.Printf("error taking snapshot of project %s: %v", projectUUID, err)
+				q.retry(projectUUID)
+			}
+		}
+	}
+}
+
+// A snapshotQueue holds the number of events of each project since its
+// latest snapshot, and the projects whose snapshot is due.
+type snapshotQueue struct {
+	mu      sync.Mutex
+	pending map[uuid.UUID]int
+	queued  map[uuid.UUID]bool
+
+	// wake holds a value when projects are queued
+	wake chan struct{}
+}
+
+func newSnapshotQueue() *snapshotQueue {
+	return &snapshotQueue{
+		pending: make(map[uuid.UUID]int),
+		queued:  make(map[uuid.UUID]bool),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// record an event of the project, queueing it once it has every events.
+func (q *snapshotQueue) record(projectUUID uuid.UUID, every int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending[projectUUID]++
+	if every > 0 && q.pending[projectUUID] >= every {
+		q.queue(projectUUID)
+	}
+}
+
+// flush queues all the projects with events.
+func (q *snapshotQueue) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for projectUUID := range q.pending {
+		q.queue(projectUUID)
+	}
+}
+
+// retry keeps the project pending after a failed snapshot, for the next
+// flush to queue it again.
+func (q *snapshotQueue) retry(projectUUID uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending[projectUUID] == 0 {
+		q.pending[projectUUID] = 1
+	}
+}
+
+// due empties the queue and returns the projects it held, whose events
+// are not pending anymore.
+func (q *snapshotQueue) due() []uuid.UUID {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	projects := make([]uuid.UUID, 0, len(q.queued))
+	for projectUUID := range q.queued {
+		projects = append(projects, projectUUID)
+		delete(q.pending, projectUUID)
+	}
+	q.queued = make(map[uuid.UUID]bool)
+	return projects
+}
+
+// queue the project, q.mu being held.
+func (q *snapshotQueue) queue(projectUUID uuid.UUID) {
+	q.queued[projectUUID] = true
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Snapshot takes a snapshot of the project, unless there is no event
+// since the latest one. It returns whether a snapshot was taken.
+func (s *Snapshotter) Snapshot(ctx context.Context, projectUUID uuid.UUID) (bool, error) {
+	snap, tail, err := replayProject(ctx, s.events, s.snapshots, projectUUID, time.Time{})
+	if err != nil {
+		return false, err
+	}
+	if tail == 0 {
+		return false, nil
+	}
+
+	if err := s.snapshots.Store(ctx, snap); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,192 @@
+package tonight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceSnapshotStore keeps snapshots in the order they are stored.
+type sliceSnapshotStore []Snapshot
+
+func (s *sliceSnapshotStore) Store(ctx context.Context, snap Snapshot) error {
+	*s = append(*s, snap)
+	return nil
+}
+
+func (s *sliceSnapshotStore) Latest(ctx context.Context, projectUUID uuid.UUID, until time.Time) (Snapshot, error) {
+	for i := len(*s) - 1; i >= 0; i-- {
+		snap := (*s)[i]
+		if snap.ProjectUUID == projectUUID && (until.IsZero() || !snap.EventCreatedAt.After(until)) {
+			// Readers apply events on the projection, give them a copy
+			p := NewProjection()
+			for id, project := range snap.Projection.Projects {
+				p.Projects[id] = project
+			}
+			for id, release := range snap.Projection.Releases {
+				p.Releases[id] = release
+			}
+			for id, task := range snap.Projection.Tasks {
+				p.Tasks[id] = task
+			}
+			for id, rank := range snap.Projection.Ranks {
+				p.Ranks[id] = rank
+			}
+			for id, perms := range snap.Projection.Permissions {
+				p.Permissions[id] = perms
+			}
+			snap.Projection = p
+			return snap, nil
+		}
+	}
+	return Snapshot{}, ErrNoSnapshot
+}
+
+func (s *sliceSnapshotStore) Clear(ctx context.Context) error {
+	*s = nil
+	return nil
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	now := time.Now()
+
+	events := &sliceEventStore{
+		{
+			UUID:        uuid.NewV1(),
+			Type:        ProjectCreate,
+			EntityUUID:  projectUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(`{"name": "project"}`),
+			CreatedAt:   now,
+		},
+		{
+			UUID:        uuid.NewV1(),
+			Type:        TaskCreate,
+			EntityUUID:  taskUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, projectUUID)),
+			CreatedAt:   now.Add(time.Second),
+		},
+	}
+	snapshots := &sliceSnapshotStore{}
+	snapshotter := NewSnapshotter(events, snapshots, 0, 0)
+
+	taken, err := snapshotter.Snapshot(ctx, projectUUID)
+	require.NoError(t, err)
+	require.True(t, taken)
+	require.Len(t, *snapshots, 1)
+	require.Equal(t, 2, (*snapshots)[0].Events)
+
+	// Nothing new, no snapshot
+	taken, err = snapshotter.Snapshot(ctx, projectUUID)
+	require.NoError(t, err)
+	require.False(t, taken)
+
+	require.NoError(t, events.Store(ctx, Event{
+		UUID:        uuid.NewV1(),
+		Type:        TaskDone,
+		EntityUUID:  taskUUID,
+		ProjectUUID: projectUUID,
+		UserID:      "user",
+		Payload:     []byte(`{}`),
+		CreatedAt:   now.Add(2 * time.Second),
+	}))
+
+	// The snapshot plus the new event give the full replay
+	snap, err := ReplayProject(ctx, events, snapshots, projectUUID, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, 3, snap.Events)
+	require.Equal(t, TaskStatusDONE, snap.Projection.Tasks[taskUUID].Status)
+
+	diffs, err := VerifySnapshot(ctx, events, snapshots, projectUUID)
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	// A snapshot diverging from the events is reported
+	(*snapshots)[0].Projection.Tasks[taskUUID] = Task{UUID: taskUUID, Title: "wrong", Status: TaskStatusTODO, Release: Release{UUID: projectUUID}, Version: 1}
+	diffs, err = VerifySnapshot(ctx, events, snapshots, projectUUID)
+	require.NoError(t, err)
+	require.Equal(t, []string{fmt.Sprintf(`task %s: title "wrong" != "task"`, taskUUID)}, diffs)
+}
+
+// gatedSnapshotStore is a sliceSnapshotStore whose Store waits for gate
+// to be closed.
+type gatedSnapshotStore struct {
+	gate chan struct{}
+
+	mu        sync.Mutex
+	snapshots sliceSnapshotStore
+}
+
+func (s *gatedSnapshotStore) Store(ctx context.Context, snap Snapshot) error {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshots.Store(ctx, snap)
+}
+
+func (s *gatedSnapshotStore) Latest(ctx context.Context, projectUUID uuid.UUID, until time.Time) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshots.Latest(ctx, projectUUID, until)
+}
+
+func (s *gatedSnapshotStore) Clear(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshots.Clear(ctx)
+}
+
+func TestSnapshotterRun(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+
+	events := &sliceEventStore{{
+		UUID:        uuid.NewV1(),
+		Type:        ProjectCreate,
+		EntityUUID:  projectUUID,
+		ProjectUUID: projectUUID,
+		UserID:      "user",
+		Payload:     []byte(`{"name": "project"}`),
+		CreatedAt:   time.Now(),
+	}}
+	snapshots := &gatedSnapshotStore{gate: make(chan struct{})}
+	snapshotter := NewSnapshotter(events, snapshots, 0, 1)
+
+	bus := NewEventBus(1)
+	done := make(chan struct{})
+	go func() {
+		snapshotter.Run(ctx, bus.Subscribe(uuid.Nil))
+		close(done)
+	}()
+
+	// The snapshot is stuck, the publishers are not
+	for i := 0; i < 20; i++ {
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Second)
+		require.NoError(t, bus.Publish(timeoutCtx, Event{UUID: uuid.NewV1(), ProjectUUID: projectUUID}))
+		cancel()
+	}
+
+	close(snapshots.gate)
+	require.Eventually(t, func() bool {
+		snap, err := snapshots.Latest(ctx, projectUUID, time.Time{})
+		return err == nil && snap.Events == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	bus.Close()
+	<-done
+
+	// The events received while taking the first snapshot only queued
+	// one more, with nothing new to fold
+	require.Len(t, snapshots.snapshots, 1)
+}
@@ -0,0 +1,176 @@
+-- Migration: init
+-- Created at: 2026-10-18 12:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` TEXT NOT NULL,
+    `name` TEXT NOT NULL,
+
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS `projects` (
+    `uuid` TEXT NOT NULL,
+
+    `name` TEXT NOT NULL,
+    `slug` TEXT NOT NULL,
+    `description` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    CONSTRAINT `u_project_slug` UNIQUE (`slug`)
+);
+
+CREATE TABLE IF NOT EXISTS `user_permission_on_project` (
+    `user_id` TEXT NOT NULL,
+    `project_uuid` TEXT NOT NULL,
+    `permission` TEXT NOT NULL,
+
+    PRIMARY KEY (`user_id`, `project_uuid`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `releases` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `description` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+
+    `project_uuid` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `tasks` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `status` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+    `rank` INTEGER NULL DEFAULT NULL,
+
+    `release_uuid` TEXT NULL DEFAULT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`release_uuid`) REFERENCES `releases` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_task_release_uuid` ON `tasks` (`release_uuid`);
+
+CREATE TABLE IF NOT EXISTS `events` (
+    `uuid` TEXT NOT NULL,
+
+    `type` TEXT NOT NULL,
+    `entity_uuid` TEXT NOT NULL,
+    `project_uuid` TEXT NULL DEFAULT NULL,
+    `user_id` TEXT NULL,
+    `payload` BLOB NOT NULL,
+    `schema_version` INTEGER NOT NULL DEFAULT 1,
+
+    `created_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_event_entity_uuid` ON `events` (`entity_uuid`);
+CREATE INDEX IF NOT EXISTS `idx_event_project_uuid` ON `events` (`project_uuid`);
+CREATE INDEX IF NOT EXISTS `idx_event_created_at` ON `events` (`created_at`);
+
+CREATE TABLE IF NOT EXISTS `snapshots` (
+    `project_uuid` TEXT NOT NULL,
+
+    `event_uuid` TEXT NOT NULL,
+    `event_created_at` DATETIME NOT NULL,
+    `events` INTEGER NOT NULL,
+
+    `state` BLOB NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`project_uuid`, `event_uuid`)
+);
+
+CREATE INDEX IF NOT EXISTS `idx_snapshot_project_event_created_at` ON `snapshots` (`project_uuid`, `event_created_at`);
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+    `uuid` TEXT NOT NULL,
+    `project_uuid` TEXT NOT NULL,
+
+    `url` TEXT NOT NULL,
+    `secret` TEXT NOT NULL,
+    -- JSON array of event types, all of them if empty
+    `types` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS `webhook_queue` (
+    `uuid` TEXT NOT NULL,
+    `webhook_uuid` TEXT NOT NULL,
+
+    `event` BLOB NOT NULL,
+    `attempt` INTEGER NOT NULL,
+    `next_attempt_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`webhook_uuid`) REFERENCES `webhooks` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_webhook_queue_next_attempt_at` ON `webhook_queue` (`next_attempt_at`);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `uuid` TEXT NOT NULL,
+    `webhook_uuid` TEXT NOT NULL,
+
+    `event_uuid` TEXT NOT NULL,
+    `event_type` TEXT NOT NULL,
+    `attempt` INTEGER NOT NULL,
+
+    `status_code` INTEGER NOT NULL,
+    `error` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`webhook_uuid`) REFERENCES `webhooks` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_webhook_delivery_created_at` ON `webhook_deliveries` (`webhook_uuid`, `created_at`);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+DROP TABLE `webhook_deliveries`;
+DROP TABLE `webhook_queue`;
+DROP TABLE `webhooks`;
+DROP TABLE `snapshots`;
+DROP TABLE `events`;
+DROP TABLE `tasks`;
+DROP TABLE `releases`;
+DROP TABLE `user_permission_on_project`;
+DROP TABLE `projects`;
+DROP TABLE `users`;
+
+COMMIT;
@@ -0,0 +1,87 @@
+-- Migration: task-rank-keys
+-- Created at: 2026-10-18 14:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- SQLite cannot change the type of a column, the table is copied over.
+-- Ranks are lexicographic keys, TEXT compares them byte by byte.
+CREATE TABLE `tasks_new` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `status` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+    `rank` TEXT NULL DEFAULT NULL,
+
+    `release_uuid` TEXT NULL DEFAULT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`release_uuid`) REFERENCES `releases` (`uuid`) ON DELETE CASCADE
+);
+
+INSERT INTO `tasks_new` (`uuid`, `title`, `status`, `version`, `rank`, `release_uuid`, `created_at`, `updated_at`)
+SELECT
+    `uuid`,
+    `title`,
+    `status`,
+    `version`,
+    CASE WHEN `rank` IS NULL THEN NULL ELSE substr('00000' || `rank`, -5, 5) || 'i' END,
+    `release_uuid`,
+    `created_at`,
+    `updated_at`
+FROM `tasks`;
+
+DROP TABLE `tasks`;
+ALTER TABLE `tasks_new` RENAME TO `tasks`;
+CREATE INDEX IF NOT EXISTS `idx_task_release_uuid` ON `tasks` (`release_uuid`);
+
+-- The snapshots hold integer ranks, they are rebuilt from the events
+DELETE FROM `snapshots`;
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+CREATE TABLE `tasks_old` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `status` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+    `rank` INTEGER NULL DEFAULT NULL,
+
+    `release_uuid` TEXT NULL DEFAULT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`release_uuid`) REFERENCES `releases` (`uuid`) ON DELETE CASCADE
+);
+
+-- Only the ranks converted by the UP migration can be restored
+INSERT INTO `tasks_old` (`uuid`, `title`, `status`, `version`, `rank`, `release_uuid`, `created_at`, `updated_at`)
+SELECT
+    `uuid`,
+    `title`,
+    `status`,
+    `version`,
+    CASE WHEN `rank` GLOB '[0-9][0-9][0-9][0-9][0-9]i' THEN CAST(substr(`rank`, 1, 5) AS INTEGER) ELSE NULL END,
+    `release_uuid`,
+    `created_at`,
+    `updated_at`
+FROM `tasks`;
+
+DROP TABLE `tasks`;
+ALTER TABLE `tasks_old` RENAME TO `tasks`;
+CREATE INDEX IF NOT EXISTS `idx_task_release_uuid` ON `tasks` (`release_uuid`);
+
+DELETE FROM `snapshots`;
+
+COMMIT;
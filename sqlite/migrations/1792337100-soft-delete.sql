@@ -0,0 +1,187 @@
+-- Migration: soft-delete
+-- Created at: 2026-10-18 15:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Deleted entities stay in the trash until they are purged
+ALTER TABLE `projects` ADD COLUMN `deleted_at` DATETIME NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS `idx_project_deleted_at` ON `projects` (`deleted_at`);
+
+ALTER TABLE `releases` ADD COLUMN `deleted_at` DATETIME NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS `idx_release_deleted_at` ON `releases` (`deleted_at`);
+
+ALTER TABLE `tasks` ADD COLUMN `deleted_at` DATETIME NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS `idx_task_deleted_at` ON `tasks` (`deleted_at`);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+-- SQLite cannot drop a column before 3.35, the tables are copied over.
+-- Dropping projects or releases would cascade to the tables referencing
+-- them, they are all set aside and dropped before being recreated.
+CREATE TEMP TABLE `projects_backup` AS SELECT * FROM `projects`;
+CREATE TEMP TABLE `user_permission_on_project_backup` AS SELECT * FROM `user_permission_on_project`;
+CREATE TEMP TABLE `releases_backup` AS SELECT * FROM `releases`;
+CREATE TEMP TABLE `tasks_backup` AS SELECT * FROM `tasks`;
+CREATE TEMP TABLE `webhooks_backup` AS SELECT * FROM `webhooks`;
+CREATE TEMP TABLE `webhook_queue_backup` AS SELECT * FROM `webhook_queue`;
+CREATE TEMP TABLE `webhook_deliveries_backup` AS SELECT * FROM `webhook_deliveries`;
+
+DROP TABLE `webhook_deliveries`;
+DROP TABLE `webhook_queue`;
+DROP TABLE `webhooks`;
+DROP TABLE `tasks`;
+DROP TABLE `releases`;
+DROP TABLE `user_permission_on_project`;
+DROP TABLE `projects`;
+
+CREATE TABLE `projects` (
+    `uuid` TEXT NOT NULL,
+
+    `name` TEXT NOT NULL,
+    `slug` TEXT NOT NULL,
+    `description` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    CONSTRAINT `u_project_slug` UNIQUE (`slug`)
+);
+
+CREATE TABLE `user_permission_on_project` (
+    `user_id` TEXT NOT NULL,
+    `project_uuid` TEXT NOT NULL,
+    `permission` TEXT NOT NULL,
+
+    PRIMARY KEY (`user_id`, `project_uuid`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE TABLE `releases` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `description` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+
+    `project_uuid` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE TABLE `tasks` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `status` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+    `rank` TEXT NULL DEFAULT NULL,
+
+    `release_uuid` TEXT NULL DEFAULT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`release_uuid`) REFERENCES `releases` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_task_release_uuid` ON `tasks` (`release_uuid`);
+
+CREATE TABLE `webhooks` (
+    `uuid` TEXT NOT NULL,
+    `project_uuid` TEXT NOT NULL,
+
+    `url` TEXT NOT NULL,
+    `secret` TEXT NOT NULL,
+    -- JSON array of event types, all of them if empty
+    `types` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`project_uuid`) REFERENCES `projects` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE TABLE `webhook_queue` (
+    `uuid` TEXT NOT NULL,
+    `webhook_uuid` TEXT NOT NULL,
+
+    `event` BLOB NOT NULL,
+    `attempt` INTEGER NOT NULL,
+    `next_attempt_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`webhook_uuid`) REFERENCES `webhooks` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_webhook_queue_next_attempt_at` ON `webhook_queue` (`next_attempt_at`);
+
+CREATE TABLE `webhook_deliveries` (
+    `uuid` TEXT NOT NULL,
+    `webhook_uuid` TEXT NOT NULL,
+
+    `event_uuid` TEXT NOT NULL,
+    `event_type` TEXT NOT NULL,
+    `attempt` INTEGER NOT NULL,
+
+    `status_code` INTEGER NOT NULL,
+    `error` TEXT NOT NULL,
+
+    `created_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`webhook_uuid`) REFERENCES `webhooks` (`uuid`) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS `idx_webhook_delivery_created_at` ON `webhook_deliveries` (`webhook_uuid`, `created_at`);
+
+INSERT INTO `projects` (`uuid`, `name`, `slug`, `description`, `version`, `created_at`, `updated_at`)
+SELECT `uuid`, `name`, `slug`, `description`, `version`, `created_at`, `updated_at`
+FROM `projects_backup`;
+
+INSERT INTO `user_permission_on_project` (`user_id`, `project_uuid`, `permission`)
+SELECT `user_id`, `project_uuid`, `permission`
+FROM `user_permission_on_project_backup`;
+
+INSERT INTO `releases` (`uuid`, `title`, `description`, `version`, `project_uuid`, `created_at`, `updated_at`)
+SELECT `uuid`, `title`, `description`, `version`, `project_uuid`, `created_at`, `updated_at`
+FROM `releases_backup`;
+
+INSERT INTO `tasks` (`uuid`, `title`, `status`, `version`, `rank`, `release_uuid`, `created_at`, `updated_at`)
+SELECT `uuid`, `title`, `status`, `version`, `rank`, `release_uuid`, `created_at`, `updated_at`
+FROM `tasks_backup`;
+
+INSERT INTO `webhooks` (`uuid`, `project_uuid`, `url`, `secret`, `types`, `created_at`, `updated_at`)
+SELECT `uuid`, `project_uuid`, `url`, `secret`, `types`, `created_at`, `updated_at`
+FROM `webhooks_backup`;
+
+INSERT INTO `webhook_queue` (`uuid`, `webhook_uuid`, `event`, `attempt`, `next_attempt_at`)
+SELECT `uuid`, `webhook_uuid`, `event`, `attempt`, `next_attempt_at`
+FROM `webhook_queue_backup`;
+
+INSERT INTO `webhook_deliveries` (`uuid`, `webhook_uuid`, `event_uuid`, `event_type`, `attempt`, `status_code`, `error`, `created_at`)
+SELECT `uuid`, `webhook_uuid`, `event_uuid`, `event_type`, `attempt`, `status_code`, `error`, `created_at`
+FROM `webhook_deliveries_backup`;
+
+DROP TABLE `projects_backup`;
+DROP TABLE `user_permission_on_project_backup`;
+DROP TABLE `releases_backup`;
+DROP TABLE `tasks_backup`;
+DROP TABLE `webhooks_backup`;
+DROP TABLE `webhook_queue_backup`;
+DROP TABLE `webhook_deliveries_backup`;
+
+COMMIT;
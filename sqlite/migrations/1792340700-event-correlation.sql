@@ -0,0 +1,45 @@
+-- Migration: event-correlation
+-- Created at: 2026-10-18 16:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- Events recorded by the same request, a bulk one for instance, share
+-- a correlation id
+ALTER TABLE `events` ADD COLUMN `correlation_id` TEXT NULL DEFAULT NULL;
+CREATE INDEX IF NOT EXISTS `idx_event_correlation_id` ON `events` (`correlation_id`);
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+-- SQLite cannot drop a column before 3.35, the table is copied over
+CREATE TABLE `events_old` (
+    `uuid` TEXT NOT NULL,
+
+    `type` TEXT NOT NULL,
+    `entity_uuid` TEXT NOT NULL,
+    `project_uuid` TEXT NULL DEFAULT NULL,
+    `user_id` TEXT NULL,
+    `payload` BLOB NOT NULL,
+    `schema_version` INTEGER NOT NULL DEFAULT 1,
+
+    `created_at` DATETIME NOT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+INSERT INTO `events_old` (`uuid`, `type`, `entity_uuid`, `project_uuid`, `user_id`, `payload`, `schema_version`, `created_at`)
+SELECT `uuid`, `type`, `entity_uuid`, `project_uuid`, `user_id`, `payload`, `schema_version`, `created_at`
+FROM `events`;
+
+DROP TABLE `events`;
+ALTER TABLE `events_old` RENAME TO `events`;
+CREATE INDEX IF NOT EXISTS `idx_event_entity_uuid` ON `events` (`entity_uuid`);
+CREATE INDEX IF NOT EXISTS `idx_event_project_uuid` ON `events` (`project_uuid`);
+CREATE INDEX IF NOT EXISTS `idx_event_created_at` ON `events` (`created_at`);
+
+COMMIT;
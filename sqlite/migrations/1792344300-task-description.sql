@@ -0,0 +1,44 @@
+-- Migration: task-description
+-- Created at: 2026-10-18 17:25:00
+-- ====  UP  ====
+
+BEGIN;
+
+-- The description of a task is markdown
+ALTER TABLE `tasks` ADD COLUMN `description` TEXT NOT NULL DEFAULT '';
+
+COMMIT;
+
+-- ==== DOWN ====
+
+BEGIN;
+
+-- SQLite cannot drop a column before 3.35, the table is copied over
+CREATE TABLE `tasks_old` (
+    `uuid` TEXT NOT NULL,
+
+    `title` TEXT NOT NULL,
+    `status` TEXT NOT NULL,
+    `version` INTEGER NOT NULL DEFAULT 0,
+    `rank` TEXT NULL DEFAULT NULL,
+
+    `release_uuid` TEXT NULL DEFAULT NULL,
+
+    `created_at` DATETIME NOT NULL,
+    `updated_at` DATETIME NOT NULL,
+    `deleted_at` DATETIME NULL DEFAULT NULL,
+
+    PRIMARY KEY (`uuid`),
+    FOREIGN KEY (`release_uuid`) REFERENCES `releases` (`uuid`) ON DELETE CASCADE
+);
+
+INSERT INTO `tasks_old` (`uuid`, `title`, `status`, `version`, `rank`, `release_uuid`, `created_at`, `updated_at`, `deleted_at`)
+SELECT `uuid`, `title`, `status`, `version`, `rank`, `release_uuid`, `created_at`, `updated_at`, `deleted_at`
+FROM `tasks`;
+
+DROP TABLE `tasks`;
+ALTER TABLE `tasks_old` RENAME TO `tasks`;
+CREATE INDEX IF NOT EXISTS `idx_task_release_uuid` ON `tasks` (`release_uuid`);
+CREATE INDEX IF NOT EXISTS `idx_task_deleted_at` ON `tasks` (`deleted_at`);
+
+COMMIT;
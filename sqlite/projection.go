@@ -0,0 +1,254 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+type ProjectionStore struct {
+	db *sql.DB
+}
+
+func NewProjectionStore(db *sql.DB) ProjectionStore {
+	return ProjectionStore{db: db}
+}
+
+func (s ProjectionStore) Load(ctx context.Context) (*tonight.Projection, error) {
+	p := tonight.NewProjection()
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, `
+SELECT uuid, name, description, slug, version, created_at, updated_at, deleted_at
+FROM projects
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var project tonight.Project
+		err := rows.Scan(
+			&project.UUID,
+			&project.Name,
+			&project.Description,
+			&project.Slug,
+			&project.Version,
+			&project.CreatedAt,
+			&project.UpdatedAt,
+			&project.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.Projects[project.UUID] = project
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn(ctx, s.db).QueryContext(ctx, `
+SELECT project_uuid, user_id, permission
+FROM user_permission_on_project
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var projectUUID uuid.UUID
+		var userID, perm string
+		if err := rows.Scan(&projectUUID, &userID, &perm); err != nil {
+			return nil, err
+		}
+		if p.Permissions[projectUUID] == nil {
+			p.Permissions[projectUUID] = make(map[string]string)
+		}
+		p.Permissions[projectUUID][userID] = perm
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn(ctx, s.db).QueryContext(ctx, `
+SELECT uuid, title, description, version, project_uuid, created_at, updated_at, deleted_at
+FROM releases
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var release tonight.Release
+		err := rows.Scan(
+			&release.UUID,
+			&release.Title,
+			&release.Description,
+			&release.Version,
+			&release.Project.UUID,
+			&release.CreatedAt,
+			&release.UpdatedAt,
+			&release.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.Releases[release.UUID] = release
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = conn(ctx, s.db).QueryContext(ctx, `
+SELECT uuid, title, description, status, version, rank, release_uuid, created_at, updated_at, deleted_at
+FROM tasks
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t tonight.Task
+		var rank sql.NullString
+		err := rows.Scan(
+			&t.UUID,
+			&t.Title,
+			&t.Description,
+			&t.Status,
+			&t.Version,
+			&rank,
+			&t.Release.UUID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+			&t.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		p.Tasks[t.UUID] = t
+		if rank.Valid {
+			p.Ranks[t.UUID] = rank.String
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Reset replaces the content of the tables by p, in a single
+// transaction. Users are left untouched.
+func (s ProjectionStore) Reset(ctx context.Context, p *tonight.Projection) error {
+	return withTx(ctx, s.db, func(tx querier) error {
+		return s.reset(ctx, tx, p)
+	})
+}
+
+func (s ProjectionStore) reset(ctx context.Context, tx querier, p *tonight.Projection) error {
+	// Children first because of the foreign keys
+	for _, table := range []string{"tasks", "releases", "user_permission_on_project", "projects"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return err
+		}
+	}
+
+	query := `
+INSERT INTO projects (uuid, name, description, slug, version, created_at, updated_at, deleted_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+	for _, project := range p.Projects {
+		if _, err := tx.ExecContext(
+			ctx,
+			query,
+			project.UUID,
+			project.Name,
+			project.Description,
+			project.Slug,
+			project.Version,
+			project.CreatedAt.UTC(),
+			project.UpdatedAt.UTC(),
+			nullTime(project.DeletedAt),
+		); err != nil {
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO user_permission_on_project (user_id, project_uuid, permission)
+VALUES (?, ?, ?)
+`
+	for projectUUID, perms := range p.Permissions {
+		for userID, perm := range perms {
+			if _, err := tx.ExecContext(ctx, query, userID, projectUUID, perm); err != nil {
+				return err
+			}
+		}
+	}
+
+	query = `
+INSERT INTO releases (uuid, title, description, version, project_uuid, created_at, updated_at, deleted_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+	for _, release := range p.Releases {
+		if _, err := tx.ExecContext(
+			ctx,
+			query,
+			release.UUID,
+			release.Title,
+			release.Description,
+			release.Version,
+			release.Project.UUID,
+			release.CreatedAt.UTC(),
+			release.UpdatedAt.UTC(),
+			nullTime(release.DeletedAt),
+		); err != nil {
+			return err
+		}
+	}
+
+	query = `
+INSERT INTO tasks (uuid, title, description, status, version, rank, release_uuid, created_at, updated_at, deleted_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+	for _, t := range p.Tasks {
+		var rank sql.NullString
+		if r, ok := p.Ranks[t.UUID]; ok {
+			rank = sql.NullString{String: r, Valid: true}
+		}
+
+		if _, err := tx.ExecContext(
+			ctx,
+			query,
+			t.UUID,
+			t.Title,
+			t.Description,
+			t.Status,
+			t.Version,
+			rank,
+			t.Release.UUID,
+			t.CreatedAt.UTC(),
+			t.UpdatedAt.UTC(),
+			nullTime(t.DeletedAt),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nullTime returns NULL if t is nil.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
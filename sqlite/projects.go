@@ -0,0 +1,513 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bobinette/tonight"
+	uuid "github.com/satori/go.uuid"
+)
+
+type ProjectStore struct {
+	db *sql.DB
+}
+
+func NewProjectStore(db *sql.DB) ProjectStore {
+	return ProjectStore{db: db}
+}
+
+func (s ProjectStore) Upsert(ctx context.Context, p tonight.Project, u tonight.User) error {
+	return withTx(ctx, s.db, func(tx querier) error {
+		if p.Version == 0 {
+			query := `
+INSERT INTO projects (uuid, name, description, slug, version, created_at, updated_at)
+VALUES (?, ?, ?, ?, 1, ?, ?)
+`
+			_, err := tx.ExecContext(
+				ctx,
+				query,
+				p.UUID,
+				p.Name,
+				p.Description,
+				p.Slug,
+				p.CreatedAt.UTC(),
+				p.UpdatedAt.UTC(),
+			)
+			if isDuplicateEntry(err) {
+				return fmt.Errorf("project %s already exists: %w", p.UUID, tonight.ErrVersionConflict)
+			}
+			if err != nil {
+				return err
+			}
+		} else {
+			query := `
+UPDATE projects
+SET name = ?, description = ?, slug = ?, updated_at = ?, version = version + 1
+WHERE uuid = ? AND version = ?
+`
+			res, err := tx.ExecContext(
+				ctx,
+				query,
+				p.Name,
+				p.Description,
+				p.Slug,
+				p.UpdatedAt.UTC(),
+				p.UUID,
+				p.Version,
+			)
+			if isDuplicateEntry(err) {
+				return fmt.Errorf("slug %s of project %s is taken: %w", p.Slug, p.UUID, tonight.ErrConflict)
+			}
+			if err != nil {
+				return err
+			}
+			if err := checkVersion(res, "project", p.UUID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+INSERT OR IGNORE INTO user_permission_on_project (user_id, project_uuid, permission)
+VALUES (?, ?, ?)
+`
+		if _, err := tx.ExecContext(ctx, query, u.ID, p.UUID, "owner"); err != nil {
+			return err
+		}
+
+		query = `
+INSERT OR IGNORE INTO releases (uuid, title, description, project_uuid, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+		if _, err := tx.ExecContext(ctx, query, p.UUID, "Backlog", "", p.UUID, p.CreatedAt.UTC(), p.UpdatedAt.UTC()); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (s ProjectStore) List(ctx context.Context, u tonight.User) ([]tonight.Project, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE user_permission_on_project.user_id = ? AND projects.deleted_at IS NULL
+ORDER BY projects.created_at, projects.uuid
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make([]tonight.Project, 0)
+	uuids := make([]string, 0)
+	for rows.Next() {
+		var p tonight.Project
+		err := rows.Scan(
+			&p.UUID,
+			&p.Name,
+			&p.Description,
+			&p.Slug,
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		projects = append(projects, p)
+		uuids = append(uuids, p.UUID.String())
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(projects) == 0 {
+		return projects, nil
+	}
+
+	releases, err := s.loadReleases(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, p := range projects {
+		p.Releases = releases[p.UUID.String()]
+		if p.Releases == nil {
+			p.Releases = make([]tonight.Release, 0)
+		}
+		projects[i] = p
+	}
+
+	return projects, nil
+}
+
+func (s ProjectStore) Get(ctx context.Context, uuid uuid.UUID, u tonight.User) (tonight.Project, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE projects.uuid = ? AND user_permission_on_project.user_id = ? AND projects.deleted_at IS NULL
+ORDER BY created_at
+`
+
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, uuid, u.ID)
+	var p tonight.Project
+	err := row.Scan(
+		&p.UUID,
+		&p.Name,
+		&p.Description,
+		&p.Slug,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Project{}, notFound(err, "project", uuid)
+	}
+
+	releases, err := s.loadReleases(ctx, []string{p.UUID.String()})
+	if err != nil {
+		return tonight.Project{}, err
+	}
+
+	p.Releases = releases[p.UUID.String()]
+	if p.Releases == nil {
+		p.Releases = make([]tonight.Release, 0)
+	}
+
+	return p, nil
+}
+
+func (s ProjectStore) Find(ctx context.Context, slug string, u tonight.User) (tonight.Project, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE projects.slug = ? AND user_permission_on_project.user_id = ? AND projects.deleted_at IS NULL
+ORDER BY created_at
+`
+
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, slug, u.ID)
+	var p tonight.Project
+	err := row.Scan(
+		&p.UUID,
+		&p.Name,
+		&p.Description,
+		&p.Slug,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Project{}, notFound(err, "project", slug)
+	}
+
+	releases, err := s.loadReleases(ctx, []string{p.UUID.String()})
+	if err != nil {
+		return tonight.Project{}, err
+	}
+
+	p.Releases = releases[p.UUID.String()]
+	if p.Releases == nil {
+		p.Releases = make([]tonight.Release, 0)
+	}
+
+	return p, nil
+}
+
+func (s ProjectStore) Slugs(ctx context.Context, slugs []string, u tonight.User) ([]string, error) {
+	if len(slugs) == 0 {
+		return make([]string, 0), nil
+	}
+
+	qArgs, args := prepareArgs(slugs, u.ID)
+	query := fmt.Sprintf(`
+SELECT DISTINCT projects.slug
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+WHERE projects.slug IN %s AND user_permission_on_project.user_id = %s AND projects.deleted_at IS NULL
+`, qArgs...)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make([]string, 0, len(slugs))
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		found = append(found, slug)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return found, rows.Close()
+}
+
+func (s ProjectStore) Summaries(ctx context.Context, u tonight.User, filter tonight.ProjectFilter) ([]tonight.ProjectSummary, error) {
+	query := `
+SELECT projects.uuid, projects.name, projects.description, projects.slug, projects.version, projects.created_at, projects.updated_at
+FROM projects
+JOIN user_permission_on_project ON user_permission_on_project.project_uuid = projects.uuid
+`
+	args := make([]interface{}, 0)
+	where := "WHERE user_permission_on_project.user_id = ? AND projects.deleted_at IS NULL\n"
+	if filter.After != uuid.Nil {
+		// The page starts after the project of the cursor, in the
+		// order of the list
+		query += "JOIN projects AS cursor_project ON cursor_project.uuid = ?\n"
+		args = append(args, filter.After)
+		where += `AND (
+	projects.created_at > cursor_project.created_at
+	OR (projects.created_at = cursor_project.created_at AND projects.uuid > cursor_project.uuid)
+)
+`
+	}
+	args = append(args, u.ID)
+	query += where + "ORDER BY projects.created_at, projects.uuid\n"
+	if filter.Limit > 0 {
+		query += "LIMIT ?\n"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make([]tonight.ProjectSummary, 0)
+	uuids := make([]string, 0)
+	for rows.Next() {
+		var p tonight.Project
+		err := rows.Scan(
+			&p.UUID,
+			&p.Name,
+			&p.Description,
+			&p.Slug,
+			&p.Version,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		summaries = append(summaries, tonight.ProjectSummary{
+			Project:    p,
+			TaskCounts: map[tonight.TaskStatus]int{tonight.TaskStatusTODO: 0, tonight.TaskStatusDONE: 0},
+		})
+		uuids = append(uuids, p.UUID.String())
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(summaries) == 0 {
+		return summaries, nil
+	}
+
+	releases, err := s.listReleases(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.countTasks(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, summary := range summaries {
+		summary.Releases = releases[summary.UUID.String()]
+		if summary.Releases == nil {
+			summary.Releases = make([]tonight.Release, 0)
+		}
+		for status, n := range counts[summary.UUID.String()] {
+			summary.TaskCounts[status] = n
+		}
+		summaries[i] = summary
+	}
+
+	return summaries, nil
+}
+
+// countTasks returns the number of tasks of the projects by status, by
+// project uuid.
+func (s ProjectStore) countTasks(ctx context.Context, projectUUIDs []string) (map[string]map[tonight.TaskStatus]int, error) {
+	qArgs, args := prepareArgs(projectUUIDs)
+	query := fmt.Sprintf(`
+SELECT releases.project_uuid, tasks.status, COUNT(*)
+FROM tasks
+JOIN releases ON releases.uuid = tasks.release_uuid
+WHERE releases.project_uuid IN %s AND releases.deleted_at IS NULL AND tasks.deleted_at IS NULL
+GROUP BY releases.project_uuid, tasks.status
+`, qArgs...)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]map[tonight.TaskStatus]int)
+	for rows.Next() {
+		var projectUUID string
+		var status tonight.TaskStatus
+		var n int
+		if err := rows.Scan(&projectUUID, &status, &n); err != nil {
+			return nil, err
+		}
+
+		if counts[projectUUID] == nil {
+			counts[projectUUID] = make(map[tonight.TaskStatus]int)
+		}
+		counts[projectUUID][status] = n
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func (s ProjectStore) loadReleases(ctx context.Context, projectUUIDs []string) (map[string][]tonight.Release, error) {
+	releasesByProjectUUID, err := s.listReleases(ctx, projectUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseUUIDs := make([]string, 0)
+	for _, releases := range releasesByProjectUUID {
+		for _, release := range releases {
+			releaseUUIDs = append(releaseUUIDs, release.UUID.String())
+		}
+	}
+
+	tasksByReleaseUUID, err := s.loadTasks(ctx, releaseUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, releases := range releasesByProjectUUID {
+		for i, release := range releases {
+			releases[i].Tasks = tasksByReleaseUUID[release.UUID.String()]
+			if releases[i].Tasks == nil {
+				releases[i].Tasks = make([]tonight.Task, 0)
+			}
+		}
+	}
+
+	return releasesByProjectUUID, nil
+}
+
+// listReleases returns the releases of the projects without their
+// tasks, by project uuid.
+func (s ProjectStore) listReleases(ctx context.Context, projectUUIDs []string) (map[string][]tonight.Release, error) {
+	if len(projectUUIDs) == 0 {
+		return nil, nil
+	}
+
+	qArgs, args := prepareArgs(projectUUIDs)
+	query := fmt.Sprintf(`
+SELECT uuid, title, description, version, project_uuid, created_at, updated_at
+FROM releases
+WHERE project_uuid IN %s AND deleted_at IS NULL
+ORDER BY
+	CASE WHEN project_uuid = uuid
+	THEN 1
+	ELSE 0
+	END ASC,
+	title ASC
+`, qArgs...)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releasesByProjectUUID := make(map[string][]tonight.Release, 0)
+	for rows.Next() {
+		var release tonight.Release
+		err := rows.Scan(
+			&release.UUID,
+			&release.Title,
+			&release.Description,
+			&release.Version,
+			&release.Project.UUID,
+			&release.CreatedAt,
+			&release.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		releasesByProjectUUID[release.Project.UUID.String()] = append(
+			releasesByProjectUUID[release.Project.UUID.String()],
+			release,
+		)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return releasesByProjectUUID, nil
+}
+
+func (s ProjectStore) loadTasks(ctx context.Context, uuids []string) (map[string][]tonight.Task, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+
+	qArgs, args := prepareArgs(uuids)
+	query := fmt.Sprintf(`
+SELECT uuid, title, description, status, version, rank, release_uuid, created_at, updated_at
+FROM tasks
+WHERE release_uuid IN %s AND deleted_at IS NULL
+ORDER BY rank IS NULL, rank, created_at, uuid
+`, qArgs...)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasksByReleaseUUID := make(map[string][]tonight.Task)
+	for rows.Next() {
+		var t tonight.Task
+		var rank sql.NullString
+		err := rows.Scan(
+			&t.UUID,
+			&t.Title,
+			&t.Description,
+			&t.Status,
+			&t.Version,
+			&rank,
+			&t.Release.UUID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		t.Rank = rank.String
+
+		releaseUUID := t.Release.UUID.String()
+		tasksByReleaseUUID[releaseUUID] = append(tasksByReleaseUUID[releaseUUID], t)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return tasksByReleaseUUID, nil
+}
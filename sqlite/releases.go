@@ -0,0 +1,217 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/bobinette/tonight"
+	uuid "github.com/satori/go.uuid"
+)
+
+type ReleaseStore struct {
+	db *sql.DB
+}
+
+func NewReleaseStore(db *sql.DB) ReleaseStore {
+	return ReleaseStore{db: db}
+}
+
+func (s ReleaseStore) Get(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	release, err := s.Head(ctx, id)
+	if err != nil {
+		return tonight.Release{}, err
+	}
+
+	tasks, err := s.loadTasks(ctx, []string{release.UUID.String()})
+	if err != nil {
+		return tonight.Release{}, err
+	}
+
+	release.Tasks = tasks[release.UUID.String()]
+	if release.Tasks == nil {
+		release.Tasks = make([]tonight.Task, 0)
+	}
+
+	return release, nil
+}
+
+func (s ReleaseStore) Head(ctx context.Context, id uuid.UUID) (tonight.Release, error) {
+	query := `
+SELECT releases.uuid, releases.title, releases.description, releases.version, releases.project_uuid, releases.created_at, releases.updated_at
+FROM releases
+JOIN projects ON projects.uuid = releases.project_uuid
+WHERE releases.uuid = ? AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
+`
+
+	row := conn(ctx, s.db).QueryRowContext(ctx, query, id)
+	var release tonight.Release
+	err := row.Scan(
+		&release.UUID,
+		&release.Title,
+		&release.Description,
+		&release.Version,
+		&release.Project.UUID,
+		&release.CreatedAt,
+		&release.UpdatedAt,
+	)
+	if err != nil {
+		return tonight.Release{}, notFound(err, "release", id)
+	}
+
+	release.Tasks = make([]tonight.Task, 0)
+	return release, nil
+}
+
+func (s ReleaseStore) List(ctx context.Context, projectUUID uuid.UUID) ([]tonight.Release, error) {
+	query := `
+SELECT releases.uuid, releases.title, releases.description, releases.version, releases.project_uuid, releases.created_at, releases.updated_at
+FROM releases
+JOIN projects ON projects.uuid = releases.project_uuid
+WHERE releases.project_uuid = ? AND releases.deleted_at IS NULL AND projects.deleted_at IS NULL
+ORDER BY
+	CASE WHEN releases.project_uuid = releases.uuid
+	THEN 1
+	ELSE 0
+	END ASC,
+	releases.title ASC
+`
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, projectUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := make([]tonight.Release, 0)
+	releaseUUIDs := make([]string, 0)
+	for rows.Next() {
+		var release tonight.Release
+		err := rows.Scan(
+			&release.UUID,
+			&release.Title,
+			&release.Description,
+			&release.Version,
+			&release.Project.UUID,
+			&release.CreatedAt,
+			&release.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		release.Tasks = make([]tonight.Task, 0)
+		releases = append(releases, release)
+		releaseUUIDs = append(releaseUUIDs, release.UUID.String())
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	tasksByReleaseUUID, err := s.loadTasks(ctx, releaseUUIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for releaseUUID, tasks := range tasksByReleaseUUID {
+		for i, release := range releases {
+			if releaseUUID == release.UUID.String() {
+				release.Tasks = tasks
+				releases[i] = release
+				break
+			}
+		}
+	}
+
+	return releases, nil
+}
+
+func (s ReleaseStore) Upsert(ctx context.Context, release tonight.Release) error {
+	if release.Version == 0 {
+		query := `
+INSERT INTO releases (uuid, title, description, version, project_uuid, created_at, updated_at)
+VALUES (?, ?, ?, 1, ?, ?, ?)
+`
+		_, err := conn(ctx, s.db).ExecContext(
+			ctx,
+			query,
+			release.UUID,
+			release.Title,
+			release.Description,
+			release.Project.UUID,
+			release.CreatedAt.UTC(),
+			release.UpdatedAt.UTC(),
+		)
+		if isDuplicateEntry(err) {
+			return fmt.Errorf("release %s already exists: %w", release.UUID, tonight.ErrVersionConflict)
+		}
+		return err
+	}
+
+	query := `
+UPDATE releases
+SET title = ?, description = ?, updated_at = ?, version = version + 1
+WHERE uuid = ? AND version = ?
+`
+	res, err := conn(ctx, s.db).ExecContext(
+		ctx,
+		query,
+		release.Title,
+		release.Description,
+		release.UpdatedAt.UTC(),
+		release.UUID,
+		release.Version,
+	)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res, "release", release.UUID)
+}
+
+func (s ReleaseStore) loadTasks(ctx context.Context, uuids []string) (map[string][]tonight.Task, error) {
+	if len(uuids) == 0 {
+		return nil, nil
+	}
+
+	qArgs, args := prepareArgs(uuids)
+	query := fmt.Sprintf(`
+SELECT uuid, title, description, status, version, rank, release_uuid, created_at, updated_at
+FROM tasks
+WHERE release_uuid IN %s AND deleted_at IS NULL
+ORDER BY rank IS NULL, rank, created_at, uuid
+`, qArgs...)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasksByProjectUUID := make(map[string][]tonight.Task)
+	for rows.Next() {
+		var t tonight.Task
+		var rank sql.NullString
+		var projectUUID string
+		err := rows.Scan(
+			&t.UUID,
+			&t.Title,
+			&t.Description,
+			&t.Status,
+			&t.Version,
+			&rank,
+			&projectUUID,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		t.Rank = rank.String
+
+		tasksByProjectUUID[projectUUID] = append(tasksByProjectUUID[projectUUID], t)
+	}
+
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return tasksByProjectUUID, nil
+}
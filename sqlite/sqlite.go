@@ -0,0 +1,26 @@
+// Package sqlite implements the tonight stores on top of an SQLite
+// database, to run Tonight without a database server.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+)
+
+// Open opens the SQLite database at path, creating the file if needed.
+//
+// Foreign keys are enforced like in MySQL, and transactions take the
+// write lock as soon as they start so that concurrent writers wait for
+// each other instead of failing. Times are read in the local time zone
+// and, as the stores write them in UTC, compare in chronological
+// order.
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_foreign_keys", "1")
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_txlock", "immediate")
+	params.Set("_loc", "auto")
+	return sql.Open("sqlite3", fmt.Sprintf("file:%s?%s", path, params.Encode()))
+}
@@ -0,0 +1,39 @@
+package sqlite
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight/tonighttest"
+)
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tonight")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := Open(filepath.Join(dir, "tonight_test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	migrator, err := NewMigrator(db)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background(), 0)
+	require.NoError(t, err)
+
+	tonighttest.TestStores(t, tonighttest.Stores{
+		Transactor:    NewTransactor(db),
+		EventStore:    NewEventStore(db),
+		ProjectStore:  NewProjectStore(db),
+		ReleaseStore:  NewReleaseStore(db),
+		TaskStore:     NewTaskStore(db),
+		UserStore:     NewUserStore(db),
+		SnapshotStore: NewSnapshotStore(db),
+		WebhookStore:  NewWebhookStore(db),
+		TrashStore:    NewTrashStore(db),
+	})
+}
@@ -0,0 +1,162 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+// trashTables are the tables of the entities of each kind.
+var trashTables = map[tonight.TrashKind]string{
+	tonight.TrashTask:    "tasks",
+	tonight.TrashRelease: "releases",
+	tonight.TrashProject: "projects",
+}
+
+// trashProjectColumns are the columns of the uuid of the project in
+// the queries of each kind.
+var trashProjectColumns = map[tonight.TrashKind]string{
+	tonight.TrashTask:    "releases.project_uuid",
+	tonight.TrashRelease: "releases.project_uuid",
+	tonight.TrashProject: "projects.uuid",
+}
+
+// trashQueries select the entities of each kind in the trash. The
+// condition on the project, or on the deletion date, is appended.
+var trashQueries = map[tonight.TrashKind]string{
+	tonight.TrashTask: `
+SELECT tasks.uuid, tasks.title, releases.project_uuid, tasks.release_uuid, tasks.deleted_at
+FROM tasks
+JOIN releases ON releases.uuid = tasks.release_uuid
+WHERE tasks.deleted_at IS NOT NULL
+`,
+	tonight.TrashRelease: `
+SELECT releases.uuid, releases.title, releases.project_uuid, NULL, releases.deleted_at
+FROM releases
+WHERE releases.deleted_at IS NOT NULL
+`,
+	tonight.TrashProject: `
+SELECT projects.uuid, projects.name, projects.uuid, NULL, projects.deleted_at
+FROM projects
+WHERE projects.deleted_at IS NOT NULL
+`,
+}
+
+type TrashStore struct {
+	db *sql.DB
+}
+
+func NewTrashStore(db *sql.DB) TrashStore {
+	return TrashStore{db: db}
+}
+
+func (s TrashStore) Delete(ctx context.Context, kind tonight.TrashKind, id uuid.UUID, at time.Time) error {
+	table, ok := trashTables[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %s", kind)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET deleted_at = ? WHERE uuid = ? AND deleted_at IS NULL", table)
+	res, err := conn(ctx, s.db).ExecContext(ctx, query, at.UTC(), id)
+	if err != nil {
+		return err
+	}
+	return checkFound(res, string(kind), id)
+}
+
+func (s TrashStore) Restore(ctx context.Context, kind tonight.TrashKind, id uuid.UUID) error {
+	table, ok := trashTables[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %s", kind)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET deleted_at = NULL WHERE uuid = ? AND deleted_at IS NOT NULL", table)
+	res, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return checkFound(res, string(kind), id)
+}
+
+func (s TrashStore) List(ctx context.Context, u tonight.User) ([]tonight.TrashItem, error) {
+	items, err := s.items(ctx, func(table, projectColumn string) string {
+		return fmt.Sprintf("AND %s IN (SELECT project_uuid FROM user_permission_on_project WHERE user_id = ?)", projectColumn)
+	}, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return trashLess(items[j], items[i]) })
+	return items, nil
+}
+
+func (s TrashStore) Expired(ctx context.Context, before time.Time) ([]tonight.TrashItem, error) {
+	items, err := s.items(ctx, func(table, projectColumn string) string {
+		return fmt.Sprintf("AND %s.deleted_at < ?", table)
+	}, before.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool { return trashLess(items[i], items[j]) })
+	return items, nil
+}
+
+// items returns the entities in the trash matching the condition
+// returned by cond, given the table of each kind and the column of the
+// uuid of the project.
+func (s TrashStore) items(ctx context.Context, cond func(table, projectColumn string) string, arg interface{}) ([]tonight.TrashItem, error) {
+	items := make([]tonight.TrashItem, 0)
+	for _, kind := range []tonight.TrashKind{tonight.TrashTask, tonight.TrashRelease, tonight.TrashProject} {
+		query := trashQueries[kind] + cond(trashTables[kind], trashProjectColumns[kind])
+		rows, err := conn(ctx, s.db).QueryContext(ctx, query, arg)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			item := tonight.TrashItem{Kind: kind}
+			var releaseUUID uuid.NullUUID
+			err := rows.Scan(&item.UUID, &item.Title, &item.ProjectUUID, &releaseUUID, &item.DeletedAt)
+			if err != nil {
+				return nil, err
+			}
+			item.ReleaseUUID = releaseUUID.UUID
+			items = append(items, item)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (s TrashStore) Purge(ctx context.Context, kind tonight.TrashKind, id uuid.UUID) error {
+	table, ok := trashTables[kind]
+	if !ok {
+		return fmt.Errorf("unknown kind %s", kind)
+	}
+
+	// The foreign keys delete everything the entity contains
+	query := fmt.Sprintf("DELETE FROM %s WHERE uuid = ? AND deleted_at IS NOT NULL", table)
+	res, err := conn(ctx, s.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return checkFound(res, string(kind), id)
+}
+
+// trashLess sorts the items by deletion date.
+func trashLess(a, b tonight.TrashItem) bool {
+	if !a.DeletedAt.Equal(b.DeletedAt) {
+		return a.DeletedAt.Before(b.DeletedAt)
+	}
+	return a.UUID.String() < b.UUID.String()
+}
@@ -0,0 +1,77 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	driver "github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/bobinette/tonight"
+)
+
+// checkVersion returns tonight.ErrVersionConflict if the update whose
+// result is res, conditioned on the version of the entity, did not
+// modify anything.
+func checkVersion(res sql.Result, kind string, id uuid.UUID) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s: %w", kind, id, tonight.ErrVersionConflict)
+	}
+	return nil
+}
+
+// notFound returns tonight.ErrNotFound if err, the error of looking up
+// the entity kind identified by key, is sql.ErrNoRows.
+func notFound(err error, kind string, key interface{}) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s %v: %w", kind, key, tonight.ErrNotFound)
+	}
+	return err
+}
+
+// isDuplicateEntry returns true if err is due to a duplicate primary or
+// unique key.
+func isDuplicateEntry(err error) bool {
+	var sqliteErr driver.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == driver.ErrConstraintPrimaryKey || sqliteErr.ExtendedCode == driver.ErrConstraintUnique)
+}
+
+func prepareArgs(params ...interface{}) ([]interface{}, []interface{}) {
+	qArgs := make([]interface{}, 0)
+	args := make([]interface{}, 0)
+	for _, p := range params {
+		switch p := p.(type) {
+		case []string:
+			s := make([]string, len(p))
+			for i, e := range p {
+				s[i] = "?"
+				args = append(args, e)
+			}
+			qArgs = append(qArgs, fmt.Sprintf("(%s)", strings.Join(s, ",")))
+		default:
+			qArgs = append(qArgs, "?")
+			args = append(args, p)
+		}
+	}
+	return qArgs, args
+}
+
+// checkFound returns tonight.ErrNotFound if the statement whose result
+// is res did not modify anything.
+func checkFound(res sql.Result, kind string, id uuid.UUID) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s: %w", kind, id, tonight.ErrNotFound)
+	}
+	return nil
+}
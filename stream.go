@@ -0,0 +1,184 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+type streamService struct {
+	bus        *EventBus
+	eventStore EventStore
+	userStore  UserStore
+
+	heartbeat time.Duration
+}
+
+// stream sends the events of a project as server-sent events, as they
+// are published on the bus. Clients reconnecting with a Last-Event-ID
+// header first receive the events they missed, from the event store.
+//
+// The bus does not wait for the clients: the stream of a client too
+// slow to keep up is closed, for it to reconnect and catch up.
+func (s *streamService) stream(c echo.Context) error {
+	projectUUID, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	perm, err := s.userStore.Permission(ctx, user, projectUUID.String())
+	if err != nil {
+		return err
+	}
+	if perm == "" {
+		return ErrForbidden
+	}
+
+	// Subscribe before looking for missed events so that none is lost
+	// in between. Events both missed and received from the bus are
+	// only sent once.
+	sub := s.bus.SubscribeLive(projectUUID)
+	defer sub.Close()
+
+	var missed []Event
+	if lastEventID := c.Request().Header.Get("Last-Event-ID"); lastEventID != "" {
+		since, lastEventUUID, err := parseServerSentEventID(lastEventID)
+		if err != nil {
+			return invalid("Last-Event-ID", "is not an event id")
+		}
+
+		missed, err = s.missedEvents(ctx, projectUUID, since, lastEventUUID)
+		if err != nil {
+			return err
+		}
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	sent := make(map[uuid.UUID]bool, len(missed))
+	for _, e := range missed {
+		if err := writeServerSentEvent(res, e); err != nil {
+			return err
+		}
+		sent[e.UUID] = true
+	}
+
+	ticker := time.NewTicker(s.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				// The server is shutting down, or the client is too
+				// slow and reconnects with its Last-Event-ID
+				return nil
+			}
+			if sent[e.UUID] {
+				continue
+			}
+			if err := writeServerSentEvent(res, e); err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+			res.Flush()
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// missedEvents returns the events of the project stored after the
+// one identified by lastEventUUID, created at since. Only the events
+// created since then are listed, all of them if since is zero.
+func (s *streamService) missedEvents(ctx context.Context, projectUUID uuid.UUID, since time.Time, lastEventUUID uuid.UUID) ([]Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Some stores keep the dates to the second only
+	filter := EventFilter{ProjectUUID: projectUUID, Since: since.Truncate(time.Second)}
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() { errc <- s.eventStore.List(ctx, filter, ch) }()
+
+	missed := make([]Event, 0)
+	found := false
+	for e := range ch {
+		if found {
+			missed = append(missed, e)
+		}
+		if e.UUID == lastEventUUID {
+			found = true
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+
+	return missed, nil
+}
+
+// serverSentEventID is the id of the server-sent event of e: its
+// creation date and its uuid, for the clients reconnecting to only get
+// the events created since.
+func serverSentEventID(e Event) string {
+	return fmt.Sprintf("%s/%s", e.CreatedAt.UTC().Format(time.RFC3339Nano), e.UUID)
+}
+
+// parseServerSentEventID returns the creation date and the uuid of the
+// event of id. The ids given before they held the date are the uuid
+// alone, their date is zero.
+func parseServerSentEventID(id string) (time.Time, uuid.UUID, error) {
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		eventUUID, err := uuid.FromString(id)
+		return time.Time{}, eventUUID, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, id[:i])
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	eventUUID, err := uuid.FromString(id[i+1:])
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return createdAt, eventUUID, nil
+}
+
+func writeServerSentEvent(res *echo.Response, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", serverSentEventID(e), e.Type, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
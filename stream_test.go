@@ -0,0 +1,183 @@
+package tonight
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// permissionUserStore gives the permissions it holds, by user id.
+type permissionUserStore map[string]string
+
+func (s permissionUserStore) Ensure(ctx context.Context, user *User) error {
+	return nil
+}
+
+func (s permissionUserStore) Permission(ctx context.Context, user User, projectUUID string) (string, error) {
+	return s[user.ID], nil
+}
+
+func (s permissionUserStore) List(ctx context.Context, ids []string) ([]User, error) {
+	users := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := s[id]; ok {
+			users = append(users, User{ID: id, Name: id})
+		}
+	}
+	return users, nil
+}
+
+func TestStream(t *testing.T) {
+	projectUUID := uuid.NewV1()
+	events := make([]Event, 4)
+	for i := range events {
+		events[i] = Event{
+			UUID:        uuid.NewV1(),
+			Type:        TaskCreate,
+			EntityUUID:  uuid.NewV1(),
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(fmt.Sprintf(`{"title": "task %d"}`, i)),
+			CreatedAt:   time.Now(),
+		}
+	}
+	store := sliceEventStore{
+		events[0],
+		events[1],
+		// Not in the project
+		{UUID: uuid.NewV1(), ProjectUUID: uuid.NewV1(), Payload: []byte(`{}`)},
+	}
+
+	bus := NewEventBus(10)
+	defer bus.Close()
+	s := streamService{
+		bus:        bus,
+		eventStore: &store,
+		userStore:  permissionUserStore{"user": "owner"},
+		heartbeat:  10 * time.Millisecond,
+	}
+
+	e := echo.New()
+	e.GET("/projects/:uuid/events/stream", s.stream)
+	ts := httptest.NewServer(e)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/projects/%s/events/stream", ts.URL, projectUUID), nil)
+	require.NoError(t, err)
+	req = req.WithContext(ctx)
+	req.Header.Set("Token-Claim-Sub", "user")
+	req.Header.Set("Last-Event-ID", serverSentEventID(events[0]))
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// events[1] has been missed but is also published, it should only
+	// be received once.
+	require.NoError(t, bus.Publish(ctx, events[1]))
+	require.NoError(t, bus.Publish(ctx, Event{UUID: uuid.NewV1(), ProjectUUID: uuid.NewV1(), Payload: []byte(`{}`)}))
+	require.NoError(t, bus.Publish(ctx, events[2]))
+	require.NoError(t, bus.Publish(ctx, events[3]))
+
+	ids := make(chan string)
+	heartbeats := make(chan struct{}, 1)
+	go func() {
+		defer close(ids)
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				ids <- strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, ": heartbeat"):
+				select {
+				case heartbeats <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	received := make([]string, 0)
+	for len(received) < 3 {
+		select {
+		case id := <-ids:
+			received = append(received, id)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only received %v", received)
+		}
+	}
+	require.Equal(t, []string{
+		serverSentEventID(events[1]),
+		serverSentEventID(events[2]),
+		serverSentEventID(events[3]),
+	}, received)
+
+	select {
+	case <-heartbeats:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no heartbeat")
+	}
+
+	req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("%s/projects/%s/events/stream", ts.URL, projectUUID), nil)
+	require.NoError(t, err)
+	req.Header.Set("Token-Claim-Sub", "other")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.NotEqual(t, http.StatusOK, res.StatusCode)
+}
+
+// filterRecordingEventStore records the filters it lists events with.
+type filterRecordingEventStore struct {
+	EventStore
+	filters []EventFilter
+}
+
+func (s *filterRecordingEventStore) List(ctx context.Context, filter EventFilter, ch chan<- Event) error {
+	s.filters = append(s.filters, filter)
+	return s.EventStore.List(ctx, filter, ch)
+}
+
+func TestMissedEvents(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	createdAt := time.Date(2026, 10, 18, 9, 30, 12, 345, time.UTC)
+	last := Event{UUID: uuid.NewV1(), ProjectUUID: projectUUID, CreatedAt: createdAt}
+	next := Event{UUID: uuid.NewV1(), ProjectUUID: projectUUID, CreatedAt: createdAt.Add(time.Second)}
+
+	store := &filterRecordingEventStore{EventStore: &sliceEventStore{last, next}}
+	s := streamService{eventStore: store}
+
+	since, lastUUID, err := parseServerSentEventID(serverSentEventID(last))
+	require.NoError(t, err)
+	require.True(t, createdAt.Equal(since))
+	require.Equal(t, last.UUID, lastUUID)
+
+	missed, err := s.missedEvents(ctx, projectUUID, since, lastUUID)
+	require.NoError(t, err)
+	require.Len(t, missed, 1)
+	require.Equal(t, next.UUID, missed[0].UUID)
+	require.Equal(t, createdAt.Truncate(time.Second), store.filters[0].Since)
+
+	// The ids sent before they held the date are still accepted
+	since, lastUUID, err = parseServerSentEventID(last.UUID.String())
+	require.NoError(t, err)
+	require.True(t, since.IsZero())
+	require.Equal(t, last.UUID, lastUUID)
+
+	_, _, err = parseServerSentEventID("yesterday/" + last.UUID.String())
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package tonight
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -20,20 +21,56 @@ type Task struct {
 
 	Title  string     `json:"title"`
 	Status TaskStatus `json:"status"`
+	// Description is markdown. The API returns it along with its HTML
+	// rendering and a plain-text excerpt, see taskResponse.
+	Description string `json:"description"`
+	// Rank sorts the tasks of a release, the unranked ones last. It
+	// is empty if the task has never been moved.
+	Rank string `json:"rank"`
 
 	Release Release `json:"release"`
 
+	Version int `json:"version"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is only set for the entities in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// ErrVersionConflict is returned by the stores when upserting an
+// entity whose version is not the one stored anymore.
+var ErrVersionConflict = fmt.Errorf("version %w", ErrConflict)
+
 // A TaskStore is responsible for storing tasks, typically in a
 // database.
+//
+// The version of the task given to Upsert is the version the caller
+// expects to be stored, 0 for a new task. The stored version is
+// incremented, or ErrVersionConflict returned if it did not match.
+// Upsert leaves the rank of the task alone, unless the task moves to
+// another release: it is then unranked. Rank sets the ranks of the
+// given tasks without changing their version. An empty rank unranks a
+// task.
 type TaskStore interface {
 	Upsert(ctx context.Context, t Task) error
 	Get(ctx context.Context, uuid uuid.UUID, u User) (Task, error)
 
-	Reorder(ctx context.Context, rankedUUIDs []uuid.UUID) error
+	Rank(ctx context.Context, ranks map[uuid.UUID]string) error
+
+	// List the tasks of the release in their order, filtered by filter.
+	List(ctx context.Context, releaseUUID uuid.UUID, filter TaskFilter) ([]Task, error)
+}
+
+// A TaskFilter selects a page of tasks: at most Limit tasks, all of
+// them if it is 0, coming after the task identified by After, or from
+// the first one if it is uuid.Nil.
+type TaskFilter struct {
+	// Statuses of the tasks listed, any if empty
+	Statuses []TaskStatus
+
+	After uuid.UUID
+	Limit int
 }
 
 // A Project groups tasks.
@@ -47,18 +84,43 @@ type Project struct {
 
 	Releases []Release `json:"releases"`
 
+	Version int `json:"version"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is only set for the entities in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 // A ProjectStore is responsible for storing projects, typically in a
-// database.
+// database. Upsert checks and increments versions like
+// TaskStore.Upsert.
 type ProjectStore interface {
 	Upsert(ctx context.Context, p Project, u User) error
 	List(ctx context.Context, u User) ([]Project, error)
 	Get(ctx context.Context, uuid uuid.UUID, u User) (Project, error)
 
 	Find(ctx context.Context, slug string, u User) (Project, error)
+	// Slugs returns the slugs, among the given ones, of projects of the
+	// user.
+	Slugs(ctx context.Context, slugs []string, u User) ([]string, error)
+
+	// Summaries lists a page of the projects of the user, like List.
+	Summaries(ctx context.Context, u User, filter ProjectFilter) ([]ProjectSummary, error)
+}
+
+// A ProjectSummary is a project whose releases come without their
+// tasks, with the number of tasks of the project by status instead.
+type ProjectSummary struct {
+	Project
+
+	TaskCounts map[TaskStatus]int `json:"task_counts"`
+}
+
+// A ProjectFilter selects a page of projects, like a TaskFilter.
+type ProjectFilter struct {
+	After uuid.UUID
+	Limit int
 }
 
 type User struct {
@@ -69,4 +131,7 @@ type User struct {
 type UserStore interface {
 	Ensure(ctx context.Context, user *User) error
 	Permission(ctx context.Context, user User, projectUUID string) (string, error)
+
+	// List the users with the given ids, unknown ids are ignored.
+	List(ctx context.Context, ids []string) ([]User, error)
 }
@@ -0,0 +1,199 @@
+package tonighttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestEventStore(t *testing.T, eventStore tonight.EventStore, userStore tonight.UserStore) {
+	ctx := context.Background()
+
+	// Users are unique to this run so that events left over by other
+	// tests do not show up in the results.
+	user := tonight.User{ID: fmt.Sprintf("eventuser-%s", uuid.NewV4())}
+	require.NoError(t, userStore.Ensure(ctx, &user))
+	otherUser := tonight.User{ID: fmt.Sprintf("eventuser-%s", uuid.NewV4())}
+	require.NoError(t, userStore.Ensure(ctx, &otherUser))
+
+	taskUUID := uuid.NewV1()
+	projectUUID := uuid.NewV1()
+	correlationID := uuid.NewV1()
+	start := time.Now().Truncate(time.Second)
+
+	events := []tonight.Event{
+		{
+			UUID:        projectUUID,
+			Type:        tonight.ProjectCreate,
+			EntityUUID:  projectUUID,
+			ProjectUUID: projectUUID,
+			UserID:      user.ID,
+			Payload:     []byte(`{"name":"project"}`),
+			CreatedAt:   start,
+		},
+		{
+			UUID:        taskUUID,
+			Type:        tonight.TaskCreate,
+			EntityUUID:  taskUUID,
+			ProjectUUID: projectUUID,
+			UserID:      user.ID,
+			Payload:     []byte(`{"title":"task"}`),
+			CreatedAt:   start.Add(1 * time.Second),
+		},
+		{
+			UUID:          uuid.NewV1(),
+			Type:          tonight.TaskUpdate,
+			EntityUUID:    taskUUID,
+			ProjectUUID:   projectUUID,
+			UserID:        otherUser.ID,
+			CorrelationID: correlationID,
+			Payload:       []byte(`{"title":"updated task"}`),
+			CreatedAt:     start.Add(2 * time.Second),
+		},
+		{
+			UUID:       uuid.NewV1(),
+			Type:       tonight.TaskDone,
+			EntityUUID: taskUUID,
+			UserID:     user.ID,
+			Payload:    []byte(`{}`),
+			CreatedAt:  start.Add(3 * time.Second),
+		},
+	}
+
+	// Store them out of order to make sure List sorts them by creation date.
+	for _, i := range []int{2, 0, 3, 1} {
+		require.NoError(t, eventStore.Store(ctx, events[i]))
+	}
+
+	// Events are identified by their uuid
+	err := eventStore.Store(ctx, events[0])
+	require.True(t, errors.Is(err, tonight.ErrDuplicateEvent), "expected duplicate event, got %v", err)
+
+	uuids := func(events []tonight.Event) []string {
+		res := make([]string, len(events))
+		for i, e := range events {
+			res[i] = e.UUID.String()
+		}
+		return res
+	}
+
+	entities := []uuid.UUID{projectUUID, taskUUID}
+	tests := map[string]struct {
+		filter   tonight.EventFilter
+		expected []tonight.Event
+	}{
+		"by entity": {
+			filter:   tonight.EventFilter{EntityUUIDs: []uuid.UUID{taskUUID}},
+			expected: events[1:],
+		},
+		"by entities": {
+			filter:   tonight.EventFilter{EntityUUIDs: entities},
+			expected: events,
+		},
+		"by project": {
+			// The last event has no project
+			filter:   tonight.EventFilter{ProjectUUID: projectUUID},
+			expected: events[:3],
+		},
+		"by user": {
+			filter:   tonight.EventFilter{UserID: user.ID},
+			expected: []tonight.Event{events[0], events[1], events[3]},
+		},
+		"by correlation id": {
+			filter:   tonight.EventFilter{CorrelationID: correlationID},
+			expected: events[2:3],
+		},
+		"by type": {
+			filter: tonight.EventFilter{
+				EntityUUIDs: entities,
+				Types:       []tonight.EventType{tonight.TaskCreate, tonight.TaskDone},
+			},
+			expected: []tonight.Event{events[1], events[3]},
+		},
+		"by time range": {
+			filter: tonight.EventFilter{
+				EntityUUIDs: entities,
+				Since:       start.Add(1 * time.Second),
+				Until:       start.Add(2 * time.Second),
+			},
+			expected: events[1:3],
+		},
+		"reversed": {
+			filter:   tonight.EventFilter{EntityUUIDs: entities, Reverse: true},
+			expected: []tonight.Event{events[3], events[2], events[1], events[0]},
+		},
+		"page": {
+			filter:   tonight.EventFilter{EntityUUIDs: entities, Offset: 1, Limit: 2},
+			expected: events[1:3],
+		},
+		"reversed page": {
+			filter:   tonight.EventFilter{EntityUUIDs: entities, Reverse: true, Offset: 1, Limit: 2},
+			expected: []tonight.Event{events[2], events[1]},
+		},
+		"offset only": {
+			filter:   tonight.EventFilter{EntityUUIDs: entities, Offset: 3},
+			expected: events[3:],
+		},
+		"no match": {
+			filter: tonight.EventFilter{
+				UserID: otherUser.ID,
+				Types:  []tonight.EventType{tonight.ProjectCreate},
+			},
+			expected: []tonight.Event{},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ch := make(chan tonight.Event)
+			errc := make(chan error, 1)
+			go func() { errc <- eventStore.List(ctx, test.filter, ch) }()
+
+			listed := make([]tonight.Event, 0)
+			for e := range ch {
+				listed = append(listed, e)
+			}
+			require.NoError(t, <-errc)
+			require.Equal(t, uuids(test.expected), uuids(listed))
+
+			for i, e := range listed {
+				expected := test.expected[i]
+				require.Equal(t, expected.Type, e.Type)
+				require.Equal(t, expected.EntityUUID, e.EntityUUID)
+				require.Equal(t, expected.ProjectUUID, e.ProjectUUID)
+				require.Equal(t, expected.UserID, e.UserID)
+				require.Equal(t, expected.CorrelationID, e.CorrelationID)
+				require.JSONEq(t, string(expected.Payload), string(e.Payload))
+				require.True(t, expected.CreatedAt.Equal(e.CreatedAt), "%s != %s", expected.CreatedAt, e.CreatedAt)
+			}
+		})
+	}
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+
+		// Nobody reads from ch, so List can only return because of the
+		// cancellation.
+		ch := make(chan tonight.Event)
+		errc := make(chan error, 1)
+		go func() { errc <- eventStore.List(ctx, tonight.EventFilter{UserID: user.ID}, ch) }()
+		cancel()
+
+		select {
+		case err := <-errc:
+			require.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("List did not return after the context was cancelled")
+		}
+
+		_, open := <-ch
+		require.False(t, open, "channel should be closed")
+	})
+}
@@ -0,0 +1,216 @@
+package tonighttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestProjectStore(t *testing.T, projectStore tonight.ProjectStore, userStore tonight.UserStore) {
+	ctx := context.Background()
+
+	alice := newUser(t, userStore, "alice")
+	bob := newUser(t, userStore, "bob")
+	stranger := newUser(t, userStore, "stranger")
+
+	now := time.Now().Truncate(time.Second)
+	first := newProject(t, projectStore, alice, "first", now)
+	second := newProject(t, projectStore, alice, "second", now.Add(time.Second))
+	other := newProject(t, projectStore, bob, "other", now)
+
+	t.Run("backlog", func(t *testing.T) {
+		p, err := projectStore.Get(ctx, first.UUID, alice)
+		require.NoError(t, err)
+		require.Len(t, p.Releases, 1)
+
+		// The backlog shares the uuid of its project
+		backlog := p.Releases[0]
+		require.Equal(t, first.UUID, backlog.UUID)
+		require.Equal(t, "Backlog", backlog.Title)
+		require.Equal(t, first.UUID, backlog.Project.UUID)
+		require.Empty(t, backlog.Tasks)
+
+		// Updating the project does not create another backlog
+		p.Description = "described"
+		require.NoError(t, projectStore.Upsert(ctx, p, alice))
+		p, err = projectStore.Get(ctx, first.UUID, alice)
+		require.NoError(t, err)
+		require.Len(t, p.Releases, 1)
+		require.Equal(t, "described", p.Description)
+		first = p
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tests := map[string]struct {
+			user     tonight.User
+			expected []uuid.UUID
+		}{
+			"by creation date": {user: alice, expected: []uuid.UUID{first.UUID, second.UUID}},
+			"other user":       {user: bob, expected: []uuid.UUID{other.UUID}},
+			"no permission":    {user: stranger, expected: []uuid.UUID{}},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				projects, err := projectStore.List(ctx, test.user)
+				require.NoError(t, err)
+				require.NotNil(t, projects)
+
+				uuids := make([]uuid.UUID, len(projects))
+				for i, p := range projects {
+					uuids[i] = p.UUID
+					require.Len(t, p.Releases, 1)
+				}
+				require.Equal(t, test.expected, uuids)
+			})
+		}
+	})
+
+	t.Run("summaries", func(t *testing.T) {
+		tests := map[string]struct {
+			user     tonight.User
+			filter   tonight.ProjectFilter
+			expected []uuid.UUID
+		}{
+			"by creation date": {user: alice, filter: tonight.ProjectFilter{}, expected: []uuid.UUID{first.UUID, second.UUID}},
+			"limit":            {user: alice, filter: tonight.ProjectFilter{Limit: 1}, expected: []uuid.UUID{first.UUID}},
+			"after":            {user: alice, filter: tonight.ProjectFilter{After: first.UUID}, expected: []uuid.UUID{second.UUID}},
+			"after the last":   {user: alice, filter: tonight.ProjectFilter{After: second.UUID}, expected: []uuid.UUID{}},
+			"unknown cursor":   {user: alice, filter: tonight.ProjectFilter{After: uuid.NewV1()}, expected: []uuid.UUID{}},
+			"no permission":    {user: stranger, filter: tonight.ProjectFilter{}, expected: []uuid.UUID{}},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				summaries, err := projectStore.Summaries(ctx, test.user, test.filter)
+				require.NoError(t, err)
+				require.NotNil(t, summaries)
+
+				uuids := make([]uuid.UUID, len(summaries))
+				for i, summary := range summaries {
+					uuids[i] = summary.UUID
+					require.Len(t, summary.Releases, 1)
+					require.Equal(
+						t,
+						map[tonight.TaskStatus]int{tonight.TaskStatusTODO: 0, tonight.TaskStatusDONE: 0},
+						summary.TaskCounts,
+					)
+				}
+				require.Equal(t, test.expected, uuids)
+			})
+		}
+	})
+	t.Run("get and find", func(t *testing.T) {
+		tests := map[string]struct {
+			project tonight.Project
+			user    tonight.User
+			found   bool
+		}{
+			"owner":         {project: first, user: alice, found: true},
+			"other owner":   {project: other, user: bob, found: true},
+			"other project": {project: other, user: alice, found: false},
+			"no permission": {project: first, user: stranger, found: false},
+			"unknown": {
+				project: tonight.Project{UUID: uuid.NewV1(), Slug: "unknown"},
+				user:    alice,
+				found:   false,
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				byUUID, err := projectStore.Get(ctx, test.project.UUID, test.user)
+				if !test.found {
+					requireNotFound(t, err)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, test.project.Name, byUUID.Name)
+					require.Equal(t, test.project.Slug, byUUID.Slug)
+					require.Equal(t, test.project.Description, byUUID.Description)
+					require.Equal(t, test.project.Version, byUUID.Version)
+				}
+
+				bySlug, err := projectStore.Find(ctx, test.project.Slug, test.user)
+				if !test.found {
+					requireNotFound(t, err)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, test.project.UUID, bySlug.UUID)
+				}
+			})
+		}
+	})
+
+	t.Run("slugs", func(t *testing.T) {
+		tests := map[string]struct {
+			user     tonight.User
+			slugs    []string
+			expected []string
+		}{
+			"owner":         {user: alice, slugs: []string{first.Slug, second.Slug}, expected: []string{first.Slug, second.Slug}},
+			"other project": {user: alice, slugs: []string{first.Slug, other.Slug}, expected: []string{first.Slug}},
+			"unknown":       {user: alice, slugs: []string{"unknown", first.Slug, first.Slug}, expected: []string{first.Slug}},
+			"no permission": {user: stranger, slugs: []string{first.Slug}, expected: []string{}},
+			"none":          {user: alice, slugs: nil, expected: []string{}},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				slugs, err := projectStore.Slugs(ctx, test.slugs, test.user)
+				require.NoError(t, err)
+				require.NotNil(t, slugs)
+				require.ElementsMatch(t, test.expected, slugs)
+			})
+		}
+	})
+
+	t.Run("permission", func(t *testing.T) {
+		tests := map[string]struct {
+			user       tonight.User
+			project    tonight.Project
+			permission string
+		}{
+			"owner":         {user: alice, project: first, permission: "owner"},
+			"other project": {user: alice, project: other, permission: ""},
+			"no permission": {user: stranger, project: first, permission: ""},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				permission, err := userStore.Permission(ctx, test.user, test.project.UUID.String())
+				require.NoError(t, err)
+				require.Equal(t, test.permission, permission)
+			})
+		}
+	})
+
+	t.Run("slug uniqueness", func(t *testing.T) {
+		duplicate := tonight.Project{
+			UUID:      uuid.NewV1(),
+			Name:      "duplicate",
+			Slug:      first.Slug,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		requireConflict(t, projectStore.Upsert(ctx, duplicate, bob))
+		_, err := projectStore.Get(ctx, duplicate.UUID, bob)
+		requireNotFound(t, err)
+
+		// Nor can a project take the slug of another when renamed
+		renamed := second
+		renamed.Slug = first.Slug
+		requireConflict(t, projectStore.Upsert(ctx, renamed, alice))
+
+		p, err := projectStore.Find(ctx, first.Slug, alice)
+		require.NoError(t, err)
+		require.Equal(t, first.UUID, p.UUID)
+		p, err = projectStore.Get(ctx, second.UUID, alice)
+		require.NoError(t, err)
+		require.Equal(t, second.Slug, p.Slug)
+	})
+}
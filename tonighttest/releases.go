@@ -0,0 +1,134 @@
+package tonighttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestReleaseStore(
+	t *testing.T,
+	releaseStore tonight.ReleaseStore,
+	projectStore tonight.ProjectStore,
+	taskStore tonight.TaskStore,
+	userStore tonight.UserStore,
+) {
+	ctx := context.Background()
+
+	user := newUser(t, userStore, "releaseuser")
+	now := time.Now().Truncate(time.Second)
+	project := newProject(t, projectStore, user, "released", now)
+	otherProject := newProject(t, projectStore, user, "unreleased", now)
+
+	releases := make(map[string]tonight.Release)
+	for _, title := range []string{"v2", "v1"} {
+		release := tonight.Release{
+			UUID:        uuid.NewV1(),
+			Title:       title,
+			Description: "release " + title,
+			Project:     tonight.Project{UUID: project.UUID},
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		require.NoError(t, releaseStore.Upsert(ctx, release))
+		releases[title] = release
+	}
+
+	task := tonight.Task{
+		UUID:      uuid.NewV1(),
+		Title:     "released task",
+		Status:    tonight.TaskStatusTODO,
+		Release:   releases["v1"],
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, taskStore.Upsert(ctx, task))
+
+	t.Run("get", func(t *testing.T) {
+		release, err := releaseStore.Get(ctx, releases["v1"].UUID)
+		require.NoError(t, err)
+		require.Equal(t, "v1", release.Title)
+		require.Equal(t, "release v1", release.Description)
+		require.Equal(t, project.UUID, release.Project.UUID)
+		require.Equal(t, 1, release.Version)
+		require.Equal(t, []string{task.Title}, taskTitles(release.Tasks))
+
+		release, err = releaseStore.Get(ctx, releases["v2"].UUID)
+		require.NoError(t, err)
+		require.NotNil(t, release.Tasks)
+		require.Empty(t, release.Tasks)
+
+		_, err = releaseStore.Get(ctx, uuid.NewV1())
+		requireNotFound(t, err)
+	})
+
+	t.Run("head", func(t *testing.T) {
+		release, err := releaseStore.Head(ctx, releases["v1"].UUID)
+		require.NoError(t, err)
+		require.Equal(t, "v1", release.Title)
+		require.Equal(t, project.UUID, release.Project.UUID)
+		require.Equal(t, 1, release.Version)
+		require.NotNil(t, release.Tasks)
+		require.Empty(t, release.Tasks)
+
+		_, err = releaseStore.Head(ctx, uuid.NewV1())
+		requireNotFound(t, err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tests := map[string]struct {
+			projectUUID uuid.UUID
+			expected    []string
+			tasks       [][]string
+		}{
+			"backlog last": {
+				projectUUID: project.UUID,
+				expected:    []string{"v1", "v2", "Backlog"},
+				tasks:       [][]string{{task.Title}, {}, {}},
+			},
+			"backlog only": {
+				projectUUID: otherProject.UUID,
+				expected:    []string{"Backlog"},
+				tasks:       [][]string{{}},
+			},
+			"unknown project": {
+				projectUUID: uuid.NewV1(),
+				expected:    []string{},
+				tasks:       [][]string{},
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				list, err := releaseStore.List(ctx, test.projectUUID)
+				require.NoError(t, err)
+
+				titles := make([]string, len(list))
+				tasks := make([][]string, len(list))
+				for i, release := range list {
+					titles[i] = release.Title
+					tasks[i] = taskTitles(release.Tasks)
+				}
+				require.Equal(t, test.expected, titles)
+				require.Equal(t, test.tasks, tasks)
+			})
+		}
+	})
+
+	t.Run("project", func(t *testing.T) {
+		p, err := projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+
+		titles := make([]string, len(p.Releases))
+		for i, release := range p.Releases {
+			titles[i] = release.Title
+		}
+		require.Equal(t, []string{"v1", "v2", "Backlog"}, titles)
+		require.Equal(t, []string{task.Title}, taskTitles(p.Releases[0].Tasks))
+	})
+}
@@ -0,0 +1,69 @@
+package tonighttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestSnapshotStore(t *testing.T, snapshotStore tonight.SnapshotStore) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	taskUUID := uuid.NewV1()
+	start := time.Now().Truncate(time.Second)
+
+	_, err := snapshotStore.Latest(ctx, projectUUID, time.Time{})
+	require.True(t, errors.Is(err, tonight.ErrNoSnapshot), "expected no snapshot, got %v", err)
+
+	snapshot := func(events int, title string) tonight.Snapshot {
+		p := tonight.NewProjection()
+		p.Projects[projectUUID] = tonight.Project{UUID: projectUUID, Name: "project", Version: 1}
+		p.Tasks[taskUUID] = tonight.Task{UUID: taskUUID, Title: title, Status: tonight.TaskStatusTODO}
+		p.Ranks[taskUUID] = "i"
+		p.Permissions[projectUUID] = map[string]string{"user": "owner"}
+		return tonight.Snapshot{
+			ProjectUUID:    projectUUID,
+			EventUUID:      uuid.NewV1(),
+			EventCreatedAt: start.Add(time.Duration(events) * time.Second),
+			Events:         events,
+			Projection:     p,
+		}
+	}
+	first := snapshot(2, "task")
+	second := snapshot(5, "renamed")
+	require.NoError(t, snapshotStore.Store(ctx, second))
+	require.NoError(t, snapshotStore.Store(ctx, first))
+
+	tests := map[string]struct {
+		until    time.Time
+		expected tonight.Snapshot
+	}{
+		"latest":           {until: time.Time{}, expected: second},
+		"at the last":      {until: second.EventCreatedAt, expected: second},
+		"before the last":  {until: second.EventCreatedAt.Add(-time.Second), expected: first},
+		"at the first one": {until: first.EventCreatedAt, expected: first},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			snap, err := snapshotStore.Latest(ctx, projectUUID, test.until)
+			require.NoError(t, err)
+			require.Equal(t, test.expected.EventUUID, snap.EventUUID)
+			require.True(t, test.expected.EventCreatedAt.Equal(snap.EventCreatedAt))
+			require.Equal(t, test.expected.Events, snap.Events)
+			require.Empty(t, test.expected.Projection.Diff(snap.Projection))
+		})
+	}
+
+	_, err = snapshotStore.Latest(ctx, projectUUID, first.EventCreatedAt.Add(-time.Second))
+	require.True(t, errors.Is(err, tonight.ErrNoSnapshot), "expected no snapshot, got %v", err)
+
+	require.NoError(t, snapshotStore.Clear(ctx))
+	_, err = snapshotStore.Latest(ctx, projectUUID, time.Time{})
+	require.True(t, errors.Is(err, tonight.ErrNoSnapshot), "expected no snapshot, got %v", err)
+}
@@ -1,123 +1,88 @@
 package tonighttest
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
 
 	"github.com/bobinette/tonight"
 )
 
-func TestStores(
-	t *testing.T,
-	projectStore tonight.ProjectStore,
-	taskStore tonight.TaskStore,
-	userStore tonight.UserStore,
-) {
-	// ctx := context.Background()
-
-	// user := tonight.User{ID: "testuser"}
-	// require.NoError(t, userStore.Ensure(ctx, &user))
-
-	// project := tonight.Project{
-	// 	UUID:      uuid.NewV1(),
-	// 	Name:      "Test project",
-	// 	Slug:      "slug ",
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// }
-	// require.NoError(t, projectStore.Upsert(ctx, project, user))
-	// // Create another project to make sure it is retrieved as well
-	// require.NoError(t, projectStore.Upsert(ctx, tonight.Project{
-	// 	UUID:      uuid.NewV1(),
-	// 	Name:      "Test other project",
-	// 	Slug:      "slug other",
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// }, user))
-
-	// firstTask := tonight.Task{
-	// 	UUID:      uuid.NewV1(),
-	// 	Title:     "Test task",
-	// 	Status:    tonight.TaskStatusTODO,
-	// 	Project:   project,
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// }
-	// require.NoError(t, taskStore.Upsert(ctx, firstTask))
-
-	// otherTask := tonight.Task{
-	// 	UUID:      uuid.NewV1(),
-	// 	Title:     "Test task other",
-	// 	Status:    tonight.TaskStatusTODO,
-	// 	Project:   project,
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// }
-	// require.NoError(t, taskStore.Upsert(ctx, otherTask))
-
-	// ps, err := projectStore.List(ctx, user)
-	// require.NoError(t, err)
-	// require.Len(t, ps, 2)
-
-	// titles := make([]string, len(ps[0].Tasks))
-	// for i, task := range ps[0].Tasks {
-	// 	titles[i] = task.Title
-	// 	require.Equal(t, tonight.TaskStatusTODO, task.Status)
-	// }
-	// require.Equal(t, []string{firstTask.Title, otherTask.Title}, titles)
-
-	// anotherTask := tonight.Task{
-	// 	UUID:      uuid.NewV1(),
-	// 	Title:     "Another task",
-	// 	Status:    tonight.TaskStatusTODO,
-	// 	Project:   project,
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// }
-	// require.NoError(t, taskStore.Upsert(ctx, anotherTask))
-	// require.Equal(t, []string{firstTask.Title, otherTask.Title}, titles)
-
-	// lastTask := tonight.Task{
-	// 	UUID:      uuid.NewV1(),
-	// 	Title:     "Last task",
-	// 	Status:    tonight.TaskStatusTODO,
-	// 	Project:   project,
-	// 	CreatedAt: time.Now(),
-	// 	UpdatedAt: time.Now(),
-	// }
-	// require.NoError(t, taskStore.Upsert(ctx, lastTask))
-
-	// require.NoError(t, taskStore.Reorder(ctx, nil))
-	// rankedUUIDs := []uuid.UUID{
-	// 	otherTask.UUID,
-	// 	firstTask.UUID,
-	// }
-	// require.NoError(t, taskStore.Reorder(ctx, rankedUUIDs))
+// Stores are the stores of a backend. They must share their data, like
+// the tables of a database.
+type Stores struct {
+	Transactor    tonight.Transactor
+	EventStore    tonight.EventStore
+	ProjectStore  tonight.ProjectStore
+	ReleaseStore  tonight.ReleaseStore
+	TaskStore     tonight.TaskStore
+	UserStore     tonight.UserStore
+	SnapshotStore tonight.SnapshotStore
+	WebhookStore  tonight.WebhookStore
+	TrashStore    tonight.TrashStore
+}
 
-	// ps, err = projectStore.List(ctx, user)
-	// require.NoError(t, err)
-	// require.Len(t, ps, 2)
+// TestStores runs the whole conformance suite on the stores of a
+// backend. The data it creates belongs to users unique to the run, so
+// the stores do not need to be empty.
+func TestStores(t *testing.T, s Stores) {
+	t.Run("projects", func(t *testing.T) { TestProjectStore(t, s.ProjectStore, s.UserStore) })
+	t.Run("releases", func(t *testing.T) { TestReleaseStore(t, s.ReleaseStore, s.ProjectStore, s.TaskStore, s.UserStore) })
+	t.Run("tasks", func(t *testing.T) { TestTaskStore(t, s.TaskStore, s.ProjectStore, s.ReleaseStore, s.UserStore) })
+	t.Run("users", func(t *testing.T) { TestUserStore(t, s.UserStore) })
+	t.Run("events", func(t *testing.T) { TestEventStore(t, s.EventStore, s.UserStore) })
+	t.Run("transactor", func(t *testing.T) {
+		TestTransactor(t, s.Transactor, s.EventStore, s.ProjectStore, s.UserStore)
+	})
+	t.Run("versions", func(t *testing.T) {
+		TestVersions(t, s.ProjectStore, s.ReleaseStore, s.TaskStore, s.UserStore)
+	})
+	t.Run("snapshots", func(t *testing.T) { TestSnapshotStore(t, s.SnapshotStore) })
+	t.Run("webhooks", func(t *testing.T) { TestWebhookStore(t, s.WebhookStore, s.ProjectStore, s.UserStore) })
+	t.Run("trash", func(t *testing.T) {
+		TestTrashStore(t, s.TrashStore, s.ProjectStore, s.ReleaseStore, s.TaskStore, s.UserStore)
+	})
+}
 
-	// titles = make([]string, len(ps[0].Tasks))
-	// for i, task := range ps[0].Tasks {
-	// 	titles[i] = task.Title
-	// }
-	// require.Equal(t, []string{otherTask.Title, firstTask.Title, anotherTask.Title, lastTask.Title}, titles)
+// newUser ensures a user whose id, starting with prefix, is unique to
+// the run.
+func newUser(t *testing.T, userStore tonight.UserStore, prefix string) tonight.User {
+	user := tonight.User{ID: fmt.Sprintf("%s-%s", prefix, uuid.NewV4()), Name: prefix}
+	require.NoError(t, userStore.Ensure(context.Background(), &user))
+	return user
+}
 
-	// ps, err = projectStore.List(ctx, tonight.User{ID: "unkown"})
-	// require.NoError(t, err)
-	// require.Len(t, ps, 0)
+// newProject creates a project owned by user, with a unique slug.
+func newProject(t *testing.T, projectStore tonight.ProjectStore, user tonight.User, name string, createdAt time.Time) tonight.Project {
+	project := tonight.Project{
+		UUID:      uuid.NewV1(),
+		Name:      name,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+	project.Slug = fmt.Sprintf("%s-%s", name, project.UUID)
+	require.NoError(t, projectStore.Upsert(context.Background(), project, user))
+	project.Version = 1
+	return project
+}
 
-	// retrievedTask, err := taskStore.Get(ctx, firstTask.UUID, user)
-	// require.NoError(t, err)
-	// require.Equal(t, firstTask.Title, retrievedTask.Title)
-	// require.Equal(t, firstTask.Status, retrievedTask.Status)
+func requireNotFound(t *testing.T, err error) {
+	require.True(t, errors.Is(err, tonight.ErrNotFound), "expected not found, got %v", err)
+}
 
-	// lastTask.Title = "Updated title"
-	// lastTask.Status = tonight.TaskStatusDONE
-	// require.NoError(t, taskStore.Upsert(ctx, lastTask))
+func requireConflict(t *testing.T, err error) {
+	require.True(t, errors.Is(err, tonight.ErrConflict), "expected conflict, got %v", err)
+}
 
-	// retrievedTask, err = taskStore.Get(ctx, lastTask.UUID, user)
-	// require.NoError(t, err)
-	// require.Equal(t, lastTask.Title, retrievedTask.Title)
-	// require.Equal(t, lastTask.Status, retrievedTask.Status)
+func taskTitles(tasks []tonight.Task) []string {
+	titles := make([]string, len(tasks))
+	for i, task := range tasks {
+		titles[i] = task.Title
+	}
+	return titles
 }
@@ -0,0 +1,251 @@
+package tonighttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestTaskStore(
+	t *testing.T,
+	taskStore tonight.TaskStore,
+	projectStore tonight.ProjectStore,
+	releaseStore tonight.ReleaseStore,
+	userStore tonight.UserStore,
+) {
+	ctx := context.Background()
+
+	user := newUser(t, userStore, "taskuser")
+	otherUser := newUser(t, userStore, "othertaskuser")
+	now := time.Now().Truncate(time.Second)
+	project := newProject(t, projectStore, user, "tasks", now)
+	backlog := tonight.Release{UUID: project.UUID, Project: tonight.Project{UUID: project.UUID}}
+
+	tasks := make([]tonight.Task, 4)
+	for i := range tasks {
+		tasks[i] = tonight.Task{
+			UUID:      uuid.NewV1(),
+			Title:     string(rune('a' + i)),
+			Status:    tonight.TaskStatusTODO,
+			Release:   backlog,
+			CreatedAt: now.Add(time.Duration(i) * time.Second),
+			UpdatedAt: now.Add(time.Duration(i) * time.Second),
+		}
+	}
+	// Store them out of order, they are sorted by creation date
+	for _, i := range []int{2, 0, 3, 1} {
+		require.NoError(t, taskStore.Upsert(ctx, tasks[i]))
+	}
+
+	backlogTitles := func(t *testing.T) []string {
+		release, err := releaseStore.Get(ctx, backlog.UUID)
+		require.NoError(t, err)
+
+		p, err := projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+		require.Len(t, p.Releases, 1)
+		require.Equal(t, taskTitles(release.Tasks), taskTitles(p.Releases[0].Tasks))
+
+		return taskTitles(release.Tasks)
+	}
+
+	t.Run("get", func(t *testing.T) {
+		tests := map[string]struct {
+			uuid  uuid.UUID
+			user  tonight.User
+			found bool
+		}{
+			"owner":         {uuid: tasks[0].UUID, user: user, found: true},
+			"no permission": {uuid: tasks[0].UUID, user: otherUser, found: false},
+			"unknown":       {uuid: uuid.NewV1(), user: user, found: false},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				task, err := taskStore.Get(ctx, test.uuid, test.user)
+				if !test.found {
+					requireNotFound(t, err)
+					return
+				}
+
+				require.NoError(t, err)
+				require.Equal(t, tasks[0].Title, task.Title)
+				require.Equal(t, tasks[0].Status, task.Status)
+				require.Equal(t, backlog.UUID, task.Release.UUID)
+				require.Equal(t, 1, task.Version)
+			})
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		task := tasks[3]
+		task.Version = 1
+		task.Title = "d, done"
+		task.Status = tonight.TaskStatusDONE
+		require.NoError(t, taskStore.Upsert(ctx, task))
+
+		stored, err := taskStore.Get(ctx, task.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, "d, done", stored.Title)
+		require.Equal(t, tonight.TaskStatusDONE, stored.Status)
+		require.Equal(t, backlog.UUID, stored.Release.UUID)
+		tasks[3] = stored
+	})
+
+	t.Run("description", func(t *testing.T) {
+		task := tasks[1]
+		task.Version = 1
+		task.Description = "Steps:\n\n1. open\n2. **crash**"
+		require.NoError(t, taskStore.Upsert(ctx, task))
+
+		stored, err := taskStore.Get(ctx, task.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, task.Description, stored.Description)
+
+		listed, err := taskStore.List(ctx, backlog.UUID, tonight.TaskFilter{})
+		require.NoError(t, err)
+		descriptions := make(map[uuid.UUID]string)
+		for _, listedTask := range listed {
+			descriptions[listedTask.UUID] = listedTask.Description
+		}
+		require.Equal(t, task.Description, descriptions[task.UUID])
+		require.Equal(t, "", descriptions[tasks[0].UUID])
+
+		p, err := projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+		require.Len(t, p.Releases, 1)
+		for _, projectTask := range p.Releases[0].Tasks {
+			require.Equal(t, descriptions[projectTask.UUID], projectTask.Description)
+		}
+		tasks[1] = stored
+	})
+
+	// The ranks build on each other, they cannot run on their own
+	t.Run("rank", func(t *testing.T) {
+		steps := []struct {
+			name     string
+			ranks    map[int]string
+			expected []string
+		}{
+			{name: "unranked", ranks: nil, expected: []string{"a", "b", "c", "d, done"}},
+			{name: "ranked first", ranks: map[int]string{2: "i", 0: "r"}, expected: []string{"c", "a", "b", "d, done"}},
+			{
+				name:     "lexicographic order",
+				ranks:    map[int]string{0: "2", 1: "12", 2: "1i", 3: "0i"},
+				expected: []string{"d, done", "b", "c", "a"},
+			},
+			{name: "unranked again", ranks: map[int]string{3: ""}, expected: []string{"b", "c", "a", "d, done"}},
+		}
+
+		for _, step := range steps {
+			ranks := make(map[uuid.UUID]string, len(step.ranks))
+			for i, rank := range step.ranks {
+				ranks[tasks[i].UUID] = rank
+			}
+			require.NoError(t, taskStore.Rank(ctx, ranks), step.name)
+			require.Equal(t, step.expected, backlogTitles(t), step.name)
+		}
+
+		// Ranks are not versioned, the tasks can still be updated
+		task, err := taskStore.Get(ctx, tasks[0].UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, "2", task.Rank)
+		task.Title = "a, renamed"
+		require.NoError(t, taskStore.Upsert(ctx, task))
+		require.Equal(t, []string{"b", "c", "a, renamed", "d, done"}, backlogTitles(t))
+
+		task, err = taskStore.Get(ctx, tasks[3].UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, "", task.Rank)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		// The tasks are ranked b, c, a, and d is done, see above
+		tests := map[string]struct {
+			filter   tonight.TaskFilter
+			expected []string
+		}{
+			"all":                {filter: tonight.TaskFilter{}, expected: []string{"b", "c", "a, renamed", "d, done"}},
+			"todo":               {filter: tonight.TaskFilter{Statuses: []tonight.TaskStatus{tonight.TaskStatusTODO}}, expected: []string{"b", "c", "a, renamed"}},
+			"done":               {filter: tonight.TaskFilter{Statuses: []tonight.TaskStatus{tonight.TaskStatusDONE}}, expected: []string{"d, done"}},
+			"limit":              {filter: tonight.TaskFilter{Limit: 2}, expected: []string{"b", "c"}},
+			"after ranked task":  {filter: tonight.TaskFilter{After: tasks[2].UUID}, expected: []string{"a, renamed", "d, done"}},
+			"after and limit":    {filter: tonight.TaskFilter{After: tasks[1].UUID, Limit: 1}, expected: []string{"c"}},
+			"after the last one": {filter: tonight.TaskFilter{After: tasks[3].UUID}, expected: []string{}},
+			"after and status": {
+				filter:   tonight.TaskFilter{After: tasks[1].UUID, Statuses: []tonight.TaskStatus{tonight.TaskStatusDONE}},
+				expected: []string{"d, done"},
+			},
+			"unknown cursor": {filter: tonight.TaskFilter{After: uuid.NewV1()}, expected: []string{}},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				list, err := taskStore.List(ctx, backlog.UUID, test.filter)
+				require.NoError(t, err)
+				require.Equal(t, test.expected, taskTitles(list))
+			})
+		}
+
+		list, err := taskStore.List(ctx, uuid.NewV1(), tonight.TaskFilter{})
+		require.NoError(t, err)
+		require.NotNil(t, list)
+		require.Empty(t, list)
+	})
+
+	t.Run("summaries", func(t *testing.T) {
+		summaries, err := projectStore.Summaries(ctx, user, tonight.ProjectFilter{})
+		require.NoError(t, err)
+		require.Len(t, summaries, 1)
+		require.Equal(t, project.UUID, summaries[0].UUID)
+		require.Equal(
+			t,
+			map[tonight.TaskStatus]int{tonight.TaskStatusTODO: 3, tonight.TaskStatusDONE: 1},
+			summaries[0].TaskCounts,
+		)
+
+		// The releases are listed without their tasks
+		require.Len(t, summaries[0].Releases, 1)
+		require.Equal(t, backlog.UUID, summaries[0].Releases[0].UUID)
+		require.Nil(t, summaries[0].Releases[0].Tasks)
+	})
+
+	t.Run("move", func(t *testing.T) {
+		release := tonight.Release{
+			UUID:      uuid.NewV1(),
+			Title:     "v1",
+			Project:   tonight.Project{UUID: project.UUID},
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		require.NoError(t, releaseStore.Upsert(ctx, release))
+
+		// The task loses the rank it had in the backlog
+		task, err := taskStore.Get(ctx, tasks[1].UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, "12", task.Rank)
+		task.Release = release
+		require.NoError(t, taskStore.Upsert(ctx, task))
+
+		moved, err := taskStore.Get(ctx, task.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, release.UUID, moved.Release.UUID)
+		require.Equal(t, "", moved.Rank)
+		require.Equal(t, task.Version+1, moved.Version)
+
+		stored, err := releaseStore.Get(ctx, release.UUID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"b"}, taskTitles(stored.Tasks))
+		stored, err = releaseStore.Get(ctx, backlog.UUID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"c", "a, renamed", "d, done"}, taskTitles(stored.Tasks))
+
+		moved.Release = tonight.Release{UUID: uuid.NewV1()}
+		require.Error(t, taskStore.Upsert(ctx, moved))
+	})
+}
@@ -0,0 +1,94 @@
+package tonighttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestTransactor(
+	t *testing.T,
+	transactor tonight.Transactor,
+	eventStore tonight.EventStore,
+	projectStore tonight.ProjectStore,
+	userStore tonight.UserStore,
+) {
+	ctx := context.Background()
+
+	user := tonight.User{ID: fmt.Sprintf("txuser-%s", uuid.NewV4())}
+	require.NoError(t, userStore.Ensure(ctx, &user))
+
+	// createProject stores a project and its event in a transaction,
+	// returning fail from within the transaction.
+	createProject := func(fail error) (tonight.Project, error) {
+		id := uuid.NewV1()
+		now := time.Now().Truncate(time.Second)
+		project := tonight.Project{
+			UUID:      id,
+			Name:      "Transaction project",
+			Slug:      fmt.Sprintf("transaction-%s", id),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		evt := tonight.Event{
+			UUID:       id,
+			Type:       tonight.ProjectCreate,
+			EntityUUID: id,
+			UserID:     user.ID,
+			Payload:    []byte(`{"name":"Transaction project"}`),
+			CreatedAt:  now,
+		}
+
+		return project, transactor.Transaction(ctx, func(ctx context.Context) error {
+			if err := eventStore.Store(ctx, evt); err != nil {
+				return err
+			}
+			if err := projectStore.Upsert(ctx, project, user); err != nil {
+				return err
+			}
+			return fail
+		})
+	}
+
+	countEvents := func(entityUUID uuid.UUID) int {
+		ch := make(chan tonight.Event)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- eventStore.List(ctx, tonight.EventFilter{EntityUUIDs: []uuid.UUID{entityUUID}}, ch)
+		}()
+
+		n := 0
+		for range ch {
+			n++
+		}
+		require.NoError(t, <-errc)
+		return n
+	}
+
+	t.Run("commit", func(t *testing.T) {
+		project, err := createProject(nil)
+		require.NoError(t, err)
+
+		require.Equal(t, 1, countEvents(project.UUID))
+		retrieved, err := projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, project.Name, retrieved.Name)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		fail := errors.New("fail")
+		project, err := createProject(fail)
+		require.True(t, errors.Is(err, fail), "unexpected error %v", err)
+
+		require.Equal(t, 0, countEvents(project.UUID))
+		_, err = projectStore.Get(ctx, project.UUID, user)
+		require.Error(t, err)
+	})
+}
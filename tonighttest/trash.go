@@ -0,0 +1,175 @@
+package tonighttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestTrashStore(
+	t *testing.T,
+	trashStore tonight.TrashStore,
+	projectStore tonight.ProjectStore,
+	releaseStore tonight.ReleaseStore,
+	taskStore tonight.TaskStore,
+	userStore tonight.UserStore,
+) {
+	ctx := context.Background()
+
+	user := newUser(t, userStore, "trashuser")
+	otherUser := newUser(t, userStore, "othertrashuser")
+	now := time.Now().Truncate(time.Second)
+	project := newProject(t, projectStore, user, "trashed", now)
+
+	release := tonight.Release{
+		UUID:      uuid.NewV1(),
+		Title:     "v1",
+		Project:   tonight.Project{UUID: project.UUID},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, releaseStore.Upsert(ctx, release))
+
+	tasks := make(map[string]tonight.Task)
+	for _, title := range []string{"deleted", "kept"} {
+		task := tonight.Task{
+			UUID:      uuid.NewV1(),
+			Title:     title,
+			Status:    tonight.TaskStatusTODO,
+			Release:   release,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		require.NoError(t, taskStore.Upsert(ctx, task))
+		tasks[title] = task
+	}
+
+	// ours keeps the items of the run only, the stores may not be empty
+	ours := func(items []tonight.TrashItem) []uuid.UUID {
+		ids := make([]uuid.UUID, 0)
+		for _, item := range items {
+			if item.ProjectUUID == project.UUID {
+				ids = append(ids, item.UUID)
+			}
+		}
+		return ids
+	}
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, trashStore.Delete(ctx, tonight.TrashTask, tasks["deleted"].UUID, now.Add(-3*time.Hour)))
+		requireNotFound(t, trashStore.Delete(ctx, tonight.TrashTask, tasks["deleted"].UUID, now))
+		requireNotFound(t, trashStore.Delete(ctx, tonight.TrashTask, uuid.NewV1(), now))
+
+		_, err := taskStore.Get(ctx, tasks["deleted"].UUID, user)
+		requireNotFound(t, err)
+		list, err := taskStore.List(ctx, release.UUID, tonight.TaskFilter{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"kept"}, taskTitles(list))
+
+		require.NoError(t, trashStore.Delete(ctx, tonight.TrashRelease, release.UUID, now.Add(-2*time.Hour)))
+
+		// The tasks of a deleted release are hidden with it
+		_, err = releaseStore.Get(ctx, release.UUID)
+		requireNotFound(t, err)
+		_, err = taskStore.Get(ctx, tasks["kept"].UUID, user)
+		requireNotFound(t, err)
+
+		p, err := projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+		require.Len(t, p.Releases, 1)
+		require.Equal(t, project.UUID, p.Releases[0].UUID)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		items, err := trashStore.List(ctx, user)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+
+		require.Equal(t, tonight.TrashRelease, items[0].Kind)
+		require.Equal(t, release.UUID, items[0].UUID)
+		require.Equal(t, "v1", items[0].Title)
+		require.Equal(t, project.UUID, items[0].ProjectUUID)
+		require.Equal(t, uuid.Nil, items[0].ReleaseUUID)
+		require.True(t, now.Add(-2*time.Hour).Equal(items[0].DeletedAt))
+
+		require.Equal(t, tonight.TrashTask, items[1].Kind)
+		require.Equal(t, tasks["deleted"].UUID, items[1].UUID)
+		require.Equal(t, "deleted", items[1].Title)
+		require.Equal(t, project.UUID, items[1].ProjectUUID)
+		require.Equal(t, release.UUID, items[1].ReleaseUUID)
+
+		items, err = trashStore.List(ctx, otherUser)
+		require.NoError(t, err)
+		require.Empty(t, items)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		items, err := trashStore.Expired(ctx, now.Add(-150*time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{tasks["deleted"].UUID}, ours(items))
+
+		items, err = trashStore.Expired(ctx, now)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{tasks["deleted"].UUID, release.UUID}, ours(items))
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		require.NoError(t, trashStore.Restore(ctx, tonight.TrashRelease, release.UUID))
+		requireNotFound(t, trashStore.Restore(ctx, tonight.TrashRelease, release.UUID))
+
+		r, err := releaseStore.Get(ctx, release.UUID)
+		require.NoError(t, err)
+		require.Equal(t, []string{"kept"}, taskTitles(r.Tasks))
+		_, err = taskStore.Get(ctx, tasks["deleted"].UUID, user)
+		requireNotFound(t, err)
+	})
+
+	t.Run("project", func(t *testing.T) {
+		require.NoError(t, trashStore.Delete(ctx, tonight.TrashProject, project.UUID, now.Add(-time.Hour)))
+
+		_, err := projectStore.Get(ctx, project.UUID, user)
+		requireNotFound(t, err)
+		_, err = projectStore.Find(ctx, project.Slug, user)
+		requireNotFound(t, err)
+		projects, err := projectStore.List(ctx, user)
+		require.NoError(t, err)
+		require.Empty(t, projects)
+
+		_, err = releaseStore.Get(ctx, release.UUID)
+		requireNotFound(t, err)
+		releases, err := releaseStore.List(ctx, project.UUID)
+		require.NoError(t, err)
+		require.Empty(t, releases)
+		_, err = taskStore.Get(ctx, tasks["kept"].UUID, user)
+		requireNotFound(t, err)
+
+		items, err := trashStore.List(ctx, user)
+		require.NoError(t, err)
+		require.Equal(t, []uuid.UUID{project.UUID, tasks["deleted"].UUID}, ours(items))
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		requireNotFound(t, trashStore.Purge(ctx, tonight.TrashTask, tasks["kept"].UUID))
+		require.NoError(t, trashStore.Purge(ctx, tonight.TrashTask, tasks["deleted"].UUID))
+		requireNotFound(t, trashStore.Purge(ctx, tonight.TrashTask, tasks["deleted"].UUID))
+
+		require.NoError(t, trashStore.Purge(ctx, tonight.TrashProject, project.UUID))
+		requireNotFound(t, trashStore.Restore(ctx, tonight.TrashProject, project.UUID))
+
+		items, err := trashStore.List(ctx, user)
+		require.NoError(t, err)
+		require.Empty(t, items)
+
+		// Purging the project purged everything it contained
+		perm, err := userStore.Permission(ctx, user, project.UUID.String())
+		require.NoError(t, err)
+		require.Equal(t, "", perm)
+		requireNotFound(t, trashStore.Delete(ctx, tonight.TrashRelease, release.UUID, now))
+		requireNotFound(t, trashStore.Delete(ctx, tonight.TrashTask, tasks["kept"].UUID, now))
+	})
+}
@@ -0,0 +1,29 @@
+package tonighttest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestUserStore(t *testing.T, userStore tonight.UserStore) {
+	ctx := context.Background()
+
+	alice := tonight.User{ID: fmt.Sprintf("alice-%s", uuid.NewV4()), Name: "Alice"}
+	require.NoError(t, userStore.Ensure(ctx, &alice))
+	bob := tonight.User{ID: fmt.Sprintf("bob-%s", uuid.NewV4()), Name: "Bob"}
+	require.NoError(t, userStore.Ensure(ctx, &bob))
+
+	users, err := userStore.List(ctx, []string{bob.ID, "unknown", alice.ID})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []tonight.User{alice, bob}, users)
+
+	users, err = userStore.List(ctx, nil)
+	require.NoError(t, err)
+	require.Empty(t, users)
+}
@@ -0,0 +1,114 @@
+package tonighttest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestVersions(
+	t *testing.T,
+	projectStore tonight.ProjectStore,
+	releaseStore tonight.ReleaseStore,
+	taskStore tonight.TaskStore,
+	userStore tonight.UserStore,
+) {
+	ctx := context.Background()
+
+	user := tonight.User{ID: fmt.Sprintf("versionuser-%s", uuid.NewV4())}
+	require.NoError(t, userStore.Ensure(ctx, &user))
+
+	requireConflict := func(t *testing.T, err error) {
+		require.True(t, errors.Is(err, tonight.ErrVersionConflict), "expected a version conflict, got %v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	project := tonight.Project{
+		UUID:      uuid.NewV1(),
+		Name:      "Versioned project",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	project.Slug = fmt.Sprintf("versioned-%s", project.UUID)
+
+	t.Run("project", func(t *testing.T) {
+		require.NoError(t, projectStore.Upsert(ctx, project, user))
+		requireConflict(t, projectStore.Upsert(ctx, project, user))
+
+		stored, err := projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, 1, stored.Version)
+
+		stored.Name = "Renamed project"
+		require.NoError(t, projectStore.Upsert(ctx, stored, user))
+		// stored.Version is still 1, which is not current anymore
+		stored.Name = "Stale project"
+		requireConflict(t, projectStore.Upsert(ctx, stored, user))
+
+		stored, err = projectStore.Get(ctx, project.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, 2, stored.Version)
+		require.Equal(t, "Renamed project", stored.Name)
+	})
+
+	release := tonight.Release{
+		UUID:      uuid.NewV1(),
+		Title:     "v1",
+		Project:   tonight.Project{UUID: project.UUID},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	t.Run("release", func(t *testing.T) {
+		require.NoError(t, releaseStore.Upsert(ctx, release))
+		requireConflict(t, releaseStore.Upsert(ctx, release))
+
+		stored, err := releaseStore.Get(ctx, release.UUID)
+		require.NoError(t, err)
+		require.Equal(t, 1, stored.Version)
+
+		stored.Title = "v1.0"
+		require.NoError(t, releaseStore.Upsert(ctx, stored))
+		requireConflict(t, releaseStore.Upsert(ctx, stored))
+
+		stored, err = releaseStore.Get(ctx, release.UUID)
+		require.NoError(t, err)
+		require.Equal(t, 2, stored.Version)
+		require.Equal(t, "v1.0", stored.Title)
+	})
+
+	t.Run("task", func(t *testing.T) {
+		task := tonight.Task{
+			UUID:      uuid.NewV1(),
+			Title:     "Versioned task",
+			Status:    tonight.TaskStatusTODO,
+			Release:   release,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		require.NoError(t, taskStore.Upsert(ctx, task))
+		requireConflict(t, taskStore.Upsert(ctx, task))
+
+		stored, err := taskStore.Get(ctx, task.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, 1, stored.Version)
+
+		stored.Status = tonight.TaskStatusDONE
+		require.NoError(t, taskStore.Upsert(ctx, stored))
+		stored.Title = "Stale title"
+		requireConflict(t, taskStore.Upsert(ctx, stored))
+
+		stored, err = taskStore.Get(ctx, task.UUID, user)
+		require.NoError(t, err)
+		require.Equal(t, 2, stored.Version)
+		require.Equal(t, "Versioned task", stored.Title)
+		require.Equal(t, tonight.TaskStatusDONE, stored.Status)
+	})
+}
@@ -0,0 +1,152 @@
+package tonighttest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bobinette/tonight"
+)
+
+func TestWebhookStore(
+	t *testing.T,
+	webhookStore tonight.WebhookStore,
+	projectStore tonight.ProjectStore,
+	userStore tonight.UserStore,
+) {
+	ctx := context.Background()
+
+	user := tonight.User{ID: fmt.Sprintf("webhookuser-%s", uuid.NewV4())}
+	require.NoError(t, userStore.Ensure(ctx, &user))
+
+	now := time.Now().Truncate(time.Second)
+	project := tonight.Project{
+		UUID:      uuid.NewV1(),
+		Name:      "Webhook project",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	project.Slug = fmt.Sprintf("webhook-%s", project.UUID)
+	require.NoError(t, projectStore.Upsert(ctx, project, user))
+
+	webhook := tonight.Webhook{
+		UUID:        uuid.NewV1(),
+		ProjectUUID: project.UUID,
+		URL:         "https://example.com/hook",
+		Secret:      "secret",
+		Types:       []tonight.EventType{tonight.TaskDone},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	t.Run("webhooks", func(t *testing.T) {
+		require.NoError(t, webhookStore.Upsert(ctx, webhook))
+
+		webhook.URL = "https://example.com/other"
+		webhook.Types = nil
+		require.NoError(t, webhookStore.Upsert(ctx, webhook))
+
+		stored, err := webhookStore.Get(ctx, webhook.UUID)
+		require.NoError(t, err)
+		require.Equal(t, webhook.URL, stored.URL)
+		require.Equal(t, webhook.Secret, stored.Secret)
+		require.Empty(t, stored.Types)
+
+		webhooks, err := webhookStore.List(ctx, project.UUID)
+		require.NoError(t, err)
+		require.Len(t, webhooks, 1)
+		require.Equal(t, webhook.UUID, webhooks[0].UUID)
+	})
+
+	event := tonight.Event{
+		UUID:        uuid.NewV1(),
+		Type:        tonight.TaskDone,
+		EntityUUID:  uuid.NewV1(),
+		ProjectUUID: project.UUID,
+		UserID:      user.ID,
+		Payload:     []byte(`{}`),
+		CreatedAt:   now,
+	}
+
+	t.Run("queue", func(t *testing.T) {
+		first := tonight.QueuedDelivery{
+			UUID:          uuid.NewV1(),
+			WebhookUUID:   webhook.UUID,
+			Event:         event,
+			Attempt:       1,
+			NextAttemptAt: now,
+		}
+		second := first
+		second.UUID = uuid.NewV1()
+		second.NextAttemptAt = now.Add(time.Minute)
+		require.NoError(t, webhookStore.Enqueue(ctx, second))
+		require.NoError(t, webhookStore.Enqueue(ctx, first))
+
+		due, err := webhookStore.Due(ctx, now, 10)
+		require.NoError(t, err)
+		require.Len(t, due, 1)
+		require.Equal(t, first.UUID, due[0].UUID)
+		require.Equal(t, event.UUID, due[0].Event.UUID)
+		require.JSONEq(t, string(event.Payload), string(due[0].Event.Payload))
+
+		// Rescheduling updates the delivery
+		first.Attempt = 2
+		first.NextAttemptAt = now.Add(2 * time.Minute)
+		require.NoError(t, webhookStore.Enqueue(ctx, first))
+
+		due, err = webhookStore.Due(ctx, now.Add(2*time.Minute), 10)
+		require.NoError(t, err)
+		require.Len(t, due, 2)
+		require.Equal(t, second.UUID, due[0].UUID)
+		require.Equal(t, first.UUID, due[1].UUID)
+		require.Equal(t, 2, due[1].Attempt)
+
+		require.NoError(t, webhookStore.Dequeue(ctx, first.UUID))
+		require.NoError(t, webhookStore.Dequeue(ctx, second.UUID))
+		due, err = webhookStore.Due(ctx, now.Add(time.Hour), 10)
+		require.NoError(t, err)
+		require.Empty(t, due)
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		for attempt := 1; attempt <= 3; attempt++ {
+			require.NoError(t, webhookStore.LogDelivery(ctx, tonight.WebhookDelivery{
+				UUID:        uuid.NewV1(),
+				WebhookUUID: webhook.UUID,
+				EventUUID:   event.UUID,
+				EventType:   event.Type,
+				Attempt:     attempt,
+				StatusCode:  500,
+				Error:       "unexpected status",
+				CreatedAt:   now.Add(time.Duration(attempt) * time.Second),
+			}))
+		}
+
+		deliveries, err := webhookStore.Deliveries(ctx, webhook.UUID, 2)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		require.Equal(t, 3, deliveries[0].Attempt)
+		require.Equal(t, 2, deliveries[1].Attempt)
+		require.Equal(t, 500, deliveries[0].StatusCode)
+		require.Equal(t, event.UUID, deliveries[0].EventUUID)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, webhookStore.Delete(ctx, webhook.UUID))
+
+		_, err := webhookStore.Get(ctx, webhook.UUID)
+		requireNotFound(t, err)
+
+		webhooks, err := webhookStore.List(ctx, project.UUID)
+		require.NoError(t, err)
+		require.Empty(t, webhooks)
+
+		deliveries, err := webhookStore.Deliveries(ctx, webhook.UUID, 10)
+		require.NoError(t, err)
+		require.Empty(t, deliveries)
+	})
+}
@@ -0,0 +1,16 @@
+package tonight
+
+import (
+	"context"
+)
+
+// A Transactor runs functions in a transaction shared by the stores
+// of a backend. The stores called with the context given to f take
+// part in the transaction, which is committed if f returns nil and
+// rolled back otherwise.
+//
+// It is used to store an event and apply it to the other stores
+// atomically.
+type Transactor interface {
+	Transaction(ctx context.Context, f func(ctx context.Context) error) error
+}
@@ -0,0 +1,351 @@
+package tonight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A TrashKind is the kind of the entities that can be deleted.
+type TrashKind string
+
+const (
+	TrashTask    TrashKind = "task"
+	TrashRelease TrashKind = "release"
+	TrashProject TrashKind = "project"
+)
+
+// trashEvents are the types of the events recorded when an entity of
+// each kind is deleted, restored and purged.
+var trashEvents = map[TrashKind]struct{ delete, restore, purge EventType }{
+	TrashTask:    {delete: TaskDelete, restore: TaskRestore, purge: TaskPurge},
+	TrashRelease: {delete: ReleaseDelete, restore: ReleaseRestore, purge: ReleasePurge},
+	TrashProject: {delete: ProjectDelete, restore: ProjectRestore, purge: ProjectPurge},
+}
+
+// A TrashItem is a deleted task, release or project.
+type TrashItem struct {
+	Kind TrashKind `json:"kind"`
+	UUID uuid.UUID `json:"uuid"`
+	// Title of the task or release, name of the project
+	Title string `json:"title"`
+
+	ProjectUUID uuid.UUID `json:"project_uuid"`
+	// ReleaseUUID is the release of a task, uuid.Nil for the other
+	// kinds
+	ReleaseUUID uuid.UUID `json:"release_uuid"`
+
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// A TrashStore soft deletes tasks, releases and projects. The other
+// stores leave out the deleted entities and everything they contain,
+// until they are restored. Purging an entity deletes it for good, with
+// everything it contains.
+type TrashStore interface {
+	// Delete moves the entity to the trash, or returns ErrNotFound if
+	// it does not exist or is already in the trash.
+	Delete(ctx context.Context, kind TrashKind, id uuid.UUID, at time.Time) error
+
+	// Restore takes the entity out of the trash, or returns
+	// ErrNotFound if it is not in the trash.
+	Restore(ctx context.Context, kind TrashKind, id uuid.UUID) error
+
+	// List the entities in the trash of the projects the user has a
+	// permission on, the most recently deleted first.
+	List(ctx context.Context, u User) ([]TrashItem, error)
+
+	// Expired lists the entities deleted before the given date, the
+	// oldest first.
+	Expired(ctx context.Context, before time.Time) ([]TrashItem, error)
+
+	// Purge deletes the entity in the trash for good, or returns
+	// ErrNotFound if it is not in the trash.
+	Purge(ctx context.Context, kind TrashKind, id uuid.UUID) error
+}
+
+type trashService struct {
+	bus          *EventBus
+	transactor   Transactor
+	eventStore   EventStore
+	store        TrashStore
+	taskStore    TaskStore
+	releaseStore ReleaseStore
+	projectStore ProjectStore
+	userStore    UserStore
+}
+
+func (s trashService) deleteTask(c echo.Context) error {
+	id, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	task, err := s.taskStore.Get(ctx, id, user)
+	if err != nil {
+		return err
+	}
+	release, err := s.releaseStore.Get(ctx, task.Release.UUID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkOwner(ctx, user, release.Project.UUID); err != nil {
+		return err
+	}
+
+	return s.delete(c, user, TrashItem{
+		Kind:        TrashTask,
+		UUID:        task.UUID,
+		Title:       task.Title,
+		ProjectUUID: release.Project.UUID,
+		ReleaseUUID: release.UUID,
+	})
+}
+
+func (s trashService) deleteRelease(c echo.Context) error {
+	projectUUID, err := uuidParam(c, "project_uuid")
+	if err != nil {
+		return err
+	}
+	releaseUUID, err := uuidParam(c, "release_uuid")
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	if err := s.checkOwner(ctx, user, projectUUID); err != nil {
+		return err
+	}
+
+	release, err := s.releaseStore.Get(ctx, releaseUUID)
+	if err != nil {
+		return err
+	}
+	if release.Project.UUID != projectUUID {
+		return fmt.Errorf("release %s: %w", releaseUUID, ErrNotFound)
+	}
+	// The backlog goes away with its project only
+	if release.UUID == projectUUID {
+		return invalid("release_uuid", "is the backlog of the project, it cannot be deleted")
+	}
+
+	return s.delete(c, user, TrashItem{
+		Kind:        TrashRelease,
+		UUID:        release.UUID,
+		Title:       release.Title,
+		ProjectUUID: projectUUID,
+	})
+}
+
+func (s trashService) deleteProject(c echo.Context) error {
+	id, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	project, err := s.projectStore.Get(ctx, id, user)
+	if err != nil {
+		return err
+	}
+	if err := s.checkOwner(ctx, user, project.UUID); err != nil {
+		return err
+	}
+
+	return s.delete(c, user, TrashItem{
+		Kind:        TrashProject,
+		UUID:        project.UUID,
+		Title:       project.Name,
+		ProjectUUID: project.UUID,
+	})
+}
+
+// delete moves item to the trash, recording the event of its kind.
+func (s trashService) delete(c echo.Context, user User, item TrashItem) error {
+	ctx := c.Request().Context()
+
+	now := time.Now()
+	evt := Event{
+		UUID:        uuid.NewV1(),
+		Type:        trashEvents[item.Kind].delete,
+		EntityUUID:  item.UUID,
+		ProjectUUID: item.ProjectUUID,
+		UserID:      user.ID,
+		Payload:     []byte(`{}`),
+		CreatedAt:   now,
+	}
+	err := s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		if err := s.store.Delete(ctx, item.Kind, item.UUID, now); err != nil {
+			return fmt.Errorf("error deleting %s: %w", item.Kind, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	publish(c, s.bus, evt)
+
+	item.DeletedAt = now
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": item,
+	})
+}
+
+func (s trashService) list(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	items, err := s.store.List(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": items,
+	})
+}
+
+func (s trashService) restore(c echo.Context) error {
+	id, err := uuidParam(c, "uuid")
+	if err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	items, err := s.store.List(ctx, user)
+	if err != nil {
+		return err
+	}
+	var item TrashItem
+	for _, it := range items {
+		if it.UUID == id {
+			item = it
+		}
+	}
+	if item.UUID != id {
+		return fmt.Errorf("%s in the trash: %w", id, ErrNotFound)
+	}
+
+	if err := s.checkOwner(ctx, user, item.ProjectUUID); err != nil {
+		return err
+	}
+
+	// What contains the entity must be restored first, or the entity
+	// would stay hidden
+	switch item.Kind {
+	case TrashTask:
+		_, err = s.releaseStore.Get(ctx, item.ReleaseUUID)
+	case TrashRelease:
+		_, err = s.projectStore.Get(ctx, item.ProjectUUID, user)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("the %s of %s %s is in the trash: %w", containerOf(item.Kind), item.Kind, id, ErrConflict)
+	}
+	if err != nil {
+		return err
+	}
+
+	evt := Event{
+		UUID:        uuid.NewV1(),
+		Type:        trashEvents[item.Kind].restore,
+		EntityUUID:  item.UUID,
+		ProjectUUID: item.ProjectUUID,
+		UserID:      user.ID,
+		Payload:     []byte(`{}`),
+		CreatedAt:   time.Now(),
+	}
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		if err := s.store.Restore(ctx, item.Kind, item.UUID); err != nil {
+			return fmt.Errorf("error restoring %s: %w", item.Kind, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	publish(c, s.bus, evt)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": item,
+	})
+}
+
+func containerOf(kind TrashKind) TrashKind {
+	if kind == TrashTask {
+		return TrashRelease
+	}
+	return TrashProject
+}
+
+// checkOwner returns ErrForbidden unless user owns the project.
+func (s trashService) checkOwner(ctx context.Context, user User, projectUUID uuid.UUID) error {
+	perm, err := s.userStore.Permission(ctx, user, projectUUID.String())
+	if err != nil {
+		return err
+	}
+	if perm != "owner" {
+		return ErrForbidden
+	}
+	return nil
+}
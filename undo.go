@@ -0,0 +1,516 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// undoableTypes are the types of the events users can undo.
+var undoableTypes = []EventType{TaskUpdate, TaskDone, TaskMove, ProjectReorderTasks, ReleaseRebalanceTasks}
+
+// undoPayload is the payload of Undo and Redo events. Event is the
+// compensating event, applied to the entity of the Undo or Redo event.
+type undoPayload struct {
+	EventUUID uuid.UUID `json:"event_uuid"`
+	Event     struct {
+		Type    EventType       `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	} `json:"event"`
+}
+
+// undoStacks returns the events of the user that can be undone and
+// redone, the most recent last.
+func undoStacks(ctx context.Context, store EventStore, userID string) ([]Event, []Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- store.List(ctx, EventFilter{
+			UserID: userID,
+			Types:  append([]EventType{Undo, Redo}, undoableTypes...),
+		}, ch)
+	}()
+
+	undoStack := make([]Event, 0)
+	redoStack := make([]Event, 0)
+	var err error
+	for e := range ch {
+		if err != nil {
+			continue
+		}
+
+		switch e.Type {
+		case Undo, Redo:
+			var payload undoPayload
+			if err = json.Unmarshal(e.Payload, &payload); err != nil {
+				err = fmt.Errorf("error decoding event %s: %w", e.UUID, err)
+				continue
+			}
+
+			var target Event
+			if e.Type == Undo {
+				undoStack, target = removeEvent(undoStack, payload.EventUUID)
+				redoStack = append(redoStack, target)
+			} else {
+				redoStack, target = removeEvent(redoStack, payload.EventUUID)
+				undoStack = append(undoStack, target)
+			}
+
+		default:
+			// The rank events of a request, a move and the rebalance
+			// it caused, are a single action
+			if n := len(undoStack); n > 0 && sameMove(undoStack[n-1], e) {
+				continue
+			}
+			undoStack = append(undoStack, e)
+			// A new action makes what was undone impossible to redo
+			redoStack = redoStack[:0]
+		}
+	}
+	if listErr := <-errc; listErr != nil {
+		return nil, nil, listErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return undoStack, redoStack, nil
+}
+
+// rankEvent returns whether e ranks tasks of a release.
+func rankEvent(e Event) bool {
+	return e.Type == TaskMove || e.Type == ReleaseRebalanceTasks
+}
+
+// sameMove returns whether a and b are the rank events of the same
+// request.
+func sameMove(a, b Event) bool {
+	return rankEvent(a) && rankEvent(b) && a.CorrelationID != uuid.Nil && a.CorrelationID == b.CorrelationID
+}
+
+func removeEvent(events []Event, id uuid.UUID) ([]Event, Event) {
+	for i, e := range events {
+		if e.UUID == id {
+			return append(events[:i:i], events[i+1:]...), e
+		}
+	}
+	return events, Event{UUID: id}
+}
+
+// changesOf returns the changes made by e to its entity.
+func changesOf(ctx context.Context, store EventStore, e Event) (map[string]FieldChange, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- store.List(ctx, EventFilter{EntityUUIDs: []uuid.UUID{e.EntityUUID}}, ch)
+	}()
+
+	p := NewProjection()
+	kind := entityKind(e)
+	var changes []FieldChange
+	var err error
+	for evt := range ch {
+		if err != nil || changes != nil {
+			continue
+		}
+
+		before := p.fields(kind, e.EntityUUID)
+		if err = p.Apply(evt); err != nil {
+			err = fmt.Errorf("error applying event %s: %w", evt.UUID, err)
+			continue
+		}
+		if evt.UUID == e.UUID {
+			changes = diffFields(before, p.fields(kind, e.EntityUUID))
+		}
+	}
+	if listErr := <-errc; listErr != nil {
+		return nil, listErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		return nil, fmt.Errorf("event %s: %w", e.UUID, ErrNotFound)
+	}
+
+	byField := make(map[string]FieldChange, len(changes))
+	for _, change := range changes {
+		byField[change.Field] = change
+	}
+	return byField, nil
+}
+
+func (s service) undo(c echo.Context) error {
+	return s.undoOrRedo(c, Undo)
+}
+
+func (s service) redo(c echo.Context) error {
+	return s.undoOrRedo(c, Redo)
+}
+
+// undoOrRedo records and applies a compensating event for the last
+// action of the user, or the last one undone. Only the fields the
+// action changed are restored, so that the modifications made since
+// by other users are kept.
+func (s service) undoOrRedo(c echo.Context, typ EventType) error {
+	ctx := c.Request().Context()
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return err
+	}
+	if err := s.userStore.Ensure(ctx, &user); err != nil {
+		return fmt.Errorf("error ensuring user: %w", err)
+	}
+
+	undoStack, redoStack, err := undoStacks(ctx, s.eventStore, user.ID)
+	if err != nil {
+		return err
+	}
+
+	stack := undoStack
+	if typ == Redo {
+		stack = redoStack
+	}
+	if len(stack) == 0 {
+		return fmt.Errorf("nothing to %s: %w", strings.ToLower(string(typ)), ErrNotFound)
+	}
+	target := stack[len(stack)-1]
+
+	changes, err := changesOf(ctx, s.eventStore, target)
+	if err != nil {
+		return err
+	}
+
+	// value returns what field should be set to
+	value := func(field string) (interface{}, bool) {
+		change, ok := changes[field]
+		if !ok {
+			return nil, false
+		}
+		if typ == Undo {
+			return change.From, true
+		}
+		return change.To, true
+	}
+
+	var evt Event
+	switch target.Type {
+	case TaskUpdate, TaskDone:
+		evt, err = s.compensateTask(ctx, user, typ, target, value)
+	case ProjectReorderTasks:
+		evt, err = s.compensateRanks(ctx, user, typ, target, changes["ranks"])
+	case TaskMove, ReleaseRebalanceTasks:
+		evt, err = s.compensateMove(ctx, user, typ, target)
+	default:
+		err = fmt.Errorf("cannot %s %s", strings.ToLower(string(typ)), target.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	publish(c, s.bus, evt)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": evt,
+	})
+}
+
+func (s service) compensateTask(
+	ctx context.Context,
+	user User,
+	typ EventType,
+	target Event,
+	value func(field string) (interface{}, bool),
+) (Event, error) {
+	task, err := s.taskStore.Get(ctx, target.EntityUUID, user)
+	if err != nil {
+		return Event{}, fmt.Errorf("error retrieving task: %w", err)
+	}
+
+	release, err := s.releaseStore.Get(ctx, task.Release.UUID)
+	if err != nil {
+		return Event{}, err
+	}
+
+	if title, ok := value("title"); ok {
+		task.Title = title.(string)
+	}
+	if status, ok := value("status"); ok {
+		task.Status = status.(TaskStatus)
+	}
+	if description, ok := value("description"); ok {
+		// nil when the task had no description
+		task.Description, _ = description.(string)
+	}
+
+	compensation, err := json.Marshal(map[string]interface{}{
+		"uuid":        task.UUID,
+		"title":       task.Title,
+		"description": task.Description,
+		"status":      task.Status,
+	})
+	if err != nil {
+		return Event{}, err
+	}
+
+	evt, err := newUndoEvent(typ, target, task.UUID, release.Project.UUID, user, TaskUpdate, compensation)
+	if err != nil {
+		return Event{}, err
+	}
+
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		task.UpdatedAt = evt.CreatedAt
+		if err := s.taskStore.Upsert(ctx, task); err != nil {
+			return fmt.Errorf("error updating task: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Event{}, err
+	}
+
+	return evt, nil
+}
+
+func (s service) compensateRanks(
+	ctx context.Context,
+	user User,
+	typ EventType,
+	target Event,
+	change FieldChange,
+) (Event, error) {
+	perm, err := s.userStore.Permission(ctx, user, target.EntityUUID.String())
+	if err != nil {
+		return Event{}, err
+	}
+	if perm != "owner" {
+		return Event{}, ErrForbidden
+	}
+
+	project, err := s.projectStore.Get(ctx, target.EntityUUID, user)
+	if err != nil {
+		return Event{}, err
+	}
+
+	before, _ := change.From.([]uuid.UUID)
+	after, _ := change.To.([]uuid.UUID)
+	ranks := after
+	if typ == Undo {
+		// Ranks cannot be removed, tasks ranked for the first time keep
+		// their relative order after the others.
+		ranks = append([]uuid.UUID{}, before...)
+		for _, id := range after {
+			if !uuidIn(id, before) {
+				ranks = append(ranks, id)
+			}
+		}
+	}
+
+	compensation, err := json.Marshal(map[string]interface{}{"ranks": ranks})
+	if err != nil {
+		return Event{}, err
+	}
+
+	evt, err := newUndoEvent(typ, target, project.UUID, project.UUID, user, ProjectReorderTasks, compensation)
+	if err != nil {
+		return Event{}, err
+	}
+
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		legacyRanks := make(map[uuid.UUID]string, len(ranks))
+		for i, id := range ranks {
+			legacyRanks[id] = legacyRank(i)
+		}
+		if err := s.taskStore.Rank(ctx, legacyRanks); err != nil {
+			return err
+		}
+
+		project.UpdatedAt = evt.CreatedAt
+		if err := s.projectStore.Upsert(ctx, project, user); err != nil {
+			return fmt.Errorf("error storing project: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Event{}, err
+	}
+
+	return evt, nil
+}
+
+// compensateMove restores the ranks the move target changed, or sets
+// them again, along with the ones changed by the rebalance of the same
+// request. The tasks ranked since keep their rank.
+func (s service) compensateMove(ctx context.Context, user User, typ EventType, target Event) (Event, error) {
+	perm, err := s.userStore.Permission(ctx, user, target.ProjectUUID.String())
+	if err != nil {
+		return Event{}, err
+	}
+	if perm != "owner" {
+		return Event{}, ErrForbidden
+	}
+
+	before, after, err := rankChanges(ctx, s.eventStore, target)
+	if err != nil {
+		return Event{}, err
+	}
+	ranks := after
+	if typ == Undo {
+		ranks = before
+	}
+
+	compensation, err := json.Marshal(releaseRebalanceTasksPayload{Ranks: ranks})
+	if err != nil {
+		return Event{}, err
+	}
+
+	evt, err := newUndoEvent(typ, target, target.EntityUUID, target.ProjectUUID, user, ReleaseRebalanceTasks, compensation)
+	if err != nil {
+		return Event{}, err
+	}
+
+	err = s.transactor.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.eventStore.Store(ctx, evt); err != nil {
+			return fmt.Errorf("error storing event: %w", err)
+		}
+
+		if err := s.taskStore.Rank(ctx, ranks); err != nil {
+			return fmt.Errorf("error ranking tasks: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Event{}, err
+	}
+
+	return evt, nil
+}
+
+// rankChanges replays the project of e and returns the ranks of the
+// tasks changed by e and the rank events of the same request, before
+// and after them. An empty rank stands for an unranked task. The tasks
+// purged since are left out.
+func rankChanges(ctx context.Context, store EventStore, e Event) (map[uuid.UUID]string, map[uuid.UUID]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Event)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- store.List(ctx, EventFilter{ProjectUUID: e.ProjectUUID}, ch)
+	}()
+
+	p := NewProjection()
+	var before, after map[uuid.UUID]string
+	var err error
+	for evt := range ch {
+		if err != nil {
+			continue
+		}
+
+		move := evt.UUID == e.UUID || sameMove(e, evt)
+		if move && before == nil {
+			before = copyRanks(p.Ranks)
+		}
+		if err = p.Apply(evt); err != nil {
+			err = fmt.Errorf("error applying event %s: %w", evt.UUID, err)
+			continue
+		}
+		if move {
+			after = copyRanks(p.Ranks)
+		}
+	}
+	if listErr := <-errc; listErr != nil {
+		return nil, nil, listErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if before == nil {
+		return nil, nil, fmt.Errorf("event %s: %w", e.UUID, ErrNotFound)
+	}
+
+	changedBefore := make(map[uuid.UUID]string)
+	changedAfter := make(map[uuid.UUID]string)
+	for _, ranks := range []map[uuid.UUID]string{before, after} {
+		for id := range ranks {
+			if _, ok := p.Tasks[id]; !ok || before[id] == after[id] {
+				continue
+			}
+			changedBefore[id] = before[id]
+			changedAfter[id] = after[id]
+		}
+	}
+	return changedBefore, changedAfter, nil
+}
+
+func copyRanks(ranks map[uuid.UUID]string) map[uuid.UUID]string {
+	c := make(map[uuid.UUID]string, len(ranks))
+	for id, rank := range ranks {
+		c[id] = rank
+	}
+	return c
+}
+
+func newUndoEvent(
+	typ EventType,
+	target Event,
+	entityUUID uuid.UUID,
+	projectUUID uuid.UUID,
+	user User,
+	compensationType EventType,
+	compensation []byte,
+) (Event, error) {
+	var payload undoPayload
+	payload.EventUUID = target.UUID
+	payload.Event.Type = compensationType
+	payload.Event.Payload = compensation
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		UUID:        uuid.NewV1(),
+		Type:        typ,
+		EntityUUID:  entityUUID,
+		ProjectUUID: projectUUID,
+		UserID:      user.ID,
+		Payload:     b,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func uuidIn(id uuid.UUID, ids []uuid.UUID) bool {
+	for _, other := range ids {
+		if id == other {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndo(t *testing.T) {
+	ctx := context.Background()
+	taskUUID := uuid.NewV1()
+	releaseUUID := uuid.NewV1()
+	now := time.Now()
+
+	create := Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskCreate,
+		EntityUUID: taskUUID,
+		UserID:     "user",
+		Payload:    []byte(fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, releaseUUID)),
+		CreatedAt:  now,
+	}
+	update := Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskUpdate,
+		EntityUUID: taskUUID,
+		UserID:     "user",
+		Payload:    []byte(`{"title": "renamed", "status": "TODO"}`),
+		CreatedAt:  now.Add(time.Second),
+	}
+	done := Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskDone,
+		EntityUUID: taskUUID,
+		UserID:     "user",
+		Payload:    []byte(`{}`),
+		CreatedAt:  now.Add(2 * time.Second),
+	}
+	otherUpdate := Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskUpdate,
+		EntityUUID: taskUUID,
+		UserID:     "other",
+		Payload:    []byte(`{"title": "renamed again", "status": "DONE"}`),
+		CreatedAt:  now.Add(3 * time.Second),
+	}
+	store := &sliceEventStore{create, update, done, otherUpdate}
+
+	undoStack, redoStack, err := undoStacks(ctx, store, "user")
+	require.NoError(t, err)
+	require.Equal(t, []Event{update, done}, undoStack)
+	require.Empty(t, redoStack)
+
+	// Undoing the task completion only restores its status
+	changes, err := changesOf(ctx, store, done)
+	require.NoError(t, err)
+	require.Equal(t, map[string]FieldChange{
+		"status": {Field: "status", From: TaskStatusTODO, To: TaskStatusDONE},
+	}, changes)
+
+	undo, err := newUndoEvent(
+		Undo,
+		done,
+		taskUUID,
+		uuid.Nil,
+		User{ID: "user"},
+		TaskUpdate,
+		[]byte(`{"title": "renamed again", "status": "TODO"}`),
+	)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(ctx, undo))
+
+	undoStack, redoStack, err = undoStacks(ctx, store, "user")
+	require.NoError(t, err)
+	require.Equal(t, []Event{update}, undoStack)
+	require.Equal(t, []Event{done}, redoStack)
+
+	p := NewProjection()
+	for _, e := range *store {
+		require.NoError(t, p.Apply(e))
+	}
+	require.Equal(t, "renamed again", p.Tasks[taskUUID].Title)
+	require.Equal(t, TaskStatusTODO, p.Tasks[taskUUID].Status)
+	require.Equal(t, 5, p.Tasks[taskUUID].Version)
+
+	// A new action cannot be followed by a redo
+	require.NoError(t, store.Store(ctx, Event{
+		UUID:       uuid.NewV1(),
+		Type:       TaskDone,
+		EntityUUID: taskUUID,
+		UserID:     "user",
+		Payload:    []byte(`{}`),
+		CreatedAt:  now.Add(5 * time.Second),
+	}))
+	undoStack, redoStack, err = undoStacks(ctx, store, "user")
+	require.NoError(t, err)
+	require.Len(t, undoStack, 2)
+	require.Empty(t, redoStack)
+}
+
+func TestUndoMove(t *testing.T) {
+	ctx := context.Background()
+	projectUUID := uuid.NewV1()
+	first := uuid.NewV1()
+	second := uuid.NewV1()
+	now := time.Now()
+
+	event := func(typ EventType, entityUUID uuid.UUID, payload string, at time.Duration) Event {
+		return Event{
+			UUID:        uuid.NewV1(),
+			Type:        typ,
+			EntityUUID:  entityUUID,
+			ProjectUUID: projectUUID,
+			UserID:      "user",
+			Payload:     []byte(payload),
+			CreatedAt:   now.Add(at),
+		}
+	}
+	createPayload := fmt.Sprintf(`{"title": "task", "release": {"uuid": "%s"}}`, projectUUID)
+	store := &sliceEventStore{
+		event(ProjectCreate, projectUUID, `{"name": "project"}`, 0),
+		event(TaskCreate, first, createPayload, time.Second),
+		event(TaskCreate, second, createPayload, 2*time.Second),
+	}
+
+	// The first move only ranks the moved task, the second one
+	// rebalances the release
+	move := event(TaskMove, first, `{"rank": "i"}`, 3*time.Second)
+	require.NoError(t, store.Store(ctx, move))
+	correlationID := uuid.NewV1()
+	rebalancingMove := event(TaskMove, second, `{"rank": "c"}`, 4*time.Second)
+	rebalancingMove.CorrelationID = correlationID
+	rebalance := event(ReleaseRebalanceTasks, projectUUID, fmt.Sprintf(`{"ranks": {"%s": "c", "%s": "o"}}`, second, first), 4*time.Second)
+	rebalance.CorrelationID = correlationID
+	require.NoError(t, store.Store(ctx, rebalancingMove))
+	require.NoError(t, store.Store(ctx, rebalance))
+
+	// The rebalance is undone along with its move
+	undoStack, redoStack, err := undoStacks(ctx, store, "user")
+	require.NoError(t, err)
+	require.Equal(t, []Event{move, rebalancingMove}, undoStack)
+	require.Empty(t, redoStack)
+
+	before, after, err := rankChanges(ctx, store, rebalancingMove)
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID]string{first: "i", second: ""}, before)
+	require.Equal(t, map[uuid.UUID]string{first: "o", second: "c"}, after)
+
+	before, after, err = rankChanges(ctx, store, move)
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID]string{first: ""}, before)
+	require.Equal(t, map[uuid.UUID]string{first: "i"}, after)
+
+	ranks := func(t *testing.T) map[uuid.UUID]string {
+		p := NewProjection()
+		for _, e := range *store {
+			require.NoError(t, p.Apply(e))
+		}
+		return p.Ranks
+	}
+	compensate := func(t *testing.T, typ EventType, target Event, ranks map[uuid.UUID]string) {
+		compensation, err := json.Marshal(releaseRebalanceTasksPayload{Ranks: ranks})
+		require.NoError(t, err)
+		evt, err := newUndoEvent(typ, target, target.EntityUUID, projectUUID, User{ID: "user"}, ReleaseRebalanceTasks, compensation)
+		require.NoError(t, err)
+		require.NoError(t, ValidateEvent(evt))
+		require.NoError(t, store.Store(ctx, evt))
+	}
+
+	// Undoing the rebalancing move restores the previous ranks, the
+	// second task is unranked again
+	before, _, err = rankChanges(ctx, store, rebalancingMove)
+	require.NoError(t, err)
+	compensate(t, Undo, rebalancingMove, before)
+	require.Equal(t, map[uuid.UUID]string{first: "i"}, ranks(t))
+
+	undoStack, redoStack, err = undoStacks(ctx, store, "user")
+	require.NoError(t, err)
+	require.Equal(t, []Event{move}, undoStack)
+	require.Equal(t, []Event{rebalancingMove}, redoStack)
+
+	// Redoing it ranks the tasks again
+	_, after, err = rankChanges(ctx, store, rebalancingMove)
+	require.NoError(t, err)
+	compensate(t, Redo, rebalancingMove, after)
+	require.Equal(t, map[uuid.UUID]string{first: "o", second: "c"}, ranks(t))
+
+	undoStack, redoStack, err = undoStacks(ctx, store, "user")
+	require.NoError(t, err)
+	require.Equal(t, []Event{move, rebalancingMove}, undoStack)
+	require.Empty(t, redoStack)
+}
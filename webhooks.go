@@ -0,0 +1,301 @@
+package tonight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo"
+	uuid "github.com/satori/go.uuid"
+)
+
+// A Webhook subscribes a URL to the events of a project. Webhooks are
+// configuration, not recorded as events, so that their secrets stay
+// out of the event log.
+type Webhook struct {
+	UUID        uuid.UUID `json:"uuid"`
+	ProjectUUID uuid.UUID `json:"project_uuid"`
+
+	URL string `json:"url"`
+	// Secret signs the deliveries, it is never sent back to clients
+	Secret string `json:"-"`
+	// Types of the events delivered, all of them if empty
+	Types []EventType `json:"types"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (w Webhook) matches(e Event) bool {
+	if w.ProjectUUID != e.ProjectUUID {
+		return false
+	}
+	if len(w.Types) == 0 {
+		return true
+	}
+	return typeIn(e.Type, w.Types)
+}
+
+func typeIn(typ EventType, types []EventType) bool {
+	for _, other := range types {
+		if typ == other {
+			return true
+		}
+	}
+	return false
+}
+
+// A WebhookDelivery logs an attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	UUID        uuid.UUID `json:"uuid"`
+	WebhookUUID uuid.UUID `json:"webhook_uuid"`
+
+	EventUUID uuid.UUID `json:"event_uuid"`
+	EventType EventType `json:"event_type"`
+	Attempt   int       `json:"attempt"`
+
+	// StatusCode is 0 when no response was received
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A QueuedDelivery is an event waiting to be delivered to a webhook.
+type QueuedDelivery struct {
+	UUID        uuid.UUID
+	WebhookUUID uuid.UUID
+	Event       Event
+
+	// Attempt is the number of the next attempt, starting at 1
+	Attempt       int
+	NextAttemptAt time.Time
+}
+
+// A WebhookStore stores the webhooks, the log of their deliveries and
+// the queue of the deliveries to attempt. Deleting a webhook deletes
+// its deliveries.
+type WebhookStore interface {
+	Upsert(ctx context.Context, w Webhook) error
+	Get(ctx context.Context, uuid uuid.UUID) (Webhook, error)
+	List(ctx context.Context, projectUUID uuid.UUID) ([]Webhook, error)
+	Delete(ctx context.Context, uuid uuid.UUID) error
+
+	// LogDelivery records an attempt, and Deliveries returns the most
+	// recent ones first.
+	LogDelivery(ctx context.Context, d WebhookDelivery) error
+	Deliveries(ctx context.Context, webhookUUID uuid.UUID, limit int) ([]WebhookDelivery, error)
+
+	// Enqueue inserts d in the queue, or updates it if already queued.
+	Enqueue(ctx context.Context, d QueuedDelivery) error
+	// Due returns the queued deliveries whose next attempt is at or
+	// before now, the oldest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]QueuedDelivery, error)
+	Dequeue(ctx context.Context, uuid uuid.UUID) error
+}
+
+type webhookService struct {
+	store     WebhookStore
+	userStore UserStore
+}
+
+type webhookBody struct {
+	URL    string      `json:"url"`
+	Secret string      `json:"secret"`
+	Types  []EventType `json:"types"`
+}
+
+func (b webhookBody) validate() error {
+	u, err := url.Parse(b.URL)
+	if err != nil {
+		return invalid("url", "is invalid: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return invalid("url", "should be an http or https url")
+	}
+
+	if b.Secret == "" {
+		return invalid("secret", "cannot be empty")
+	}
+
+	for _, typ := range b.Types {
+		if _, ok := schemas[typ]; !ok {
+			return invalid("types", "has an unknown event type %s", typ)
+		}
+	}
+	return nil
+}
+
+// owner returns the project of the url, checking that the user owns it
+func (s *webhookService) owner(c echo.Context) (uuid.UUID, error) {
+	projectUUID, err := uuidParam(c, "uuid")
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	user, err := userFromHeader(c)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	perm, err := s.userStore.Permission(c.Request().Context(), user, projectUUID.String())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if perm != "owner" {
+		return uuid.Nil, ErrForbidden
+	}
+
+	return projectUUID, nil
+}
+
+// webhook returns the webhook of the url, checking that it belongs to
+// the project.
+func (s *webhookService) webhook(c echo.Context, projectUUID uuid.UUID) (Webhook, error) {
+	id, err := uuidParam(c, "webhook_uuid")
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	w, err := s.store.Get(c.Request().Context(), id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if w.ProjectUUID != projectUUID {
+		return Webhook{}, fmt.Errorf("webhook %s: %w", id, ErrNotFound)
+	}
+	return w, nil
+}
+
+func (s *webhookService) list(c echo.Context) error {
+	projectUUID, err := s.owner(c)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := s.store.List(c.Request().Context(), projectUUID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": webhooks,
+	})
+}
+
+func (s *webhookService) create(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	projectUUID, err := s.owner(c)
+	if err != nil {
+		return err
+	}
+
+	var body webhookBody
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return invalidBody(err)
+	}
+	if err := body.validate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := Webhook{
+		UUID:        uuid.NewV1(),
+		ProjectUUID: projectUUID,
+		URL:         body.URL,
+		Secret:      body.Secret,
+		Types:       body.Types,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.store.Upsert(c.Request().Context(), w); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": w,
+	})
+}
+
+func (s *webhookService) update(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	projectUUID, err := s.owner(c)
+	if err != nil {
+		return err
+	}
+
+	w, err := s.webhook(c, projectUUID)
+	if err != nil {
+		return err
+	}
+
+	var body webhookBody
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		return invalidBody(err)
+	}
+	// The secret is write only, keep it when not given
+	if body.Secret == "" {
+		body.Secret = w.Secret
+	}
+	if err := body.validate(); err != nil {
+		return err
+	}
+
+	w.URL = body.URL
+	w.Secret = body.Secret
+	w.Types = body.Types
+	w.UpdatedAt = time.Now()
+	if err := s.store.Upsert(c.Request().Context(), w); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": w,
+	})
+}
+
+func (s *webhookService) delete(c echo.Context) error {
+	projectUUID, err := s.owner(c)
+	if err != nil {
+		return err
+	}
+
+	w, err := s.webhook(c, projectUUID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(c.Request().Context(), w.UUID); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": "ok",
+	})
+}
+
+func (s *webhookService) deliveries(c echo.Context) error {
+	projectUUID, err := s.owner(c)
+	if err != nil {
+		return err
+	}
+
+	w, err := s.webhook(c, projectUUID)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := s.store.Deliveries(c.Request().Context(), w.UUID, 100)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"data": deliveries,
+	})
+}